@@ -0,0 +1,283 @@
+// loadtest drives /api/lookup and /api/read (or create_file and unlink in
+// churn mode) of a running server at high concurrency and reports
+// throughput and latency percentiles. Run it once
+// with -keepalive=false and once with -keepalive=true (server configured
+// with app.keep_alive: negotiate or always) to compare connection policies.
+// Database statements per request are taken from the server's /metrics, run
+// with cache.enabled on and off to see what the metadata cache saves;
+// per-method counts are in the vtfs_service_call_queries histogram.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+const fileName = "loadtest.bin"
+
+type config struct {
+	addr        string
+	token       string
+	concurrency int
+	duration    time.Duration
+	keepAlive   bool
+	mode        string
+	fileSize    int
+	readSize    int
+}
+
+type result struct {
+	ops       atomic.Int64
+	errors    atomic.Int64
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.addr, "addr", "http://localhost:8082", "server base URL")
+	flag.StringVar(&cfg.token, "token", "loadtest", "filesystem token")
+	flag.IntVar(&cfg.concurrency, "c", 64, "number of concurrent workers")
+	flag.DurationVar(&cfg.duration, "d", 10*time.Second, "test duration")
+	flag.BoolVar(&cfg.keepAlive, "keepalive", false, "reuse connections (sends Connection: keep-alive)")
+	flag.StringVar(&cfg.mode, "mode", "mixed", "lookup, read, mixed or churn (create and unlink)")
+	flag.IntVar(&cfg.fileSize, "file-size", 64*1024, "size of the file created for read test")
+	flag.IntVar(&cfg.readSize, "read-size", 4096, "bytes per read request")
+	flag.Parse()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DisableKeepAlives:   !cfg.keepAlive,
+			MaxIdleConnsPerHost: cfg.concurrency,
+		},
+	}
+
+	rootIno, fileIno, err := setup(client, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "setup failed:", err)
+		os.Exit(1)
+	}
+
+	queriesBefore, haveQueries := dbQueries(client, cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+
+	res := &result{}
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			var local []time.Duration
+
+			for n := 0; ctx.Err() == nil; n++ {
+				var params url.Values
+				var path string
+
+				useRead := cfg.mode == "read" || (cfg.mode == "mixed" && (worker+n)%2 == 0)
+				switch {
+				case cfg.mode == "churn":
+					// Every worker creates and removes a file of its own
+					path = "/api/create_file"
+					if n%2 == 1 {
+						path = "/api/unlink"
+					}
+					params = url.Values{
+						"token":  {cfg.token},
+						"parent": {strconv.FormatInt(rootIno, 10)},
+						"name":   {fmt.Sprintf("churn-%d", worker)},
+						"mode":   {"420"},
+					}
+				case useRead:
+					path = "/api/read"
+					offset := (n * cfg.readSize) % cfg.fileSize
+					params = url.Values{
+						"token":  {cfg.token},
+						"ino":    {strconv.FormatInt(fileIno, 10)},
+						"len":    {strconv.Itoa(cfg.readSize)},
+						"offset": {strconv.Itoa(offset)},
+					}
+				default:
+					path = "/api/lookup"
+					params = url.Values{
+						"token":  {cfg.token},
+						"parent": {strconv.FormatInt(rootIno, 10)},
+						"name":   {fileName},
+					}
+				}
+
+				reqStart := time.Now()
+				code, _, err := call(client, cfg, path, params)
+				if ctx.Err() != nil {
+					break
+				}
+				local = append(local, time.Since(reqStart))
+
+				if err != nil || code != 0 {
+					res.errors.Add(1)
+					continue
+				}
+				res.ops.Add(1)
+			}
+
+			res.mu.Lock()
+			res.latencies = append(res.latencies, local...)
+			res.mu.Unlock()
+		}(i)
+	}
+
+	wg.Wait()
+	report(cfg, res, time.Since(start))
+
+	if queriesAfter, ok := dbQueries(client, cfg); ok && haveQueries {
+		total := res.ops.Load() + res.errors.Load()
+		fmt.Printf("db queries: %.0f total, %.2f per request\n",
+			queriesAfter-queriesBefore, (queriesAfter-queriesBefore)/float64(max(total, 1)))
+	}
+}
+
+// dbQueries reads vtfs_db_queries_total from server metrics
+func dbQueries(client *http.Client, cfg config) (float64, bool) {
+	const metric = "vtfs_db_queries_total "
+
+	resp, err := client.Get(cfg.addr + "/metrics")
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, metric); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+// setup creates filesystem (if needed) and a file of file-size bytes to read from
+func setup(client *http.Client, cfg config) (int64, int64, error) {
+	// Init fails with EEXIST on repeated runs, that is fine
+	if _, _, err := call(client, cfg, "/api/init", url.Values{"token": {cfg.token}}); err != nil {
+		return 0, 0, err
+	}
+
+	code, data, err := call(client, cfg, "/api/get_root", url.Values{"token": {cfg.token}})
+	if err != nil {
+		return 0, 0, err
+	}
+	if code != 0 {
+		return 0, 0, fmt.Errorf("get_root returned %d", code)
+	}
+	rootIno := binary.NewDecoder(data).Int64()
+
+	lookup := url.Values{"token": {cfg.token}, "parent": {strconv.FormatInt(rootIno, 10)}, "name": {fileName}}
+	code, data, err = call(client, cfg, "/api/lookup", lookup)
+	if err != nil {
+		return 0, 0, err
+	}
+	if code == 0 {
+		return rootIno, binary.NewDecoder(data).Int64(), nil
+	}
+
+	create := url.Values{"token": {cfg.token}, "parent": {strconv.FormatInt(rootIno, 10)}, "name": {fileName}, "mode": {"420"}}
+	code, data, err = call(client, cfg, "/api/create_file", create)
+	if err != nil {
+		return 0, 0, err
+	}
+	if code != 0 {
+		return 0, 0, fmt.Errorf("create_file returned %d", code)
+	}
+	fileIno := binary.NewDecoder(data).Int64()
+
+	// Fill file in chunks so query string stays reasonably small
+	const chunk = 8 * 1024
+	payload := make([]byte, chunk)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	for offset := 0; offset < cfg.fileSize; offset += chunk {
+		n := min(chunk, cfg.fileSize-offset)
+		write := url.Values{
+			"token":  {cfg.token},
+			"ino":    {strconv.FormatInt(fileIno, 10)},
+			"len":    {strconv.Itoa(n)},
+			"offset": {strconv.Itoa(offset)},
+			"data":   {base64.StdEncoding.EncodeToString(payload[:n])},
+		}
+		code, _, err := call(client, cfg, "/api/write", write)
+		if err != nil {
+			return 0, 0, err
+		}
+		if code != 0 {
+			return 0, 0, fmt.Errorf("write returned %d", code)
+		}
+	}
+
+	return rootIno, fileIno, nil
+}
+
+func call(client *http.Client, cfg config, path string, params url.Values) (int64, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, cfg.addr+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if cfg.keepAlive {
+		req.Header.Set("Connection", "keep-alive")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return binary.DecodeCode(body)
+}
+
+func report(cfg config, res *result, elapsed time.Duration) {
+	slices.Sort(res.latencies)
+
+	percentile := func(p float64) time.Duration {
+		if len(res.latencies) == 0 {
+			return 0
+		}
+		idx := int(float64(len(res.latencies)-1) * p)
+		return res.latencies[idx]
+	}
+
+	ops := res.ops.Load()
+	fmt.Printf("mode=%s keepalive=%t concurrency=%d duration=%s\n", cfg.mode, cfg.keepAlive, cfg.concurrency, elapsed.Round(time.Millisecond))
+	fmt.Printf("requests: %d ok, %d failed\n", ops, res.errors.Load())
+	fmt.Printf("throughput: %.0f req/s\n", float64(ops)/elapsed.Seconds())
+	fmt.Printf("latency: p50=%s p90=%s p99=%s max=%s\n",
+		percentile(0.50), percentile(0.90), percentile(0.99), percentile(1))
+}
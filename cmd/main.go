@@ -11,11 +11,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/S1riyS/os-course-lab-4/server/internal/audit"
 	"github.com/S1riyS/os-course-lab-4/server/internal/config"
+	"github.com/S1riyS/os-course-lab-4/server/internal/dav"
+	"github.com/S1riyS/os-course-lab-4/server/internal/dedup"
+	"github.com/S1riyS/os-course-lab-4/server/internal/events"
 	"github.com/S1riyS/os-course-lab-4/server/internal/handler"
+	"github.com/S1riyS/os-course-lab-4/server/internal/journal"
+	"github.com/S1riyS/os-course-lab-4/server/internal/lock"
+	"github.com/S1riyS/os-course-lab-4/server/internal/metrics"
 	"github.com/S1riyS/os-course-lab-4/server/internal/middleware"
+	"github.com/S1riyS/os-course-lab-4/server/internal/ninep"
 	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/internal/rpc"
 	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/internal/sftpd"
+	"github.com/S1riyS/os-course-lab-4/server/internal/tracing"
+	"github.com/S1riyS/os-course-lab-4/server/internal/validation"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
@@ -35,27 +47,118 @@ func main() {
 
 	logger := logging.GetLoggerFromContextWithOp(ctx, "main")
 
+	// Tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		logger.Error("Failed to setup tracing", slogext.Err(err))
+		panic(err)
+	}
+
 	// Database
 	db := postgresql.MustNewClient(ctx, cfg.Database)
 
+	// Content compression
+	compression, err := repository.NewCompression(cfg.Compression.Default, cfg.Compression.Filesystems)
+	if err != nil {
+		logger.Error("Invalid compression config", slogext.Err(err))
+		panic(err)
+	}
+
 	// Repositories
 	fsRepo := repository.NewFilesystemRepository(db)
 	inodeRepo := repository.NewInodeRepository(db)
 	dirRepo := repository.NewDirectoryRepository(db)
-	contentRepo := repository.NewContentRepository(db)
+	contentRepo := repository.NewContentRepository(db, compression)
+	handleRepo := repository.NewHandleRepository(db)
+	trashRepo := repository.NewTrashRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	chunkRepo := repository.NewChunkRepository(db)
+
+	// Metrics
+	appMetrics := metrics.New()
+	appMetrics.RegisterPool(db)
+
+	// Metadata cache
+	if cfg.Cache.Enabled {
+		cache := repository.NewMetadataCache(cfg.Cache.InodeEntries, cfg.Cache.DirentEntries)
+		inodeRepo = cache.InodeRepository(inodeRepo)
+		dirRepo = cache.DirectoryRepository(dirRepo)
+		appMetrics.RegisterCache("inodes", cache.InodeStats)
+		appMetrics.RegisterCache("dirents", cache.DirentStats)
+	}
+
+	// Events
+	broker := events.NewBroker(cfg.Events.BufferSize)
 
 	// Service
-	fsService := service.NewFileSystemService(db, fsRepo, inodeRepo, dirRepo, contentRepo)
+	fsService := service.NewFileSystemService(db, fsRepo, inodeRepo, dirRepo, contentRepo, handleRepo, trashRepo, cfg.Handles.Lease, cfg.App.MaxFileSize, broker)
+
+	// Service decorators
+	fsService = validation.NewValidatedService(fsService, cfg.App.MaxFileSize)
+	var opJournal *journal.Journal
+	if cfg.Journal.Enabled {
+		opJournal, err = journal.Open(cfg.Journal.Path, cfg.Journal.Sync)
+		if err != nil {
+			logger.Error("Failed to open journal", slogext.Err(err))
+			panic(err)
+		}
+		fsService = journal.NewJournaledService(fsService, opJournal)
+	}
+	if cfg.Audit.Enabled {
+		fsService = audit.NewAuditedService(fsService, auditRepo)
+	}
+	fsService = metrics.NewInstrumentedService(fsService, appMetrics)
+	fsService = tracing.NewTracedService(fsService)
+
+	// Background workers
+	workersCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+
+	handleReaper := service.NewHandleReaper(db, handleRepo, inodeRepo, cfg.Handles.ReapInterval)
+	go handleReaper.Run(workersCtx)
+
+	trashPurger := service.NewTrashPurger(db, trashRepo, inodeRepo, cfg.Trash.TTL, cfg.Trash.PurgeInterval)
+	go trashPurger.Run(workersCtx)
+
+	chunkCollector := dedup.NewCollector(chunkRepo, cfg.Chunks.CollectBatch, cfg.Chunks.CollectInterval)
+	go chunkCollector.Run(workersCtx)
+
+	if cfg.Audit.Enabled {
+		auditCleaner := audit.NewCleaner(auditRepo, cfg.Audit.Retention, cfg.Audit.CleanupInterval)
+		go auditCleaner.Run(workersCtx)
+	}
+
+	// Lock manager
+	lockManager := lock.NewManager(cfg.Locks.Lease, cfg.Locks.MaxWait)
+	go lockManager.Run(workersCtx, cfg.Locks.ReapInterval)
 
 	// Handler
-	h := handler.NewHandler(fsService)
+	h := handler.NewHandler(fsService, lockManager, broker, cfg.Events.Heartbeat, cfg.App.MaxReadSize)
 
 	// Router
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
+	mux.Handle("/metrics", appMetrics.Handler())
+	dedup.NewHandler(chunkRepo).RegisterRoutes(mux)
+	if cfg.WebDAV.Enabled {
+		dav.NewHandler(fsService).RegisterRoutes(mux)
+	}
+	if cfg.Audit.Enabled {
+		audit.NewHandler(auditRepo, cfg.Audit.MaxResults).RegisterRoutes(mux)
+	}
 
 	// Middlewares
-	handler := middleware.RequestIDMiddleware(mux)
+	var handler http.Handler = mux
+	handler = appMetrics.Middleware(handler, mux)
+	handler = tracing.Middleware(handler, mux)
+	handler = middleware.RequestIDMiddleware(handler)
+	handler = middleware.RemoteAddrMiddleware(handler)
+	handler = middleware.RequestLimitsMiddleware(cfg.App.MaxQuerySize, cfg.App.MaxBodySize, handler)
+	handler, err = middleware.ConnectionPolicyMiddleware(cfg.App.KeepAlive, handler)
+	if err != nil {
+		logger.Error("Invalid keep-alive policy", slogext.Err(err))
+		panic(err)
+	}
 
 	// HTTP Server
 	server := &http.Server{
@@ -75,12 +178,95 @@ func main() {
 		}
 	}()
 
+	// Binary RPC server
+	var rpcServer *rpc.Server
+	if cfg.RPC.Enabled {
+		rpcServer = rpc.NewServer(fsService, cfg.RPC.MaxFrameSize, cfg.RPC.MaxInFlight, uint32(cfg.App.MaxReadSize))
+
+		if cfg.RPC.Network == "unix" {
+			_ = os.Remove(cfg.RPC.Address)
+		}
+		ln, err := net.Listen(cfg.RPC.Network, cfg.RPC.Address)
+		if err != nil {
+			logger.Error("Failed to listen for RPC", slogext.Err(err))
+			panic(err)
+		}
+
+		go func() {
+			logger.Info("Starting RPC server", slog.String("network", cfg.RPC.Network), slog.String("address", cfg.RPC.Address))
+			if err := rpcServer.Serve(ctx, ln); err != nil {
+				logger.Error("RPC server stopped", slogext.Err(err))
+			}
+		}()
+	}
+
+	// 9P server
+	var ninepServer *ninep.Server
+	if cfg.NineP.Enabled {
+		ninepServer = ninep.NewServer(fsService, cfg.NineP.MaxMessageSize, cfg.NineP.MaxInFlight, uint32(cfg.App.MaxReadSize))
+
+		ln, err := net.Listen("tcp", cfg.NineP.Address)
+		if err != nil {
+			logger.Error("Failed to listen for 9P", slogext.Err(err))
+			panic(err)
+		}
+
+		go func() {
+			logger.Info("Starting 9P server", slog.String("address", cfg.NineP.Address))
+			if err := ninepServer.Serve(ctx, ln); err != nil {
+				logger.Error("9P server stopped", slogext.Err(err))
+			}
+		}()
+	}
+
+	// SFTP server
+	var sftpServer *sftpd.Server
+	if cfg.SFTP.Enabled {
+		hostKey, err := sftpd.LoadHostKey(cfg.SFTP.HostKeyPath)
+		if err != nil {
+			logger.Error("Failed to load SFTP host key", slogext.Err(err))
+			panic(err)
+		}
+
+		var authorizedKeys map[string]string
+		switch {
+		case cfg.SFTP.AuthorizedKeysPath != "":
+			authorizedKeys, err = sftpd.LoadAuthorizedKeys(cfg.SFTP.AuthorizedKeysPath)
+			if err != nil {
+				logger.Error("Failed to load SFTP authorized keys", slogext.Err(err))
+				panic(err)
+			}
+		case cfg.SFTP.AllowUnauthenticated:
+			logger.Warn("SFTP authentication is disabled, SSH user name is used as token")
+		default:
+			err := fmt.Errorf("sftp.authorized_keys_path is required unless sftp.allow_unauthenticated is set")
+			logger.Error("Invalid SFTP config", slogext.Err(err))
+			panic(err)
+		}
+
+		sftpServer = sftpd.NewServer(fsService, hostKey, authorizedKeys)
+
+		ln, err := net.Listen("tcp", cfg.SFTP.Address)
+		if err != nil {
+			logger.Error("Failed to listen for SFTP", slogext.Err(err))
+			panic(err)
+		}
+
+		go func() {
+			logger.Info("Starting SFTP server", slog.String("address", cfg.SFTP.Address))
+			if err := sftpServer.Serve(ctx, ln); err != nil {
+				logger.Error("SFTP server stopped", slogext.Err(err))
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Info("Shutting down server...")
+	stopWorkers()
 
 	// Graceful shutdown with timeout
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -91,6 +277,34 @@ func main() {
 	} else {
 		logger.Info("Server exited gracefully")
 	}
+
+	if rpcServer != nil {
+		if err := rpcServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("RPC server forced to shutdown", slogext.Err(err))
+		}
+	}
+
+	if ninepServer != nil {
+		if err := ninepServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("9P server forced to shutdown", slogext.Err(err))
+		}
+	}
+
+	if sftpServer != nil {
+		if err := sftpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("SFTP server forced to shutdown", slogext.Err(err))
+		}
+	}
+
+	if opJournal != nil {
+		if err := opJournal.Close(); err != nil {
+			logger.Error("Failed to close journal", slogext.Err(err))
+		}
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", slogext.Err(err))
+	}
 }
 
 func setupPrettySlog() *slog.Logger {
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"text/tabwriter"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/client"
+)
+
+const (
+	defaultFileMode fs.FileMode = 0o644
+	defaultDirMode  fs.FileMode = 0o755
+
+	// Uploads are sent in pieces of this size
+	putChunk = 1 << 20
+)
+
+func parseFlags(name string, args []string, define func(fs *flag.FlagSet)) ([]string, error) {
+	set := flag.NewFlagSet(name, flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	define(set)
+	if err := set.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	return set.Args(), nil
+}
+
+func runInit(c *client.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.Init()
+}
+
+func runLs(c *client.Client, args []string) error {
+	var long bool
+	args, err := parseFlags("ls", args, func(set *flag.FlagSet) {
+		set.BoolVar(&long, "l", false, "long format")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	var errs []error
+	for i, arg := range args {
+		name := remotePath(arg)
+
+		info, err := c.Stat(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		entries := []fs.DirEntry{fs.FileInfoToDirEntry(info)}
+		if info.IsDir() {
+			if len(args) > 1 {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "%s:\n", arg)
+			}
+			entries, err = c.ReadDir(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		for _, entry := range entries {
+			if !long {
+				fmt.Fprintln(w, entryName(entry))
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			meta := info.Sys().(*models.NodeMeta)
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", info.Mode(), meta.Ino, info.Size(), entryName(entry))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func runStat(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	var errs []error
+	for _, arg := range args {
+		name := remotePath(arg)
+
+		info, err := c.Stat(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		meta := info.Sys().(*models.NodeMeta)
+
+		kind := "regular file"
+		links := "-"
+		if info.IsDir() {
+			kind = "directory"
+		} else {
+			count, err := c.CountLinks(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			links = fmt.Sprint(count)
+		}
+
+		fmt.Printf("  File: %s\n", arg)
+		fmt.Printf("  Type: %s\n", kind)
+		fmt.Printf(" Inode: %d\n", meta.Ino)
+		fmt.Printf("  Mode: %04o (%s)\n", meta.Mode&0o777, info.Mode())
+		fmt.Printf("  Size: %d\n", meta.Size)
+		fmt.Printf(" Links: %s\n", links)
+	}
+
+	return errors.Join(errs...)
+}
+
+func runCat(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	for _, arg := range args {
+		if err := download(c, remotePath(arg), os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runGet(c *client.Client, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+
+	remote := remotePath(args[0])
+	local := path.Base(remote)
+	if len(args) == 2 {
+		local = args[1]
+	}
+	if local == "-" {
+		return download(c, remote, os.Stdout)
+	}
+
+	out, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	if err := download(c, remote, out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func download(c *client.Client, name string, w io.Writer) error {
+	f, err := c.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func runPut(c *client.Client, args []string) error {
+	var force bool
+	args, err := parseFlags("put", args, func(set *flag.FlagSet) {
+		set.BoolVar(&force, "f", false, "replace existing file")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	remote := remotePath(args[1])
+	// Like cp, a directory target receives the file under its own name
+	if info, err := c.Stat(remote); err == nil && info.IsDir() && args[0] != "-" {
+		remote = path.Join(remote, path.Base(args[0]))
+	}
+
+	if force {
+		// The /api protocol has no truncate, so the old file is replaced by a new inode
+		if err := c.Remove(remote); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := c.Create(remote, defaultFileMode); err != nil {
+		return err
+	}
+
+	buf := make([]byte, putChunk)
+	var offset int64
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			if _, err := c.WriteAt(remote, buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func runMkdir(c *client.Client, args []string) error {
+	var parents bool
+	args, err := parseFlags("mkdir", args, func(set *flag.FlagSet) {
+		set.BoolVar(&parents, "p", false, "create missing parents")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	for _, arg := range args {
+		if parents {
+			err = c.MkdirAll(remotePath(arg), defaultDirMode)
+		} else {
+			err = c.Mkdir(remotePath(arg), defaultDirMode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runRm(c *client.Client, args []string) error {
+	var recursive bool
+	args, err := parseFlags("rm", args, func(set *flag.FlagSet) {
+		set.BoolVar(&recursive, "r", false, "remove directories and their contents")
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	for _, arg := range args {
+		name := remotePath(arg)
+		if recursive {
+			err = removeAll(c, name)
+		} else {
+			err = c.Remove(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeAll(c *client.Client, name string) error {
+	info, err := c.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		entries, err := c.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := removeAll(c, path.Join(name, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.Remove(name)
+}
+
+func runLn(c *client.Client, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	return c.Link(remotePath(args[0]), remotePath(args[1]))
+}
+
+func runTree(c *client.Client, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	root := "."
+	if len(args) == 1 {
+		root = remotePath(args[0])
+	}
+
+	fmt.Println(root)
+	dirs, files := 0, 0
+	err := printTree(c, root, "", &dirs, &files)
+	fmt.Printf("\n%d directories, %d files\n", dirs, files)
+	return err
+}
+
+func printTree(c *client.Client, dir string, prefix string, dirs *int, files *int) error {
+	entries, err := c.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		branch, indent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Println(prefix + branch + entryName(entry))
+
+		if !entry.IsDir() {
+			*files++
+			continue
+		}
+		*dirs++
+		if err := printTree(c, path.Join(dir, entry.Name()), prefix+indent, dirs, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runDu(c *client.Client, args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+
+	// Shared between arguments, like du does
+	seen := make(map[int64]bool)
+	for _, arg := range args {
+		var total int64
+		err := fs.WalkDir(c, remotePath(arg), func(name string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			meta := info.Sys().(*models.NodeMeta)
+			if !seen[meta.Ino] {
+				seen[meta.Ino] = true
+				total += meta.Size
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d\t%s\n", total, arg)
+	}
+	return nil
+}
+
+func entryName(entry fs.DirEntry) string {
+	if entry.IsDir() && entry.Name() != "." {
+		return entry.Name() + "/"
+	}
+	return entry.Name()
+}
@@ -0,0 +1,122 @@
+// vtfsctl inspects and modifies filesystems of a running server through the
+// /api/* endpoints:
+//
+//	vtfsctl -token demo init
+//	vtfsctl -token demo put ./notes.txt docs/notes.txt
+//	vtfsctl -token demo tree
+//
+// Server address and token default to VTFS_ADDR and VTFS_TOKEN
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/client"
+)
+
+type command struct {
+	usage string
+	help  string
+	run   func(c *client.Client, args []string) error
+}
+
+var commands = map[string]command{
+	"init":  {"init", "create the filesystem", runInit},
+	"ls":    {"ls [-l] [path...]", "list directory contents", runLs},
+	"stat":  {"stat path...", "show node attributes", runStat},
+	"cat":   {"cat path...", "print files to stdout", runCat},
+	"get":   {"get remote [local]", "download file, local - means stdout", runGet},
+	"put":   {"put [-f] local remote", "upload file, -f replaces existing one", runPut},
+	"mkdir": {"mkdir [-p] path...", "create directories", runMkdir},
+	"rm":    {"rm [-r] path...", "remove files or empty directories, -r removes trees", runRm},
+	"ln":    {"ln target link", "create hard link", runLn},
+	"tree":  {"tree [path]", "print directory tree", runTree},
+	"du":    {"du [path...]", "print total size, hard links counted once", runDu},
+}
+
+func main() {
+	addr := flag.String("addr", envOr("VTFS_ADDR", "http://localhost:8082"), "server base URL")
+	token := flag.String("token", os.Getenv("VTFS_TOKEN"), "filesystem token")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "vtfsctl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "vtfsctl: token is required (-token or VTFS_TOKEN)")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c, err := client.New(ctx, *addr, *token, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "vtfsctl:", err)
+		os.Exit(1)
+	}
+
+	err = cmd.run(c.WithContext(ctx), flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "usage: vtfsctl %s\n", cmd.usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "vtfsctl:", err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("usage")
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: vtfsctl [-addr url] [-token token] command [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n", commands[name].usage, commands[name].help)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// remotePath turns user input into an io/fs path: it is cleaned, leading
+// slash is dropped and the root becomes "."
+func remotePath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
@@ -0,0 +1,99 @@
+// vtfsreplay rebuilds a filesystem from the operation journal written by the
+// server with journal.enabled. It connects to the database from the server
+// config and replays successful calls of one token into a new filesystem:
+//
+//	vtfsreplay -token demo -into demo-copy
+//	vtfsreplay -token demo -until 1200 -n
+//
+// -n prints the calls without touching the database
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/config"
+	"github.com/S1riyS/os-course-lab-4/server/internal/events"
+	"github.com/S1riyS/os-course-lab-4/server/internal/journal"
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/internal/validation"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+)
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "server config, for database and journal path")
+	path := flag.String("journal", "", "journal file, journal.path of the config if empty")
+	token := flag.String("token", "", "filesystem to replay")
+	into := flag.String("into", "", "token of the rebuilt filesystem, -token if empty; must not exist")
+	until := flag.Uint64("until", 0, "stop after this sequence number, 0 replays everything")
+	dryRun := flag.Bool("n", false, "print calls instead of replaying them")
+	verbose := flag.Bool("v", false, "print every call")
+	flag.Parse()
+
+	if *token == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.MustLoad(*configPath)
+	if *path == "" {
+		*path = cfg.Journal.Path
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	ctx = logging.MakeContextWithLogger(ctx, logger)
+
+	opts := journal.ReplayOptions{
+		Token:  *token,
+		Into:   *into,
+		Until:  *until,
+		DryRun: *dryRun,
+	}
+	if *verbose || *dryRun {
+		opts.Log = func(format string, args ...any) {
+			fmt.Printf(format+"\n", args...)
+		}
+	}
+
+	var fsService service.FileSystemService
+	if !*dryRun {
+		compression, err := repository.NewCompression(cfg.Compression.Default, cfg.Compression.Filesystems)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "vtfsreplay: %v\n", err)
+			os.Exit(2)
+		}
+
+		db := postgresql.MustNewClient(ctx, cfg.Database)
+		defer db.Close()
+
+		fsService = service.NewFileSystemService(
+			db,
+			repository.NewFilesystemRepository(db),
+			repository.NewInodeRepository(db),
+			repository.NewDirectoryRepository(db),
+			repository.NewContentRepository(db, compression),
+			repository.NewHandleRepository(db),
+			repository.NewTrashRepository(db),
+			cfg.Handles.Lease,
+			cfg.App.MaxFileSize,
+			events.NewBroker(cfg.Events.BufferSize),
+		)
+		fsService = validation.NewValidatedService(fsService, cfg.App.MaxFileSize)
+	}
+
+	stats, err := journal.Replay(ctx, fsService, *path, opts)
+	fmt.Fprintf(os.Stderr, "replayed %d, skipped %d failed and %d incomplete\n",
+		stats.Replayed, stats.Failed, stats.Incomplete)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vtfsreplay: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Cleaner deletes audit records older than the retention period
+type Cleaner struct {
+	repo      repository.AuditRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewCleaner(repo repository.AuditRepository, retention time.Duration, interval time.Duration) *Cleaner {
+	return &Cleaner{repo: repo, retention: retention, interval: interval}
+}
+
+// Run blocks until ctx is cancelled
+func (c *Cleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.clean(ctx)
+		}
+	}
+}
+
+func (c *Cleaner) clean(ctx context.Context) {
+	const op = "audit.Cleaner.clean"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	deleted, err := c.repo.DeleteOlderThan(ctx, c.retention)
+	if err != nil {
+		logger.Error("Failed to delete old audit records", slogext.Err(err))
+		return
+	}
+
+	if deleted > 0 {
+		logger.Info("Deleted old audit records", slog.Int64("deleted", deleted))
+	}
+}
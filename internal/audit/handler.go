@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+const defaultLimit = 100
+
+// Handler serves the audit log:
+//
+//	GET /admin/audit?token=demo&op=unlink&since=2024-05-01T00:00:00Z&until=...&before=<id>&limit=100
+//
+// All parameters are optional. Records are returned newest first as a JSON
+// array; pass the smallest returned id as before to get the next page
+type Handler struct {
+	repo       repository.AuditRepository
+	maxResults int
+}
+
+func NewHandler(repo repository.AuditRepository, maxResults int) *Handler {
+	return &Handler{repo: repo, maxResults: maxResults}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/audit", h.HandleList)
+}
+
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "audit.Handler.HandleList"
+
+	filter, err := h.parseFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	records, err := h.repo.List(ctx, filter)
+	if err != nil {
+		logger := logging.GetLoggerFromContextWithOp(ctx, op)
+		logger.Error("Failed to list audit records", slogext.Err(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+func (h *Handler) parseFilter(r *http.Request) (models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		Token: query.Get("token"),
+		Op:    query.Get("op"),
+		Limit: min(defaultLimit, h.maxResults),
+	}
+
+	var err error
+	if v := query.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid since, want RFC 3339 time")
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid until, want RFC 3339 time")
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		if filter.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil || filter.BeforeID <= 0 {
+			return filter, fmt.Errorf("invalid before, want positive record id")
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit, want positive number")
+		}
+		filter.Limit = min(limit, h.maxResults)
+	}
+
+	return filter, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
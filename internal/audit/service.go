@@ -0,0 +1,137 @@
+// Package audit records who changed what in every filesystem: mutating
+// service calls are stored in the audit_log table with request ID and
+// client address, can be queried at /admin/audit and are deleted after the
+// retention period
+package audit
+
+import (
+	"context"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Op names follow event types of /api/events, these have no event of
+// their own
+const (
+	opTruncate       = "truncate"
+	opReplace        = "replace"
+	opRestore        = "restore"
+	opRestoreVersion = "restore_version"
+)
+
+// auditedService records mutating calls of next, failed ones included.
+// Reads and handle operations are passed through
+type auditedService struct {
+	service.FileSystemService
+	repo repository.AuditRepository
+}
+
+func NewAuditedService(next service.FileSystemService, repo repository.AuditRepository) service.FileSystemService {
+	return &auditedService{FileSystemService: next, repo: repo}
+}
+
+// record stores the call after it returned. The call has already taken
+// effect, so failing to store it only logs
+func (s *auditedService) record(ctx context.Context, record models.AuditRecord, err error) {
+	record.RequestID = logging.GetRequestIDFromCtx(ctx)
+	record.RemoteAddr = logging.GetRemoteAddrFromCtx(ctx)
+	if err != nil {
+		record.Code = service.ErrorCode(err)
+	}
+
+	// Cancelled request must not lose its record
+	if insertErr := s.repo.Insert(context.WithoutCancel(ctx), &record); insertErr != nil {
+		logger := logging.GetLoggerFromContextWithOp(ctx, "audit.auditedService.record")
+		logger.Error("Failed to record audit event", slogext.Err(insertErr), "token", record.Token, "audit_op", record.Op)
+	}
+}
+
+func (s *auditedService) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	meta, err := s.FileSystemService.CreateFile(ctx, token, parentIno, name, mode)
+	record := models.AuditRecord{Token: token, Op: string(models.EventCreate), ParentIno: parentIno, Name: name}
+	if err == nil {
+		record.Ino = meta.Ino
+	}
+	s.record(ctx, record, err)
+	return meta, err
+}
+
+func (s *auditedService) Unlink(ctx context.Context, token string, parentIno int64, name string) error {
+	err := s.FileSystemService.Unlink(ctx, token, parentIno, name)
+	s.record(ctx, models.AuditRecord{Token: token, Op: string(models.EventUnlink), ParentIno: parentIno, Name: name}, err)
+	return err
+}
+
+func (s *auditedService) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	meta, err := s.FileSystemService.CreateDir(ctx, token, parentIno, name, mode)
+	record := models.AuditRecord{Token: token, Op: string(models.EventMkdir), ParentIno: parentIno, Name: name}
+	if err == nil {
+		record.Ino = meta.Ino
+	}
+	s.record(ctx, record, err)
+	return meta, err
+}
+
+func (s *auditedService) Rmdir(ctx context.Context, token string, parentIno int64, name string) error {
+	err := s.FileSystemService.Rmdir(ctx, token, parentIno, name)
+	s.record(ctx, models.AuditRecord{Token: token, Op: string(models.EventRmdir), ParentIno: parentIno, Name: name}, err)
+	return err
+}
+
+func (s *auditedService) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (int64, error) {
+	written, err := s.FileSystemService.Write(ctx, token, ino, data, length, offset)
+	s.record(ctx, models.AuditRecord{Token: token, Op: string(models.EventWrite), Ino: ino}, err)
+	return written, err
+}
+
+func (s *auditedService) Truncate(ctx context.Context, token string, ino int64, size int64) error {
+	err := s.FileSystemService.Truncate(ctx, token, ino, size)
+	s.record(ctx, models.AuditRecord{Token: token, Op: opTruncate, Ino: ino}, err)
+	return err
+}
+
+func (s *auditedService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error {
+	err := s.FileSystemService.ReplaceContent(ctx, token, ino, data)
+	s.record(ctx, models.AuditRecord{Token: token, Op: opReplace, Ino: ino}, err)
+	return err
+}
+
+func (s *auditedService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error {
+	err := s.FileSystemService.Link(ctx, token, targetIno, parentIno, name)
+	s.record(ctx, models.AuditRecord{Token: token, Op: string(models.EventLink), Ino: targetIno, ParentIno: parentIno, Name: name}, err)
+	return err
+}
+
+func (s *auditedService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error {
+	err := s.FileSystemService.Rename(ctx, token, oldParentIno, oldName, newParentIno, newName)
+	s.record(ctx, models.AuditRecord{
+		Token:        token,
+		Op:           string(models.EventRename),
+		ParentIno:    oldParentIno,
+		Name:         oldName,
+		NewParentIno: newParentIno,
+		NewName:      newName,
+	}, err)
+	return err
+}
+
+func (s *auditedService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error) {
+	meta, err := s.FileSystemService.RestoreTrash(ctx, token, id, parentIno, name)
+	record := models.AuditRecord{Token: token, Op: opRestore, ParentIno: parentIno, Name: name}
+	if err == nil {
+		record.Ino = meta.Ino
+		record.ParentIno = meta.ParentIno
+	}
+	s.record(ctx, record, err)
+	return meta, err
+}
+
+func (s *auditedService) RestoreVersion(ctx context.Context, token string, ino int64, version int64) error {
+	err := s.FileSystemService.RestoreVersion(ctx, token, ino, version)
+	s.record(ctx, models.AuditRecord{Token: token, Op: opRestoreVersion, Ino: ino}, err)
+	return err
+}
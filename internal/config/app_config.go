@@ -7,4 +7,15 @@ import (
 type AppConfig struct {
 	Port           int           `yaml:"port"`
 	DefaultTimeout time.Duration `yaml:"default_timeout"`
+	// close, negotiate or always, see middleware.ConnectionPolicyMiddleware
+	KeepAlive string `yaml:"keep_alive" env-default:"close"`
+	// Longest /api/read, RPC and 9P read reply and chunk size of streamed
+	// REST downloads
+	MaxReadSize int `yaml:"max_read_size" env-default:"1048576"`
+	// Longer query strings are rejected, /api/write carries data there
+	MaxQuerySize int `yaml:"max_query_size" env-default:"262144"`
+	// Request bodies (REST and WebDAV uploads) are cut at this size
+	MaxBodySize int64 `yaml:"max_body_size" env-default:"67108864"`
+	// Writes and truncates past this size fail with EFBIG
+	MaxFileSize int64 `yaml:"max_file_size" env-default:"1073741824"`
 }
@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+type AuditConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Retention       time.Duration `yaml:"retention" env-default:"720h"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1h"`
+	// Upper bound for limit of /admin/audit
+	MaxResults int `yaml:"max_results" env-default:"1000"`
+}
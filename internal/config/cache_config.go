@@ -0,0 +1,7 @@
+package config
+
+type CacheConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	InodeEntries  int  `yaml:"inode_entries" env-default:"65536"`
+	DirentEntries int  `yaml:"dirent_entries" env-default:"65536"`
+}
@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+// Unreferenced content chunks are deleted in batches every CollectInterval
+type ChunksConfig struct {
+	CollectInterval time.Duration `yaml:"collect_interval" env-default:"10m"`
+	CollectBatch    int           `yaml:"collect_batch" env-default:"1000"`
+}
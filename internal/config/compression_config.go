@@ -0,0 +1,8 @@
+package config
+
+// Compression of stored content chunks, none or gzip. Filesystems maps
+// tokens to their own setting, others use Default
+type CompressionConfig struct {
+	Default     string            `yaml:"default" env-default:"none"`
+	Filesystems map[string]string `yaml:"filesystems"`
+}
@@ -7,8 +7,22 @@ import (
 )
 
 type Config struct {
-	App      AppConfig      `yaml:"app"`
-	Database DatabaseConfig `yaml:"database"`
+	App         AppConfig         `yaml:"app"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Handles     HandlesConfig     `yaml:"handles"`
+	Trash       TrashConfig       `yaml:"trash"`
+	Chunks      ChunksConfig      `yaml:"chunks"`
+	Compression CompressionConfig `yaml:"compression"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Locks       LocksConfig       `yaml:"locks"`
+	Events      EventsConfig      `yaml:"events"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Journal     JournalConfig     `yaml:"journal"`
+	Audit       AuditConfig       `yaml:"audit"`
+	RPC         RPCConfig         `yaml:"rpc"`
+	WebDAV      WebDAVConfig      `yaml:"webdav"`
+	NineP       NinePConfig       `yaml:"ninep"`
+	SFTP        SFTPConfig        `yaml:"sftp"`
 }
 
 func MustLoad(configPath string) *Config {
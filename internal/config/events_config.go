@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type EventsConfig struct {
+	BufferSize int           `yaml:"buffer_size" env-default:"256"`
+	Heartbeat  time.Duration `yaml:"heartbeat" env-default:"15s"`
+}
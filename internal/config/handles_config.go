@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type HandlesConfig struct {
+	Lease        time.Duration `yaml:"lease" env-default:"5m"`
+	ReapInterval time.Duration `yaml:"reap_interval" env-default:"1m"`
+}
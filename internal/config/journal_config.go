@@ -0,0 +1,8 @@
+package config
+
+type JournalConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path" env-default:"journal.jsonl"`
+	// fsync every record, a call is then durable before it runs
+	Sync bool `yaml:"sync"`
+}
@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+type LocksConfig struct {
+	Lease        time.Duration `yaml:"lease" env-default:"30s"`
+	MaxWait      time.Duration `yaml:"max_wait" env-default:"30s"`
+	ReapInterval time.Duration `yaml:"reap_interval" env-default:"10s"`
+}
@@ -0,0 +1,9 @@
+package config
+
+type NinePConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address" env-default:":5640"`
+	// Upper bound for negotiated message size
+	MaxMessageSize uint32 `yaml:"max_message_size" env-default:"1048576"`
+	MaxInFlight    int    `yaml:"max_in_flight" env-default:"64"`
+}
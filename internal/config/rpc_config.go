@@ -0,0 +1,10 @@
+package config
+
+type RPCConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// tcp or unix
+	Network      string `yaml:"network" env-default:"tcp"`
+	Address      string `yaml:"address" env-default:":8083"`
+	MaxFrameSize uint32 `yaml:"max_frame_size" env-default:"16777216"`
+	MaxInFlight  int    `yaml:"max_in_flight" env-default:"64"`
+}
@@ -0,0 +1,12 @@
+package config
+
+type SFTPConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address" env-default:":2022"`
+	// Created with a new ed25519 key if missing, empty means a new key on every start
+	HostKeyPath string `yaml:"host_key_path"`
+	// OpenSSH authorized_keys file, required unless AllowUnauthenticated is set
+	AuthorizedKeysPath string `yaml:"authorized_keys_path"`
+	// Without authorized keys accept any client and use SSH user as token
+	AllowUnauthenticated bool `yaml:"allow_unauthenticated"`
+}
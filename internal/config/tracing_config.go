@@ -0,0 +1,10 @@
+package config
+
+type TracingConfig struct {
+	// none, stdout, file or otlp
+	Exporter    string  `yaml:"exporter" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint"`  // OTLP/HTTP collector, e.g. localhost:4318
+	FilePath    string  `yaml:"file_path"` // for file exporter
+	ServiceName string  `yaml:"service_name" env-default:"vtfs-server"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+}
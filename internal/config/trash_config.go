@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+// Trash is switched on per filesystem, see PUT /v1/trash/{token}
+type TrashConfig struct {
+	TTL           time.Duration `yaml:"ttl" env-default:"168h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"10m"`
+}
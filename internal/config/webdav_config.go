@@ -0,0 +1,6 @@
+package config
+
+type WebDAVConfig struct {
+	// Serve filesystems at /dav/{token}/
+	Enabled bool `yaml:"enabled" env-default:"true"`
+}
@@ -0,0 +1,286 @@
+package dav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"golang.org/x/net/webdav"
+)
+
+// Permissions requested by WebDAV (0777 for MKCOL, 0666 for PUT) are masked
+// like a shell with the default umask would do
+const umask = 0o022
+
+// fileSystem implements webdav.FileSystem for one token
+type fileSystem struct {
+	service service.FileSystemService
+	token   string
+}
+
+func (fsys *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	parent, base, err := fsys.resolveParent(ctx, name)
+	if err != nil {
+		return service.PathError("mkdir", name, err)
+	}
+
+	_, err = fsys.service.CreateDir(ctx, fsys.token, parent.Ino, base, uint32(perm.Perm()&^umask))
+	return service.PathError("mkdir", name, err)
+}
+
+func (fsys *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	meta, err := fsys.service.ResolvePath(ctx, fsys.token, name)
+	switch {
+	case service.ErrorCode(err) == kerrors.ENOENT && flag&os.O_CREATE != 0:
+		parent, base, err := fsys.resolveParent(ctx, name)
+		if err != nil {
+			return nil, service.PathError("open", name, err)
+		}
+		meta, err = fsys.service.CreateFile(ctx, fsys.token, parent.Ino, base, uint32(perm.Perm()&^umask))
+		if err != nil {
+			return nil, service.PathError("open", name, err)
+		}
+	case err != nil:
+		return nil, service.PathError("open", name, err)
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, service.PathError("open", name, &service.ServiceError{Code: kerrors.EEXIST, Message: "file exists"})
+	}
+
+	f := &file{fsys: fsys, ctx: ctx, name: name, meta: meta}
+	if meta.Type == models.NodeTypeDir {
+		return f, nil
+	}
+
+	if flag&os.O_TRUNC != 0 {
+		if err := fsys.service.Truncate(ctx, fsys.token, meta.Ino, 0); err != nil {
+			return nil, service.PathError("open", name, err)
+		}
+		meta.Size = 0
+	}
+
+	// Keep the inode alive if it is unlinked while the transfer is running
+	f.fh, err = fsys.service.Open(ctx, fsys.token, meta.Ino)
+	if err != nil {
+		return nil, service.PathError("open", name, err)
+	}
+
+	return f, nil
+}
+
+func (fsys *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	parent, base, err := fsys.resolveParent(ctx, name)
+	if err != nil {
+		return service.PathError("remove", name, err)
+	}
+
+	err = fsys.remove(ctx, parent.Ino, base)
+	if service.ErrorCode(err) == kerrors.ENOENT {
+		return nil
+	}
+	return service.PathError("remove", name, err)
+}
+
+func (fsys *fileSystem) remove(ctx context.Context, parentIno int64, name string) error {
+	meta, err := fsys.service.Lookup(ctx, fsys.token, parentIno, name)
+	if err != nil {
+		return err
+	}
+
+	if meta.Type != models.NodeTypeDir {
+		return fsys.service.Unlink(ctx, fsys.token, parentIno, name)
+	}
+
+	// Entries are removed one by one, so the offset stays at zero
+	for {
+		var offset uint64
+		dirent, err := fsys.service.IterateDir(ctx, fsys.token, meta.Ino, &offset)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := fsys.remove(ctx, meta.Ino, dirent.Name); err != nil {
+			return err
+		}
+	}
+
+	return fsys.service.Rmdir(ctx, fsys.token, parentIno, name)
+}
+
+func (fsys *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldParent, oldBase, err := fsys.resolveParent(ctx, oldName)
+	if err != nil {
+		return service.PathError("rename", oldName, err)
+	}
+
+	newParent, newBase, err := fsys.resolveParent(ctx, newName)
+	if err != nil {
+		return service.PathError("rename", newName, err)
+	}
+
+	err = fsys.service.Rename(ctx, fsys.token, oldParent.Ino, oldBase, newParent.Ino, newBase)
+	return service.PathError("rename", oldName, err)
+}
+
+func (fsys *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	meta, err := fsys.service.ResolvePath(ctx, fsys.token, name)
+	if err != nil {
+		return nil, service.PathError("stat", name, err)
+	}
+
+	return newFileInfo(path.Base(name), meta), nil
+}
+
+// resolveParent resolves directory containing name and returns it with the last path component
+func (fsys *fileSystem) resolveParent(ctx context.Context, name string) (*models.NodeMeta, string, error) {
+	names := service.SplitPath(name)
+	if len(names) == 0 {
+		return nil, "", &service.ServiceError{Code: kerrors.EPERM, Message: "operation not permitted on root"}
+	}
+
+	parent, err := fsys.service.ResolvePath(ctx, fsys.token, strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return parent, names[len(names)-1], nil
+}
+
+// file implements webdav.File. Reads and writes go straight to the service
+// at the current offset, nothing is buffered
+type file struct {
+	fsys *fileSystem
+	// Context of the request that opened the file
+	ctx  context.Context
+	name string
+	meta *models.NodeMeta
+	// Handle from service.Open, zero for directories
+	fh     int64
+	offset int64
+	// IterateDir cursor for Readdir
+	dirOffset uint64
+}
+
+func (f *file) Close() error {
+	if f.fh == 0 {
+		return nil
+	}
+	return service.PathError("close", f.name, f.fsys.service.Release(f.ctx, f.fsys.token, f.fh))
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.meta.Type == models.NodeTypeDir {
+		return 0, service.PathError("read", f.name, &service.ServiceError{Code: kerrors.EISDIR, Message: "is a directory"})
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := f.fsys.service.Read(f.ctx, f.fsys.token, f.meta.Ino, p, f.offset)
+	if err != nil {
+		return 0, service.PathError("read", f.name, err)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	f.offset += n
+	return int(n), nil
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if f.meta.Type == models.NodeTypeDir {
+		return 0, service.PathError("write", f.name, &service.ServiceError{Code: kerrors.EISDIR, Message: "is a directory"})
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := f.fsys.service.Write(f.ctx, f.fsys.token, f.meta.Ino, p, uint64(len(p)), f.offset)
+	if err != nil {
+		return 0, service.PathError("write", f.name, err)
+	}
+
+	f.offset += n
+	f.meta.Size = max(f.meta.Size, f.offset)
+	return int(n), nil
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.meta.Size
+	default:
+		return 0, service.PathError("seek", f.name, &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid whence"})
+	}
+
+	if offset < 0 {
+		return 0, service.PathError("seek", f.name, &service.ServiceError{Code: kerrors.EINVAL, Message: "negative offset"})
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	if f.meta.Type != models.NodeTypeDir {
+		return nil, service.PathError("readdir", f.name, &service.ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"})
+	}
+
+	var infos []fs.FileInfo
+	for count <= 0 || len(infos) < count {
+		dirent, err := f.fsys.service.IterateDir(f.ctx, f.fsys.token, f.meta.Ino, &f.dirOffset)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			break
+		}
+		if err != nil {
+			return infos, service.PathError("readdir", f.name, err)
+		}
+
+		meta, err := f.fsys.service.Lookup(f.ctx, f.fsys.token, f.meta.Ino, dirent.Name)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			// Removed between IterateDir and Lookup
+			continue
+		}
+		if err != nil {
+			return infos, service.PathError("readdir", f.name, err)
+		}
+
+		infos = append(infos, newFileInfo(dirent.Name, meta))
+	}
+
+	if count > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+	return infos, nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return newFileInfo(path.Base(f.name), f.meta), nil
+}
+
+// fileInfo replaces the default modtime-based ETag, which would be
+// constant here since modification time is not tracked
+type fileInfo struct {
+	*service.FileInfo
+}
+
+func newFileInfo(name string, meta *models.NodeMeta) fs.FileInfo {
+	return fileInfo{service.NewFileInfo(name, meta)}
+}
+
+func (fi fileInfo) ETag(ctx context.Context) (string, error) {
+	meta := fi.Sys().(*models.NodeMeta)
+	return fmt.Sprintf(`"%x-%x"`, meta.Ino, meta.Size), nil
+}
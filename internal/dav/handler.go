@@ -0,0 +1,84 @@
+package dav
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+	"golang.org/x/net/webdav"
+)
+
+// Handler serves every filesystem as a WebDAV collection at /dav/{token}/.
+// Requests are translated to FileSystemService calls, so changes are
+// visible through the kernel module and other frontends right away
+type Handler struct {
+	service service.FileSystemService
+
+	mu sync.Mutex
+	// WebDAV locks are keyed by path, so every token gets its own lock system
+	locks map[string]webdav.LockSystem
+}
+
+func NewHandler(service service.FileSystemService) *Handler {
+	return &Handler{
+		service: service,
+		locks:   make(map[string]webdav.LockSystem),
+	}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/dav/{token}", h)
+	mux.Handle("/dav/{token}/{path...}", h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+
+	// File transfers may outlive the server timeouts, their size is bounded
+	// by app.max_body_size and app.max_file_size instead
+	if r.Method == http.MethodGet || r.Method == http.MethodPut {
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+
+	dav := &webdav.Handler{
+		Prefix:     "/dav/" + token,
+		FileSystem: &fileSystem{service: h.service, token: token},
+		LockSystem: h.lockSystem(token),
+		Logger:     logRequest,
+	}
+	dav.ServeHTTP(w, r)
+}
+
+func (h *Handler) lockSystem(token string) webdav.LockSystem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ls, ok := h.locks[token]
+	if !ok {
+		ls = webdav.NewMemLS()
+		h.locks[token] = ls
+	}
+	return ls
+}
+
+func logRequest(r *http.Request, err error) {
+	const op = "dav.Handler.ServeHTTP"
+
+	logger := logging.GetLoggerFromContextWithOp(r.Context(), op)
+	if err != nil {
+		logger.Debug("WebDAV request failed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slogext.Err(err),
+		)
+		return
+	}
+
+	logger.Debug("WebDAV request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+}
@@ -0,0 +1,110 @@
+package dav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/service/servicetest"
+)
+
+type testServer struct {
+	t   *testing.T
+	url string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	NewHandler(servicetest.NewMemory()).RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return &testServer{t: t, url: srv.URL + "/dav/token"}
+}
+
+// do sends request to path under the filesystem root and returns status and body
+func (s *testServer) do(method string, path string, body string, header map[string]string) (int, string) {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.url+path, strings.NewReader(body))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func (s *testServer) expect(method string, path string, body string, header map[string]string, want int) string {
+	s.t.Helper()
+
+	status, data := s.do(method, path, body, header)
+	if status != want {
+		s.t.Fatalf("%s %s = %d, want %d: %s", method, path, status, want, data)
+	}
+	return data
+}
+
+func TestWebDAV(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect("MKCOL", "/dir", "", nil, http.StatusCreated)
+	s.expect(http.MethodPut, "/dir/a.txt", "hello, webdav", nil, http.StatusCreated)
+	if data := s.expect(http.MethodGet, "/dir/a.txt", "", nil, http.StatusOK); data != "hello, webdav" {
+		t.Fatalf("GET = %q", data)
+	}
+
+	// Overwrite with shorter content goes through OpenFile with O_TRUNC
+	s.expect(http.MethodPut, "/dir/a.txt", "short", nil, http.StatusCreated)
+	if data := s.expect(http.MethodGet, "/dir/a.txt", "", nil, http.StatusOK); data != "short" {
+		t.Fatalf("GET after overwrite = %q", data)
+	}
+
+	s.expect("COPY", "/dir/a.txt", "", map[string]string{"Destination": s.url + "/dir/b.txt"}, http.StatusCreated)
+	if data := s.expect(http.MethodGet, "/dir/b.txt", "", nil, http.StatusOK); data != "short" {
+		t.Fatalf("GET of copy = %q", data)
+	}
+
+	s.expect("MOVE", "/dir/b.txt", "", map[string]string{"Destination": s.url + "/c.txt"}, http.StatusCreated)
+	s.expect(http.MethodGet, "/dir/b.txt", "", nil, http.StatusNotFound)
+	if data := s.expect(http.MethodGet, "/c.txt", "", nil, http.StatusOK); data != "short" {
+		t.Fatalf("GET of moved file = %q", data)
+	}
+
+	listing := s.expect("PROPFIND", "/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	for _, href := range []string{"/dav/token/dir/", "/dav/token/c.txt"} {
+		if !strings.Contains(listing, href) {
+			t.Fatalf("PROPFIND misses %s: %s", href, listing)
+		}
+	}
+
+	// DELETE of a collection removes everything below it
+	s.expect("MKCOL", "/dir/sub", "", nil, http.StatusCreated)
+	s.expect(http.MethodPut, "/dir/sub/d.txt", "nested", nil, http.StatusCreated)
+	s.expect(http.MethodDelete, "/dir", "", nil, http.StatusNoContent)
+	for _, path := range []string{"/dir", "/dir/a.txt", "/dir/sub/d.txt"} {
+		s.expect("PROPFIND", path, "", map[string]string{"Depth": "0"}, http.StatusNotFound)
+	}
+
+	s.expect(http.MethodDelete, "/c.txt", "", nil, http.StatusNoContent)
+	listing = s.expect("PROPFIND", "/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	if strings.Contains(listing, "c.txt") || strings.Contains(listing, "/dav/token/dir/") {
+		t.Fatalf("PROPFIND after DELETE: %s", listing)
+	}
+}
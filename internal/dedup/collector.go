@@ -0,0 +1,63 @@
+// Package dedup deletes content chunks no file refers to anymore and
+// reports how much storage sharing chunks saves, see /admin/dedup
+package dedup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Collector deletes unreferenced chunks in batches, so one run doesn't hold
+// locks on a large part of the chunks table
+type Collector struct {
+	repo     repository.ChunkRepository
+	batch    int
+	interval time.Duration
+}
+
+func NewCollector(repo repository.ChunkRepository, batch int, interval time.Duration) *Collector {
+	return &Collector{repo: repo, batch: batch, interval: interval}
+}
+
+// Run blocks until ctx is cancelled
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.collect(ctx)
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context) {
+	const op = "dedup.Collector.collect"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := c.repo.DeleteUnreferenced(ctx, c.batch)
+		if err != nil {
+			logger.Error("Failed to delete unreferenced chunks", slogext.Err(err))
+			break
+		}
+		total += deleted
+		if deleted < int64(c.batch) {
+			break
+		}
+	}
+
+	if total > 0 {
+		logger.Info("Deleted unreferenced chunks", slog.Int64("deleted", total))
+	}
+}
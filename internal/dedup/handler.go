@@ -0,0 +1,48 @@
+package dedup
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Handler serves the dedup report:
+//
+//	GET /admin/dedup
+//
+// The report scans all chunks, it is meant for occasional checks
+type Handler struct {
+	repo repository.ChunkRepository
+}
+
+func NewHandler(repo repository.ChunkRepository) *Handler {
+	return &Handler{repo: repo}
+}
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/dedup", h.HandleReport)
+}
+
+func (h *Handler) HandleReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "dedup.Handler.HandleReport"
+
+	report, err := h.repo.Report(ctx)
+	if err != nil {
+		logger := logging.GetLoggerFromContextWithOp(ctx, op)
+		logger.Error("Failed to build dedup report", slogext.Err(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
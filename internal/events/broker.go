@@ -0,0 +1,88 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+type Publisher interface {
+	Publish(event models.Event)
+}
+
+// Broker fans out filesystem events to subscribers of a token.
+// Publish never blocks: subscriber that cannot keep up gets its channel
+// closed and is expected to resubscribe (and drop whatever it cached)
+type Broker struct {
+	mu         sync.Mutex
+	seq        uint64
+	subs       map[string]map[*subscription]struct{}
+	bufferSize int
+}
+
+type subscription struct {
+	ch chan models.Event
+}
+
+func NewBroker(bufferSize int) *Broker {
+	return &Broker{
+		subs:       make(map[string]map[*subscription]struct{}),
+		bufferSize: bufferSize,
+	}
+}
+
+func (b *Broker) Publish(event models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.Seq = b.seq
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for sub := range b.subs[event.Token] {
+		select {
+		case sub.ch <- event:
+		default:
+			b.removeLocked(event.Token, sub)
+		}
+	}
+}
+
+// Subscribe returns channel of events for token and function that cancels subscription
+func (b *Broker) Subscribe(token string) (<-chan models.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{ch: make(chan models.Event, b.bufferSize)}
+	if b.subs[token] == nil {
+		b.subs[token] = make(map[*subscription]struct{})
+	}
+	b.subs[token][sub] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.removeLocked(token, sub)
+	}
+
+	return sub.ch, cancel
+}
+
+func (b *Broker) removeLocked(token string, sub *subscription) {
+	subs, ok := b.subs[token]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	close(sub.ch)
+	if len(subs) == 0 {
+		delete(b.subs, token)
+	}
+}
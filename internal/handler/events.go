@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// HandleEvents streams filesystem changes of a token as Server-Sent Events.
+// Stream is closed by the server if the client falls behind; client should
+// reconnect and treat everything it cached as stale
+func (h *Handler) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleEvents"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Stream lives longer than the server write timeout
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	events, cancel := h.broker.Subscribe(token)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logger.Warn("Streaming is not supported", slogext.Err(err))
+		return
+	}
+
+	logger.Debug("Subscribed to events", slog.String("token", token), slog.String("remote_addr", r.RemoteAddr))
+
+	heartbeat := time.NewTicker(h.eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("Client disconnected", slog.String("token", token))
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				logger.Warn("Subscriber is too slow, closing stream", slog.String("token", token))
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/S1riyS/os-course-lab-4/server/internal/events"
+	"github.com/S1riyS/os-course-lab-4/server/internal/lock"
 	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
 	"github.com/S1riyS/os-course-lab-4/server/internal/service"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
@@ -14,11 +17,27 @@ import (
 )
 
 type Handler struct {
-	service service.FileSystemService
+	service         service.FileSystemService
+	locks           *lock.Manager
+	broker          *events.Broker
+	eventsHeartbeat time.Duration
+	maxReadSize     int
 }
 
-func NewHandler(service service.FileSystemService) *Handler {
-	return &Handler{service: service}
+func NewHandler(
+	service service.FileSystemService,
+	locks *lock.Manager,
+	broker *events.Broker,
+	eventsHeartbeat time.Duration,
+	maxReadSize int,
+) *Handler {
+	return &Handler{
+		service:         service,
+		locks:           locks,
+		broker:          broker,
+		eventsHeartbeat: eventsHeartbeat,
+		maxReadSize:     maxReadSize,
+	}
 }
 
 func (h *Handler) HandleInit(w http.ResponseWriter, r *http.Request) {
@@ -54,6 +73,12 @@ func (h *Handler) HandleGetRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
@@ -67,7 +92,7 @@ func (h *Handler) HandleGetRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := binary.EncodeNodeMeta(meta)
+	data, err := binary.EncodeNodeMetaVersion(version, meta)
 	if err != nil {
 		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
 		return
@@ -85,6 +110,12 @@ func (h *Handler) HandleLookup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	parentStr := r.URL.Query().Get("parent")
 	name := r.URL.Query().Get("name")
@@ -107,7 +138,46 @@ func (h *Handler) HandleLookup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := binary.EncodeNodeMeta(meta)
+	data, err := binary.EncodeNodeMetaVersion(version, meta)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, data)
+}
+
+func (h *Handler) HandleResolve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleResolve"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	path := r.URL.Query().Get("path")
+
+	if token == "" || path == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	meta, err := h.service.ResolvePath(ctx, token, path)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	data, err := binary.EncodeNodeMetaVersion(version, meta)
 	if err != nil {
 		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
 		return
@@ -125,6 +195,12 @@ func (h *Handler) HandleIterateDir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	dirInoStr := r.URL.Query().Get("dir_ino")
 	offsetStr := r.URL.Query().Get("offset")
@@ -153,7 +229,7 @@ func (h *Handler) HandleIterateDir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := binary.EncodeDirent(dirent)
+	data, err := binary.EncodeDirentVersion(version, dirent)
 	if err != nil {
 		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
 		return
@@ -171,6 +247,12 @@ func (h *Handler) HandleCreateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	parentStr := r.URL.Query().Get("parent")
 	name := r.URL.Query().Get("name")
@@ -200,7 +282,7 @@ func (h *Handler) HandleCreateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := binary.EncodeNodeMeta(meta)
+	data, err := binary.EncodeNodeMetaVersion(version, meta)
 	if err != nil {
 		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
 		return
@@ -252,6 +334,12 @@ func (h *Handler) HandleMkdir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := protocolVersion(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	parentStr := r.URL.Query().Get("parent")
 	name := r.URL.Query().Get("name")
@@ -281,7 +369,7 @@ func (h *Handler) HandleMkdir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := binary.EncodeNodeMeta(meta)
+	data, err := binary.EncodeNodeMetaVersion(version, meta)
 	if err != nil {
 		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
 		return
@@ -361,6 +449,14 @@ func (h *Handler) HandleRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Length comes straight from the client and sizes the buffer, so it is
+	// bounded. It is refused rather than served short, since the kernel
+	// module takes a short read for end of file
+	if length > uint64(h.maxReadSize) {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
 	buffer := make([]byte, length)
 	read, err := h.service.Read(ctx, token, ino, buffer, offset)
 	if err != nil {
@@ -550,6 +646,156 @@ func (h *Handler) HandleCountLinks(w http.ResponseWriter, r *http.Request) {
 	binary.WriteUint32Response(w, 0, count)
 }
 
+func (h *Handler) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleOpen"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	inoStr := r.URL.Query().Get("ino")
+
+	if token == "" || inoStr == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	ino, err := strconv.ParseInt(inoStr, 10, 64)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	fh, err := h.service.Open(ctx, token, ino)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteInt64Response(w, 0, fh)
+}
+
+func (h *Handler) HandleRenew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRenew"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	fhStr := r.URL.Query().Get("fh")
+
+	if token == "" || fhStr == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	fh, err := strconv.ParseInt(fhStr, 10, 64)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	err = h.service.Renew(ctx, token, fh)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, nil)
+}
+
+func (h *Handler) HandleRelease(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRelease"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	fhStr := r.URL.Query().Get("fh")
+
+	if token == "" || fhStr == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	fh, err := strconv.ParseInt(fhStr, 10, 64)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	err = h.service.Release(ctx, token, fh)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, nil)
+}
+
+// HandleHello negotiates protocol version. Client sends the highest version it
+// speaks and its feature bits, server replies with the version to use and the
+// features it supports. Later requests pass the version in "proto" query
+// parameter or X-VTFS-Protocol header
+func (h *Handler) HandleHello(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleHello"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versionStr := r.URL.Query().Get("version")
+	if versionStr == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	clientVersion, err := strconv.ParseUint(versionStr, 10, 32)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	var clientFeatures uint64
+	if featuresStr := r.URL.Query().Get("features"); featuresStr != "" {
+		clientFeatures, err = strconv.ParseUint(featuresStr, 10, 64)
+		if err != nil {
+			binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+			return
+		}
+	}
+
+	version, ok := binary.NegotiateVersion(uint32(clientVersion))
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	logger.Debug("Protocol negotiated",
+		slog.Uint64("client_version", clientVersion),
+		slog.Uint64("client_features", clientFeatures),
+		slog.Uint64("version", uint64(version)),
+	)
+
+	binary.WriteResponse(w, 0, binary.EncodeHello(version))
+}
+
 func (h *Handler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -559,9 +805,23 @@ func (h *Handler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func mapErrorToCode(err error) int64 {
-	if serviceErr, ok := err.(*service.ServiceError); ok {
-		return serviceErr.Code
+	return service.ErrorCode(err)
+}
+
+// protocolVersion returns wire format version requested by client (v1 if not specified)
+func protocolVersion(r *http.Request) (uint32, bool) {
+	versionStr := r.URL.Query().Get("proto")
+	if versionStr == "" {
+		versionStr = r.Header.Get("X-VTFS-Protocol")
+	}
+	if versionStr == "" {
+		return binary.ProtocolV1, true
 	}
-	// По умолчанию возвращаем ENOMEM
-	return kerrors.ENOMEM_NEG
+
+	version, err := strconv.ParseUint(versionStr, 10, 32)
+	if err != nil || version < uint64(binary.ProtocolV1) || version > uint64(binary.ProtocolLatest) {
+		return 0, false
+	}
+
+	return uint32(version), true
 }
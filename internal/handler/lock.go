@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+func (h *Handler) HandleLock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleLock"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ino, req, ok := parseLockRequest(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	wait := r.URL.Query().Get("wait") == "1"
+
+	var timeout time.Duration
+	if timeoutStr := r.URL.Query().Get("timeout_ms"); timeoutStr != "" {
+		timeoutMs, err := strconv.ParseUint(timeoutStr, 10, 32)
+		if err != nil {
+			binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+			return
+		}
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+
+	if wait {
+		// Long-poll may outlive the server write timeout, lock manager bounds the wait itself
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+
+	err := h.locks.Lock(ctx, token, ino, req, wait, timeout)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, nil)
+}
+
+func (h *Handler) HandleUnlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleUnlock"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ino, req, ok := parseLockRequest(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	err := h.locks.Unlock(ctx, token, ino, req)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, nil)
+}
+
+func (h *Handler) HandleGetLk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleGetLk"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ino, req, ok := parseLockRequest(r)
+	if !ok {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	lock, err := h.locks.GetLk(ctx, token, ino, req)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	data, err := binary.EncodeFileLock(lock)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.ENOMEM_NEG, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, data)
+}
+
+// HandleLockRenew is the heartbeat of lock owners: locks not renewed for
+// locks.lease are dropped
+func (h *Handler) HandleLockRenew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleLockRenew"
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	ownerStr := r.URL.Query().Get("owner")
+
+	if token == "" || ownerStr == "" {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	owner, err := strconv.ParseUint(ownerStr, 10, 64)
+	if err != nil {
+		binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+		return
+	}
+
+	err = h.locks.Renew(ctx, token, owner)
+	if err != nil {
+		code := mapErrorToCode(err)
+		binary.WriteResponse(w, code, nil)
+		return
+	}
+
+	binary.WriteResponse(w, 0, nil)
+}
+
+// parseLockRequest reads token, ino, owner, kind, type, start and len query parameters.
+// type is optional for unlock, start and len default to the whole file
+func parseLockRequest(r *http.Request) (string, int64, models.FileLock, bool) {
+	query := r.URL.Query()
+
+	token := query.Get("token")
+	inoStr := query.Get("ino")
+	ownerStr := query.Get("owner")
+	kindStr := query.Get("kind")
+
+	if token == "" || inoStr == "" || ownerStr == "" || kindStr == "" {
+		return "", 0, models.FileLock{}, false
+	}
+
+	ino, err := strconv.ParseInt(inoStr, 10, 64)
+	if err != nil {
+		return "", 0, models.FileLock{}, false
+	}
+
+	owner, err := strconv.ParseUint(ownerStr, 10, 64)
+	if err != nil {
+		return "", 0, models.FileLock{}, false
+	}
+
+	kind, err := strconv.ParseInt(kindStr, 10, 16)
+	if err != nil {
+		return "", 0, models.FileLock{}, false
+	}
+
+	req := models.FileLock{
+		Type:  models.LockTypeUnlock,
+		Kind:  models.LockKind(kind),
+		Owner: owner,
+	}
+
+	if typeStr := query.Get("type"); typeStr != "" {
+		typ, err := strconv.ParseInt(typeStr, 10, 16)
+		if err != nil {
+			return "", 0, models.FileLock{}, false
+		}
+		req.Type = models.LockType(typ)
+	}
+
+	if startStr := query.Get("start"); startStr != "" {
+		req.Start, err = strconv.ParseInt(startStr, 10, 64)
+		if err != nil {
+			return "", 0, models.FileLock{}, false
+		}
+	}
+
+	if lenStr := query.Get("len"); lenStr != "" {
+		req.Len, err = strconv.ParseInt(lenStr, 10, 64)
+		if err != nil {
+			return "", 0, models.FileLock{}, false
+		}
+	}
+
+	return token, ino, req, true
+}
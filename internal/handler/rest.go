@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// REST API is a path-addressed JSON counterpart of /api/*, meant for
+// scripts, debugging and operators. It calls the same FileSystemService:
+//
+//	POST   /v1/fs/{token}                                 create filesystem
+//	GET    /v1/fs/{token}/{path...}                       file content (Range supported) or directory listing
+//	GET    /v1/fs/{token}/{path...}?stat                  node metadata
+//	PUT    /v1/fs/{token}/{path...}?mode=644              create or replace file with request body
+//	POST   /v1/fs/{token}/{path...}?op=mkdir&mode=755     create directory
+//	POST   /v1/fs/{token}/{path...}?op=link&target=/a/b   create hard link to target
+//	DELETE /v1/fs/{token}/{path...}                       unlink file or remove empty directory
+//
+// Trash and version history endpoints are described in trash.go and
+// versions.go
+//
+// Errors are returned as {"error": message, "errno": code} with HTTP status
+// derived from the errno
+const (
+	defaultFileMode uint32 = 0o644
+	defaultDirMode  uint32 = 0o755
+)
+
+type restStat struct {
+	models.NodeMeta
+	Nlink uint32 `json:"nlink"`
+}
+
+type restDir struct {
+	models.NodeMeta
+	Entries []models.Dirent `json:"entries"`
+}
+
+type restError struct {
+	Error string `json:"error"`
+	Errno int64  `json:"errno"`
+}
+
+func (h *Handler) HandleRestInit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRestInit"
+
+	token := r.PathValue("token")
+
+	if err := h.service.Init(ctx, token); err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	meta, err := h.service.GetRoot(ctx, token)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, meta)
+}
+
+func (h *Handler) HandleRestGet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRestGet"
+
+	token := r.PathValue("token")
+
+	meta, err := h.service.ResolvePath(ctx, token, r.PathValue("path"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	if r.URL.Query().Has("stat") {
+		nlink, err := h.service.CountLinks(ctx, token, meta.Ino)
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, restStat{NodeMeta: *meta, Nlink: nlink})
+		return
+	}
+
+	if r.URL.Query().Has("versions") {
+		h.serveVersions(w, r, op, token, meta.Ino)
+		return
+	}
+	if r.URL.Query().Has("version") {
+		h.serveVersion(w, r, op, token, meta.Ino)
+		return
+	}
+
+	if meta.Type == models.NodeTypeDir {
+		entries, err := h.listDir(r, token, meta.Ino)
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, restDir{NodeMeta: *meta, Entries: entries})
+		return
+	}
+
+	// ServeContent handles Range and If-Range and streams the file chunk by
+	// chunk. Errors after the headers are sent can only cut the body short
+	clearDeadlines(w)
+	reader := service.NewReader(ctx, h.service, token, meta.Ino, meta.Size, h.maxReadSize)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", time.Time{}, reader)
+}
+
+func (h *Handler) HandleRestPut(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRestPut"
+
+	token := r.PathValue("token")
+
+	mode, err := parseMode(r, defaultFileMode)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	clearDeadlines(w)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		message := "failed to read request body"
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			message = "request body too large"
+		}
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EINVAL, Message: message})
+		return
+	}
+
+	parent, name, err := h.resolveParent(r, token, r.PathValue("path"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	status := http.StatusOK
+	meta, err := h.service.Lookup(ctx, token, parent.Ino, name)
+	if service.ErrorCode(err) == kerrors.ENOENT {
+		meta, err = h.service.CreateFile(ctx, token, parent.Ino, name, mode)
+		status = http.StatusCreated
+	}
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	if meta.Type != models.NodeTypeFile {
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EISDIR, Message: "is a directory"})
+		return
+	}
+
+	if err := h.service.ReplaceContent(ctx, token, meta.Ino, data); err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	meta.Size = int64(len(data))
+	writeJSON(w, status, meta)
+}
+
+func (h *Handler) HandleRestPost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRestPost"
+
+	token := r.PathValue("token")
+	query := r.URL.Query()
+
+	switch query.Get("op") {
+	case "mkdir":
+		mode, err := parseMode(r, defaultDirMode)
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		parent, name, err := h.resolveParent(r, token, r.PathValue("path"))
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		meta, err := h.service.CreateDir(ctx, token, parent.Ino, name, mode)
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, meta)
+
+	case "link":
+		target, err := h.service.ResolvePath(ctx, token, query.Get("target"))
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		parent, name, err := h.resolveParent(r, token, r.PathValue("path"))
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		if err := h.service.Link(ctx, token, target.Ino, parent.Ino, name); err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, target)
+
+	case "versioning":
+		h.setVersioning(w, r, op, token)
+
+	case "restore_version":
+		h.restoreVersion(w, r, op, token)
+
+	default:
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EINVAL, Message: "op must be mkdir, link, versioning or restore_version"})
+	}
+}
+
+func (h *Handler) HandleRestDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleRestDelete"
+
+	token := r.PathValue("token")
+
+	parent, name, err := h.resolveParent(r, token, r.PathValue("path"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	meta, err := h.service.Lookup(ctx, token, parent.Ino, name)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	if meta.Type == models.NodeTypeDir {
+		err = h.service.Rmdir(ctx, token, parent.Ino, name)
+	} else {
+		err = h.service.Unlink(ctx, token, parent.Ino, name)
+	}
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resolveParent resolves directory containing p and returns it with the last path component
+func (h *Handler) resolveParent(r *http.Request, token string, p string) (*models.NodeMeta, string, error) {
+	names := service.SplitPath(p)
+	if len(names) == 0 {
+		return nil, "", &service.ServiceError{Code: kerrors.EPERM, Message: "operation not permitted on root"}
+	}
+
+	parent, err := h.service.ResolvePath(r.Context(), token, strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if parent.Type != models.NodeTypeDir {
+		return nil, "", &service.ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"}
+	}
+
+	return parent, names[len(names)-1], nil
+}
+
+func (h *Handler) listDir(r *http.Request, token string, dirIno int64) ([]models.Dirent, error) {
+	entries := []models.Dirent{}
+
+	var offset uint64
+	for {
+		dirent, err := h.service.IterateDir(r.Context(), token, dirIno, &offset)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *dirent)
+	}
+}
+
+// parseMode reads octal mode query parameter
+func parseMode(r *http.Request, def uint32) (uint32, error) {
+	modeStr := r.URL.Query().Get("mode")
+	if modeStr == "" {
+		return def, nil
+	}
+
+	mode, err := strconv.ParseUint(modeStr, 8, 32)
+	if err != nil {
+		return 0, &service.ServiceError{Code: kerrors.EINVAL, Message: "mode must be octal"}
+	}
+
+	return uint32(mode), nil
+}
+
+// clearDeadlines lifts the server read and write timeouts for a file
+// transfer, which may take longer and is bounded by app.max_body_size and
+// app.max_file_size instead
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeRestError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	var serviceErr *service.ServiceError
+	if postgresql.IsConflict(err) {
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusServiceUnavailable, restError{Error: "concurrent update, try again", Errno: kerrors.EAGAIN})
+		return
+	}
+	if !errors.As(err, &serviceErr) {
+		logger := logging.GetLoggerFromContextWithOp(r.Context(), op)
+		logger.Error("Request failed", slogext.Err(err), slog.String("path", r.URL.Path))
+		writeJSON(w, http.StatusInternalServerError, restError{Error: "internal error", Errno: kerrors.ENOMEM})
+		return
+	}
+
+	errno := serviceErr.Code
+	if errno < 0 {
+		errno = -errno
+	}
+
+	writeJSON(w, httpStatus(errno), restError{Error: serviceErr.Message, Errno: errno})
+}
+
+// httpStatus maps errno to HTTP status code
+func httpStatus(errno int64) int {
+	switch errno {
+	case kerrors.ENOENT:
+		return http.StatusNotFound
+	case kerrors.EEXIST, kerrors.ENOTEMPTY:
+		return http.StatusConflict
+	case kerrors.EPERM:
+		return http.StatusForbidden
+	case kerrors.EINVAL, kerrors.ENAMETOOLONG, kerrors.ENOTDIR, kerrors.EISDIR:
+		return http.StatusBadRequest
+	case kerrors.EFBIG:
+		return http.StatusRequestEntityTooLarge
+	case kerrors.EBADF:
+		return http.StatusGone
+	case kerrors.EAGAIN:
+		return http.StatusLocked
+	default:
+		return http.StatusInternalServerError
+	}
+}
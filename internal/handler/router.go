@@ -9,9 +9,11 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/health", h.HandleHealthCheck)
 
 	// API endpoints
+	mux.HandleFunc("/api/hello", h.HandleHello)
 	mux.HandleFunc("/api/init", h.HandleInit)
 	mux.HandleFunc("/api/get_root", h.HandleGetRoot)
 	mux.HandleFunc("/api/lookup", h.HandleLookup)
+	mux.HandleFunc("/api/resolve", h.HandleResolve)
 	mux.HandleFunc("/api/iterate_dir", h.HandleIterateDir)
 	mux.HandleFunc("/api/create_file", h.HandleCreateFile)
 	mux.HandleFunc("/api/unlink", h.HandleUnlink)
@@ -21,4 +23,23 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/write", h.HandleWrite)
 	mux.HandleFunc("/api/link", h.HandleLink)
 	mux.HandleFunc("/api/count_links", h.HandleCountLinks)
+	mux.HandleFunc("/api/open", h.HandleOpen)
+	mux.HandleFunc("/api/renew", h.HandleRenew)
+	mux.HandleFunc("/api/release", h.HandleRelease)
+	mux.HandleFunc("/api/lock", h.HandleLock)
+	mux.HandleFunc("/api/unlock", h.HandleUnlock)
+	mux.HandleFunc("/api/getlk", h.HandleGetLk)
+	mux.HandleFunc("/api/lock/renew", h.HandleLockRenew)
+	mux.HandleFunc("/api/events", h.HandleEvents)
+
+	// REST endpoints
+	mux.HandleFunc("POST /v1/fs/{token}", h.HandleRestInit)
+	mux.HandleFunc("GET /v1/fs/{token}", h.HandleRestGet)
+	mux.HandleFunc("GET /v1/fs/{token}/{path...}", h.HandleRestGet)
+	mux.HandleFunc("PUT /v1/fs/{token}/{path...}", h.HandleRestPut)
+	mux.HandleFunc("POST /v1/fs/{token}/{path...}", h.HandleRestPost)
+	mux.HandleFunc("DELETE /v1/fs/{token}/{path...}", h.HandleRestDelete)
+	mux.HandleFunc("PUT /v1/trash/{token}", h.HandleTrashSet)
+	mux.HandleFunc("GET /v1/trash/{token}", h.HandleTrashList)
+	mux.HandleFunc("POST /v1/trash/{token}/{id}", h.HandleTrashRestore)
 }
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+// Trash endpoints belong to the REST API:
+//
+//	PUT  /v1/trash/{token}?enabled=true          switch trash on or off
+//	GET  /v1/trash/{token}                       list trashed files
+//	POST /v1/trash/{token}/{id}?to=/dir&name=b   restore, by default to the original location
+//
+// Restore fails with ENOTDIR when the target directory is gone and with
+// EEXIST when the name is taken; pass to and/or name to pick another place
+type restTrashSetting struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (h *Handler) HandleTrashSet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleTrashSet"
+
+	token := r.PathValue("token")
+
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EINVAL, Message: "enabled must be true or false"})
+		return
+	}
+
+	if err := h.service.SetTrash(ctx, token, enabled); err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, restTrashSetting{Enabled: enabled})
+}
+
+func (h *Handler) HandleTrashList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleTrashList"
+
+	entries, err := h.service.ListTrash(ctx, r.PathValue("token"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (h *Handler) HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	const op = "handler.HandleTrashRestore"
+
+	token := r.PathValue("token")
+	query := r.URL.Query()
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid trash entry id"})
+		return
+	}
+
+	// Zero keeps the original directory
+	var parentIno int64
+	if to := query.Get("to"); to != "" {
+		parent, err := h.service.ResolvePath(ctx, token, to)
+		if err != nil {
+			writeRestError(w, r, op, err)
+			return
+		}
+		parentIno = parent.Ino
+	}
+
+	meta, err := h.service.RestoreTrash(ctx, token, id, parentIno, query.Get("name"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, meta)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+// Version history is part of the REST API:
+//
+//	POST /v1/fs/{token}/{path...}?op=versioning&keep=10       keep last 10 versions, 0 disables
+//	GET  /v1/fs/{token}/{path...}?versions                    list versions (JSON)
+//	GET  /v1/fs/{token}/{path...}?version=42                  content of version 42
+//	POST /v1/fs/{token}/{path...}?op=restore_version&version=42
+type restVersioning struct {
+	Keep int `json:"keep"`
+}
+
+func (h *Handler) serveVersions(w http.ResponseWriter, r *http.Request, op string, token string, ino int64) {
+	versions, err := h.service.ListVersions(r.Context(), token, ino)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+func (h *Handler) serveVersion(w http.ResponseWriter, r *http.Request, op string, token string, ino int64) {
+	version, err := parseVersion(r)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	data, err := h.service.ReadVersion(r.Context(), token, ino, version)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (h *Handler) setVersioning(w http.ResponseWriter, r *http.Request, op string, token string) {
+	keep, err := strconv.Atoi(r.URL.Query().Get("keep"))
+	if err != nil {
+		writeRestError(w, r, op, &service.ServiceError{Code: kerrors.EINVAL, Message: "keep must be a number"})
+		return
+	}
+
+	meta, err := h.service.ResolvePath(r.Context(), token, r.PathValue("path"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	if err := h.service.SetVersioning(r.Context(), token, meta.Ino, keep); err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, restVersioning{Keep: keep})
+}
+
+func (h *Handler) restoreVersion(w http.ResponseWriter, r *http.Request, op string, token string) {
+	version, err := parseVersion(r)
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	meta, err := h.service.ResolvePath(r.Context(), token, r.PathValue("path"))
+	if err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	if err := h.service.RestoreVersion(r.Context(), token, meta.Ino, version); err != nil {
+		writeRestError(w, r, op, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseVersion(r *http.Request) (int64, error) {
+	version, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, &service.ServiceError{Code: kerrors.EINVAL, Message: "version must be a positive number"}
+	}
+	return version, nil
+}
@@ -0,0 +1,210 @@
+// Package journal keeps an append-only record of mutating FileSystemService
+// calls. Every call is written before it runs, its outcome after, so a
+// crash leaves a call without outcome behind instead of no trace at all.
+// The journal can be replayed into an empty filesystem (see Replay)
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type Phase string
+
+const (
+	// Written before the call runs
+	PhaseCall Phase = "call"
+	// Written after the call returned, with the same Seq as its call
+	PhaseDone Phase = "done"
+)
+
+// Operation names match /api/* endpoints where there is one
+const (
+	OpInit           = "init"
+	OpCreateFile     = "create_file"
+	OpUnlink         = "unlink"
+	OpCreateDir      = "create_dir"
+	OpRmdir          = "rmdir"
+	OpWrite          = "write"
+	OpTruncate       = "truncate"
+	OpReplace        = "replace"
+	OpLink           = "link"
+	OpRename         = "rename"
+	OpSetTrash       = "set_trash"
+	OpRestoreTrash   = "restore_trash"
+	OpSetVersioning  = "set_versioning"
+	OpRestoreVersion = "restore_version"
+)
+
+type Entry struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Phase Phase     `json:"phase"`
+	Op    string    `json:"op"`
+	Token string    `json:"token"`
+	// Set in call records
+	Args *Args `json:"args,omitempty"`
+	// Set in done records: kernel error code (0 on success) and inode
+	// created by create_file and create_dir or restored by restore_trash
+	Code int64 `json:"code"`
+	Ino  int64 `json:"ino,omitempty"`
+}
+
+type Args struct {
+	Ino          int64  `json:"ino,omitempty"`
+	ParentIno    int64  `json:"parent_ino,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Mode         uint32 `json:"mode,omitempty"`
+	Offset       int64  `json:"offset,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Data         []byte `json:"data,omitempty"`
+	TargetIno    int64  `json:"target_ino,omitempty"`
+	NewParentIno int64  `json:"new_parent_ino,omitempty"`
+	NewName      string `json:"new_name,omitempty"`
+	Enabled      bool   `json:"enabled,omitempty"`
+	// Trash entry id, valid in the journaled filesystem only
+	TrashID int64 `json:"trash_id,omitempty"`
+	Keep    int   `json:"keep,omitempty"`
+	// Version id, valid in the journaled filesystem only
+	Version int64 `json:"version,omitempty"`
+}
+
+// Journal appends entries as JSON lines to a file. It is safe for
+// concurrent use
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	sync bool
+}
+
+// Open opens journal at path for appending, creating it if needed.
+// Sequence numbers continue from the last entry in the file. A record torn
+// by a crash at the end of the file is cut off. With sync every entry is
+// fsynced before Begin and End return
+func Open(path string, sync bool) (*Journal, error) {
+	const op = "journal.Open"
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var lastSeq uint64
+	dec := json.NewDecoder(file)
+	for {
+		var entry Entry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// Keep everything up to the last complete record
+			if err := file.Truncate(dec.InputOffset()); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: entry after offset %d: %w", op, dec.InputOffset(), err)
+		}
+		lastSeq = max(lastSeq, entry.Seq)
+	}
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Truncation may have eaten the newline of the last record
+	if end > 0 {
+		last := make([]byte, 1)
+		_, err := file.ReadAt(last, end-1)
+		if err == nil && last[0] != '\n' {
+			_, err = file.Write([]byte{'\n'})
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return &Journal{file: file, seq: lastSeq, sync: sync}, nil
+}
+
+// Begin records call and returns its sequence number. The call must not
+// run if Begin fails
+func (j *Journal) Begin(op string, token string, args Args) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq++
+	entry := Entry{Seq: j.seq, Time: time.Now(), Phase: PhaseCall, Op: op, Token: token, Args: &args}
+	if err := j.append(&entry); err != nil {
+		return 0, fmt.Errorf("journal.Begin: %w", err)
+	}
+	return entry.Seq, nil
+}
+
+// End records outcome of call seq
+func (j *Journal) End(seq uint64, op string, token string, code int64, ino int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := Entry{Seq: seq, Time: time.Now(), Phase: PhaseDone, Op: op, Token: token, Code: code, Ino: ino}
+	if err := j.append(&entry); err != nil {
+		return fmt.Errorf("journal.End: %w", err)
+	}
+	return nil
+}
+
+func (j *Journal) append(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if j.sync {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.file.Close()
+}
+
+// Read calls fn for every entry of journal r in file order
+func Read(r io.Reader, fn func(entry *Entry) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var entry Entry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// Torn record at the end is what a crash leaves behind
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return fmt.Errorf("journal.Read: entry after offset %d: %w", dec.InputOffset(), err)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+type ReplayOptions struct {
+	// Calls made on this token are replayed
+	Token string
+	// Token of the filesystem to rebuild, Token if empty. It must not exist
+	Into string
+	// Replay stops after the call with this sequence number, 0 means the whole journal
+	Until uint64
+	// Print each call instead of executing it. Service may be nil then
+	DryRun bool
+	// Receives a line per call, may be nil
+	Log func(format string, args ...any)
+}
+
+type ReplayStats struct {
+	// Calls executed (or printed in dry run)
+	Replayed int
+	// Calls that failed originally, they changed nothing and are skipped
+	Failed int
+	// Calls without outcome, interrupted by a crash. Whether they took
+	// effect is unknown, so they are skipped
+	Incomplete int
+}
+
+// Replay rebuilds filesystem opts.Token from the journal at path into a new
+// filesystem opts.Into. The journal must cover the filesystem from its
+// creation: inode numbers in calls are mapped to the ones allocated during
+// replay, and an inode the journal never created is an error.
+//
+// Calls are replayed in the order they started. Calls that overlapped in
+// time could have been applied by the database in the other order, which
+// only matters when they touched the same names
+func Replay(ctx context.Context, svc service.FileSystemService, path string, opts ReplayOptions) (ReplayStats, error) {
+	const op = "journal.Replay"
+
+	var stats ReplayStats
+	if opts.Into == "" {
+		opts.Into = opts.Token
+	}
+	logf := opts.Log
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+
+	// First pass: outcomes, the second one needs them when it meets a call
+	outcomes := make(map[uint64]*Entry)
+	err := readFile(path, func(entry *Entry) error {
+		if entry.Phase == PhaseDone && entry.Token == opts.Token {
+			outcomes[entry.Seq] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r := &replayer{
+		ctx:  ctx,
+		svc:  svc,
+		into: opts.Into,
+		inos: map[int64]int64{service.VTFS_ROOT_INO: service.VTFS_ROOT_INO},
+	}
+
+	if !opts.DryRun {
+		if err := svc.Init(ctx, opts.Into); err != nil {
+			return stats, fmt.Errorf("%s: init %q: %w", op, opts.Into, err)
+		}
+	}
+
+	err = readFile(path, func(call *Entry) error {
+		if call.Phase != PhaseCall || call.Token != opts.Token {
+			return nil
+		}
+		if opts.Until != 0 && call.Seq > opts.Until {
+			return errStop
+		}
+
+		outcome, ok := outcomes[call.Seq]
+		switch {
+		case !ok:
+			stats.Incomplete++
+			logf("%d %s: no outcome, skipped", call.Seq, describe(call))
+			return nil
+		case outcome.Code != 0:
+			stats.Failed++
+			logf("%d %s: failed with %d, skipped", call.Seq, describe(call), outcome.Code)
+			return nil
+		case call.Op == OpInit:
+			// Replay created the filesystem already
+			return nil
+		}
+
+		stats.Replayed++
+		logf("%d %s", call.Seq, describe(call))
+		if opts.DryRun {
+			return nil
+		}
+
+		if err := r.apply(call, outcome); err != nil {
+			return fmt.Errorf("seq %d %s: %w", call.Seq, describe(call), err)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return stats, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return stats, nil
+}
+
+// errStop ends the second pass once opts.Until is reached
+var errStop = errors.New("stop")
+
+func readFile(path string, fn func(entry *Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Read(file, fn)
+}
+
+type replayer struct {
+	ctx  context.Context
+	svc  service.FileSystemService
+	into string
+	// Original inode numbers to the ones allocated during replay
+	inos map[int64]int64
+}
+
+func (r *replayer) ino(original int64) (int64, error) {
+	ino, ok := r.inos[original]
+	if !ok {
+		return 0, fmt.Errorf("inode %d is not created by the journal, it must start from an empty filesystem", original)
+	}
+	return ino, nil
+}
+
+func (r *replayer) apply(call *Entry, outcome *Entry) error {
+	args := call.Args
+	if args == nil {
+		return fmt.Errorf("call record without arguments")
+	}
+
+	switch call.Op {
+	case OpCreateFile, OpCreateDir:
+		parent, err := r.ino(args.ParentIno)
+		if err != nil {
+			return err
+		}
+		create := r.svc.CreateFile
+		if call.Op == OpCreateDir {
+			create = r.svc.CreateDir
+		}
+		meta, err := create(r.ctx, r.into, parent, args.Name, args.Mode)
+		if err != nil {
+			return err
+		}
+		r.inos[outcome.Ino] = meta.Ino
+		return nil
+
+	case OpUnlink, OpRmdir:
+		parent, err := r.ino(args.ParentIno)
+		if err != nil {
+			return err
+		}
+		if call.Op == OpRmdir {
+			return r.svc.Rmdir(r.ctx, r.into, parent, args.Name)
+		}
+		return r.svc.Unlink(r.ctx, r.into, parent, args.Name)
+
+	case OpWrite:
+		ino, err := r.ino(args.Ino)
+		if err != nil {
+			return err
+		}
+		_, err = r.svc.Write(r.ctx, r.into, ino, args.Data, uint64(len(args.Data)), args.Offset)
+		return err
+
+	case OpTruncate:
+		ino, err := r.ino(args.Ino)
+		if err != nil {
+			return err
+		}
+		return r.svc.Truncate(r.ctx, r.into, ino, args.Size)
+
+	case OpReplace, OpRestoreVersion:
+		ino, err := r.ino(args.Ino)
+		if err != nil {
+			return err
+		}
+		return r.svc.ReplaceContent(r.ctx, r.into, ino, args.Data)
+
+	case OpLink:
+		target, err := r.ino(args.TargetIno)
+		if err != nil {
+			return err
+		}
+		parent, err := r.ino(args.ParentIno)
+		if err != nil {
+			return err
+		}
+		return r.svc.Link(r.ctx, r.into, target, parent, args.Name)
+
+	case OpRename:
+		oldParent, err := r.ino(args.ParentIno)
+		if err != nil {
+			return err
+		}
+		newParent, err := r.ino(args.NewParentIno)
+		if err != nil {
+			return err
+		}
+		return r.svc.Rename(r.ctx, r.into, oldParent, args.Name, newParent, args.NewName)
+
+	case OpSetTrash:
+		return r.svc.SetTrash(r.ctx, r.into, args.Enabled)
+
+	case OpRestoreTrash:
+		ino, err := r.ino(outcome.Ino)
+		if err != nil {
+			return err
+		}
+		id, err := r.trashID(ino)
+		if err != nil {
+			return err
+		}
+		// Zero parent restores to the original directory, it stays zero
+		parent := args.ParentIno
+		if parent != 0 {
+			if parent, err = r.ino(parent); err != nil {
+				return err
+			}
+		}
+		_, err = r.svc.RestoreTrash(r.ctx, r.into, id, parent, args.Name)
+		return err
+
+	case OpSetVersioning:
+		ino, err := r.ino(args.Ino)
+		if err != nil {
+			return err
+		}
+		return r.svc.SetVersioning(r.ctx, r.into, ino, args.Keep)
+
+	default:
+		return fmt.Errorf("unknown operation %q", call.Op)
+	}
+}
+
+// trashID finds the trash entry of ino, a file is in trash at most once
+func (r *replayer) trashID(ino int64) (int64, error) {
+	entries, err := r.svc.ListTrash(r.ctx, r.into)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.Ino == ino {
+			return entry.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("inode %d is not in trash", ino)
+}
+
+// describe formats call for logs, e.g. create_file(parent=1000, name="a", mode=0644)
+func describe(call *Entry) string {
+	args := call.Args
+	if args == nil {
+		return call.Op + "()"
+	}
+
+	switch call.Op {
+	case OpCreateFile, OpCreateDir:
+		return fmt.Sprintf("%s(parent=%d, name=%q, mode=%#o)", call.Op, args.ParentIno, args.Name, args.Mode)
+	case OpUnlink, OpRmdir:
+		return fmt.Sprintf("%s(parent=%d, name=%q)", call.Op, args.ParentIno, args.Name)
+	case OpWrite:
+		return fmt.Sprintf("%s(ino=%d, offset=%d, len=%d)", call.Op, args.Ino, args.Offset, len(args.Data))
+	case OpTruncate:
+		return fmt.Sprintf("%s(ino=%d, size=%d)", call.Op, args.Ino, args.Size)
+	case OpReplace:
+		return fmt.Sprintf("%s(ino=%d, len=%d)", call.Op, args.Ino, len(args.Data))
+	case OpSetVersioning:
+		return fmt.Sprintf("%s(ino=%d, keep=%d)", call.Op, args.Ino, args.Keep)
+	case OpRestoreVersion:
+		return fmt.Sprintf("%s(ino=%d, version=%d, len=%d)", call.Op, args.Ino, args.Version, len(args.Data))
+	case OpLink:
+		return fmt.Sprintf("%s(target=%d, parent=%d, name=%q)", call.Op, args.TargetIno, args.ParentIno, args.Name)
+	case OpRename:
+		return fmt.Sprintf("%s(parent=%d, name=%q, new_parent=%d, new_name=%q)",
+			call.Op, args.ParentIno, args.Name, args.NewParentIno, args.NewName)
+	case OpSetTrash:
+		return fmt.Sprintf("%s(enabled=%t)", call.Op, args.Enabled)
+	case OpRestoreTrash:
+		return fmt.Sprintf("%s(id=%d, parent=%d, name=%q)", call.Op, args.TrashID, args.ParentIno, args.Name)
+	default:
+		return call.Op + "()"
+	}
+}
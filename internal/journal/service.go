@@ -0,0 +1,169 @@
+package journal
+
+import (
+	"context"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// journaledService records mutating calls of next in the journal. Reads and
+// handle operations are passed through: they don't change the namespace or
+// contents
+type journaledService struct {
+	service.FileSystemService
+	journal *Journal
+}
+
+func NewJournaledService(next service.FileSystemService, journal *Journal) service.FileSystemService {
+	return &journaledService{FileSystemService: next, journal: journal}
+}
+
+// record runs call between its call and done records. Failing to write the
+// call record fails the operation, failing to write the outcome only logs
+func (s *journaledService) record(ctx context.Context, op string, token string, args Args, call func() (int64, error)) error {
+	seq, err := s.journal.Begin(op, token, args)
+	if err != nil {
+		return err
+	}
+
+	ino, err := call()
+
+	code := int64(0)
+	if err != nil {
+		code = service.ErrorCode(err)
+	}
+	if endErr := s.journal.End(seq, op, token, code, ino); endErr != nil {
+		logger := logging.GetLoggerFromContextWithOp(ctx, "journal.journaledService.record")
+		logger.Error("Failed to record outcome", slogext.Err(endErr), "seq", seq, "op", op)
+	}
+
+	return err
+}
+
+func (s *journaledService) Init(ctx context.Context, token string) error {
+	return s.record(ctx, OpInit, token, Args{}, func() (int64, error) {
+		return 0, s.FileSystemService.Init(ctx, token)
+	})
+}
+
+func (s *journaledService) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	var meta *models.NodeMeta
+	err := s.record(ctx, OpCreateFile, token, Args{ParentIno: parentIno, Name: name, Mode: mode}, func() (int64, error) {
+		var err error
+		meta, err = s.FileSystemService.CreateFile(ctx, token, parentIno, name, mode)
+		if err != nil {
+			return 0, err
+		}
+		return meta.Ino, nil
+	})
+	return meta, err
+}
+
+func (s *journaledService) Unlink(ctx context.Context, token string, parentIno int64, name string) error {
+	return s.record(ctx, OpUnlink, token, Args{ParentIno: parentIno, Name: name}, func() (int64, error) {
+		return 0, s.FileSystemService.Unlink(ctx, token, parentIno, name)
+	})
+}
+
+func (s *journaledService) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	var meta *models.NodeMeta
+	err := s.record(ctx, OpCreateDir, token, Args{ParentIno: parentIno, Name: name, Mode: mode}, func() (int64, error) {
+		var err error
+		meta, err = s.FileSystemService.CreateDir(ctx, token, parentIno, name, mode)
+		if err != nil {
+			return 0, err
+		}
+		return meta.Ino, nil
+	})
+	return meta, err
+}
+
+func (s *journaledService) Rmdir(ctx context.Context, token string, parentIno int64, name string) error {
+	return s.record(ctx, OpRmdir, token, Args{ParentIno: parentIno, Name: name}, func() (int64, error) {
+		return 0, s.FileSystemService.Rmdir(ctx, token, parentIno, name)
+	})
+}
+
+func (s *journaledService) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (int64, error) {
+	// Only bytes that can actually be written are recorded, the service
+	// rejects length beyond data anyway
+	recorded := data[:min(length, uint64(len(data)))]
+
+	var written int64
+	err := s.record(ctx, OpWrite, token, Args{Ino: ino, Offset: offset, Data: recorded}, func() (int64, error) {
+		var err error
+		written, err = s.FileSystemService.Write(ctx, token, ino, data, length, offset)
+		return 0, err
+	})
+	return written, err
+}
+
+func (s *journaledService) Truncate(ctx context.Context, token string, ino int64, size int64) error {
+	return s.record(ctx, OpTruncate, token, Args{Ino: ino, Size: size}, func() (int64, error) {
+		return 0, s.FileSystemService.Truncate(ctx, token, ino, size)
+	})
+}
+
+func (s *journaledService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error {
+	return s.record(ctx, OpReplace, token, Args{Ino: ino, Data: data}, func() (int64, error) {
+		return 0, s.FileSystemService.ReplaceContent(ctx, token, ino, data)
+	})
+}
+
+func (s *journaledService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error {
+	return s.record(ctx, OpLink, token, Args{TargetIno: targetIno, ParentIno: parentIno, Name: name}, func() (int64, error) {
+		return 0, s.FileSystemService.Link(ctx, token, targetIno, parentIno, name)
+	})
+}
+
+func (s *journaledService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error {
+	args := Args{ParentIno: oldParentIno, Name: oldName, NewParentIno: newParentIno, NewName: newName}
+	return s.record(ctx, OpRename, token, args, func() (int64, error) {
+		return 0, s.FileSystemService.Rename(ctx, token, oldParentIno, oldName, newParentIno, newName)
+	})
+}
+
+func (s *journaledService) SetTrash(ctx context.Context, token string, enabled bool) error {
+	return s.record(ctx, OpSetTrash, token, Args{Enabled: enabled}, func() (int64, error) {
+		return 0, s.FileSystemService.SetTrash(ctx, token, enabled)
+	})
+}
+
+// RestoreTrash records the restored inode: trash ids of the replayed
+// filesystem differ, the inode finds its entry there
+func (s *journaledService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error) {
+	var meta *models.NodeMeta
+	err := s.record(ctx, OpRestoreTrash, token, Args{TrashID: id, ParentIno: parentIno, Name: name}, func() (int64, error) {
+		var err error
+		meta, err = s.FileSystemService.RestoreTrash(ctx, token, id, parentIno, name)
+		if err != nil {
+			return 0, err
+		}
+		return meta.Ino, nil
+	})
+	return meta, err
+}
+
+func (s *journaledService) SetVersioning(ctx context.Context, token string, ino int64, keep int) error {
+	return s.record(ctx, OpSetVersioning, token, Args{Ino: ino, Keep: keep}, func() (int64, error) {
+		return 0, s.FileSystemService.SetVersioning(ctx, token, ino, keep)
+	})
+}
+
+// RestoreVersion records the content it restores: version ids of the
+// replayed filesystem differ, so replay writes the content instead.
+// Versions are never changed, what is read here is what the restore
+// writes; a version that can't be read can't be restored either
+func (s *journaledService) RestoreVersion(ctx context.Context, token string, ino int64, version int64) error {
+	data, err := s.FileSystemService.ReadVersion(ctx, token, ino, version)
+	if err != nil {
+		return err
+	}
+
+	return s.record(ctx, OpRestoreVersion, token, Args{Ino: ino, Version: version, Data: data}, func() (int64, error) {
+		return 0, s.FileSystemService.RestoreVersion(ctx, token, ino, version)
+	})
+}
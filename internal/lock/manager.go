@@ -0,0 +1,383 @@
+package lock
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+)
+
+// Manager keeps advisory locks in memory. flock and POSIX locks live in
+// separate namespaces (as in Linux) and never conflict with each other.
+// Every lock is held under a lease which is extended on each call made by
+// its owner, including Renew, which owners holding locks call periodically;
+// locks of owners that disappeared are dropped by Run.
+type Manager struct {
+	mu      sync.Mutex
+	files   map[fileKey]*fileLocks
+	lease   time.Duration
+	maxWait time.Duration
+}
+
+type fileKey struct {
+	token string
+	ino   int64
+}
+
+type fileLocks struct {
+	held []*heldLock
+	// closed and replaced on every change so that waiters can re-check
+	changed chan struct{}
+}
+
+type heldLock struct {
+	owner   uint64
+	kind    models.LockKind
+	typ     models.LockType
+	start   int64
+	end     int64 // inclusive
+	expires time.Time
+}
+
+func NewManager(lease time.Duration, maxWait time.Duration) *Manager {
+	return &Manager{
+		files:   make(map[fileKey]*fileLocks),
+		lease:   lease,
+		maxWait: maxWait,
+	}
+}
+
+// Lock acquires (or converts) a lock. If wait is set, it blocks until the lock
+// can be granted, ctx is done or timeout (capped by max wait) elapses
+func (m *Manager) Lock(ctx context.Context, token string, ino int64, req models.FileLock, wait bool, timeout time.Duration) error {
+	const op = "lock.Manager.Lock"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Lock",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Uint64("owner", req.Owner),
+		slog.Int("kind", int(req.Kind)),
+		slog.Int("type", int(req.Type)),
+		slog.Int64("start", req.Start),
+		slog.Int64("len", req.Len),
+		slog.Bool("wait", wait),
+	)
+
+	if req.Type == models.LockTypeUnlock {
+		return m.Unlock(ctx, token, ino, req)
+	}
+
+	start, end, err := lockRange(req)
+	if err != nil {
+		return err
+	}
+
+	if timeout <= 0 || timeout > m.maxWait {
+		timeout = m.maxWait
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	key := fileKey{token: token, ino: ino}
+	for {
+		m.mu.Lock()
+		fl := m.getFile(key)
+		if conflict := fl.findConflict(req.Owner, req.Kind, req.Type, start, end); conflict == nil {
+			fl.apply(req.Owner, req.Kind, req.Type, start, end, time.Now().Add(m.lease))
+			m.renewLocked(token, req.Owner)
+			m.mu.Unlock()
+
+			logger.Debug("Lock acquired", slog.Uint64("owner", req.Owner), slog.Int64("ino", ino))
+			return nil
+		}
+
+		m.renewLocked(token, req.Owner)
+		changed := fl.changed
+		m.mu.Unlock()
+
+		if !wait {
+			logger.Debug("Lock is held by another owner", slog.Uint64("owner", req.Owner), slog.Int64("ino", ino))
+			return &service.ServiceError{Code: kerrors.EAGAIN, Message: "lock is held by another owner"}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return &service.ServiceError{Code: kerrors.EAGAIN, Message: "lock wait cancelled"}
+		case <-timer.C:
+			logger.Debug("Lock wait timed out", slog.Uint64("owner", req.Owner), slog.Int64("ino", ino))
+			return &service.ServiceError{Code: kerrors.EAGAIN, Message: "lock wait timed out"}
+		}
+	}
+}
+
+func (m *Manager) Unlock(ctx context.Context, token string, ino int64, req models.FileLock) error {
+	const op = "lock.Manager.Unlock"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Unlock",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Uint64("owner", req.Owner),
+		slog.Int("kind", int(req.Kind)),
+		slog.Int64("start", req.Start),
+		slog.Int64("len", req.Len),
+	)
+
+	start, end, err := lockRange(req)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fileKey{token: token, ino: ino}
+	if fl, ok := m.files[key]; ok {
+		fl.apply(req.Owner, req.Kind, models.LockTypeUnlock, start, end, time.Time{})
+		if len(fl.held) == 0 {
+			delete(m.files, key)
+		}
+	}
+	m.renewLocked(token, req.Owner)
+
+	return nil
+}
+
+// Renew extends the lease of every lock owner holds within token. It
+// returns ENOENT if owner holds none, e.g. because they already expired
+func (m *Manager) Renew(ctx context.Context, token string, owner uint64) error {
+	const op = "lock.Manager.Renew"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.renewLocked(token, owner) == 0 {
+		logger.Debug("Owner holds no locks", slog.String("token", token), slog.Uint64("owner", owner))
+		return &service.ServiceError{Code: kerrors.ENOENT, Message: "owner holds no locks"}
+	}
+
+	return nil
+}
+
+// GetLk returns the first lock that would prevent req from being granted,
+// or a lock of type F_UNLCK if there is none
+func (m *Manager) GetLk(ctx context.Context, token string, ino int64, req models.FileLock) (*models.FileLock, error) {
+	const op = "lock.Manager.GetLk"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("GetLk",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Uint64("owner", req.Owner),
+		slog.Int("kind", int(req.Kind)),
+		slog.Int("type", int(req.Type)),
+	)
+
+	start, end, err := lockRange(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.renewLocked(token, req.Owner)
+
+	fl, ok := m.files[fileKey{token: token, ino: ino}]
+	if !ok {
+		return &models.FileLock{Type: models.LockTypeUnlock, Kind: req.Kind, Start: req.Start, Len: req.Len}, nil
+	}
+
+	conflict := fl.findConflict(req.Owner, req.Kind, req.Type, start, end)
+	if conflict == nil {
+		return &models.FileLock{Type: models.LockTypeUnlock, Kind: req.Kind, Start: req.Start, Len: req.Len}, nil
+	}
+
+	return conflict.toModel(), nil
+}
+
+// Run periodically drops locks whose lease has expired. Blocks until ctx is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	const op = "lock.Manager.Run"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if expired := m.expire(time.Now()); expired > 0 {
+				logger.Info("Dropped locks with expired lease", slog.Int("count", expired))
+			}
+		}
+	}
+}
+
+func (m *Manager) expire(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for key, fl := range m.files {
+		kept := fl.held[:0]
+		for _, l := range fl.held {
+			if now.After(l.expires) {
+				expired++
+				continue
+			}
+			kept = append(kept, l)
+		}
+
+		if len(kept) != len(fl.held) {
+			fl.held = kept
+			fl.notify()
+		}
+		if len(fl.held) == 0 {
+			delete(m.files, key)
+		}
+	}
+
+	return expired
+}
+
+// renewLocked extends the lease of every lock owner holds within token and
+// returns how many there are. m.mu must be held
+func (m *Manager) renewLocked(token string, owner uint64) int {
+	renewed := 0
+	expires := time.Now().Add(m.lease)
+	for key, fl := range m.files {
+		if key.token != token {
+			continue
+		}
+		for _, l := range fl.held {
+			if l.owner == owner {
+				l.expires = expires
+				renewed++
+			}
+		}
+	}
+	return renewed
+}
+
+func (m *Manager) getFile(key fileKey) *fileLocks {
+	fl, ok := m.files[key]
+	if !ok {
+		fl = &fileLocks{changed: make(chan struct{})}
+		m.files[key] = fl
+	}
+	return fl
+}
+
+func (fl *fileLocks) findConflict(owner uint64, kind models.LockKind, typ models.LockType, start, end int64) *heldLock {
+	for _, l := range fl.held {
+		if l.kind != kind || l.owner == owner {
+			continue
+		}
+		if l.end < start || l.start > end {
+			continue
+		}
+		if l.typ == models.LockTypeWrite || typ == models.LockTypeWrite {
+			return l
+		}
+	}
+	return nil
+}
+
+// apply replaces owner's locks of the given kind within [start, end] with a lock
+// of type typ (F_UNLCK just removes them). Partially covered POSIX locks are split
+func (fl *fileLocks) apply(owner uint64, kind models.LockKind, typ models.LockType, start, end int64, expires time.Time) {
+	var held []*heldLock
+	for _, l := range fl.held {
+		if l.owner != owner || l.kind != kind || l.end < start || l.start > end {
+			held = append(held, l)
+			continue
+		}
+
+		// Keep the parts of the old lock outside of the new range
+		if l.start < start {
+			left := *l
+			left.end = start - 1
+			held = append(held, &left)
+		}
+		if l.end > end {
+			right := *l
+			right.start = end + 1
+			held = append(held, &right)
+		}
+	}
+
+	if typ != models.LockTypeUnlock {
+		held = append(held, &heldLock{
+			owner:   owner,
+			kind:    kind,
+			typ:     typ,
+			start:   start,
+			end:     end,
+			expires: expires,
+		})
+	}
+
+	fl.held = held
+	fl.notify()
+}
+
+func (fl *fileLocks) notify() {
+	close(fl.changed)
+	fl.changed = make(chan struct{})
+}
+
+func (l *heldLock) toModel() *models.FileLock {
+	length := int64(0)
+	if l.end != math.MaxInt64 {
+		length = l.end - l.start + 1
+	}
+
+	return &models.FileLock{
+		Type:  l.typ,
+		Kind:  l.kind,
+		Start: l.start,
+		Len:   length,
+		Owner: l.owner,
+	}
+}
+
+// lockRange converts (start, len) into an inclusive byte range. flock locks always cover the whole file
+func lockRange(req models.FileLock) (int64, int64, error) {
+	switch req.Type {
+	case models.LockTypeRead, models.LockTypeWrite, models.LockTypeUnlock:
+	default:
+		return 0, 0, &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid lock type"}
+	}
+
+	switch req.Kind {
+	case models.LockKindFlock:
+		return 0, math.MaxInt64, nil
+	case models.LockKindPosix:
+	default:
+		return 0, 0, &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid lock kind"}
+	}
+
+	if req.Start < 0 || req.Len < 0 {
+		return 0, 0, &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid lock range"}
+	}
+
+	if req.Len == 0 || req.Len > math.MaxInt64-req.Start {
+		return req.Start, math.MaxInt64, nil
+	}
+
+	return req.Start, req.Start + req.Len - 1, nil
+}
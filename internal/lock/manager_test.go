@@ -0,0 +1,48 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+func TestRenewKeepsLock(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(time.Hour, time.Second)
+
+	flock := models.FileLock{Kind: models.LockKindFlock, Type: models.LockTypeWrite, Owner: 1}
+	if err := m.Lock(ctx, "token", 1, flock, false, 0); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	held := m.files[fileKey{token: "token", ino: 1}].held[0]
+	before := held.expires
+	time.Sleep(time.Millisecond)
+	if err := m.Renew(ctx, "token", 1); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if !held.expires.After(before) {
+		t.Fatalf("Renew kept lease at %v", held.expires)
+	}
+	if expired := m.expire(time.Now().Add(time.Hour / 2)); expired != 0 {
+		t.Fatalf("expire within lease = %d, want 0", expired)
+	}
+
+	other := flock
+	other.Owner = 2
+	if err := m.Lock(ctx, "token", 1, other, false, 0); err == nil {
+		t.Fatal("second owner got the lock while it is held")
+	}
+
+	if expired := m.expire(time.Now().Add(2 * time.Hour)); expired != 1 {
+		t.Fatalf("expire past lease = %d, want 1", expired)
+	}
+	if err := m.Renew(ctx, "token", 1); err == nil {
+		t.Fatal("Renew of expired locks succeeded")
+	}
+	if err := m.Lock(ctx, "token", 1, other, false, 0); err != nil {
+		t.Fatalf("Lock after expiry: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/lru"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vtfs"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	serviceCalls    *prometheus.CounterVec
+	serviceDuration *prometheus.HistogramVec
+	serviceQueries  *prometheus.HistogramVec
+
+	bytesRead    prometheus.Counter
+	bytesWritten prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by endpoint, method and status.",
+		}, []string{"endpoint", "method", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by endpoint.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"endpoint"}),
+		serviceCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "service",
+			Name:      "calls_total",
+			Help:      "Number of FileSystemService calls by method and returned kernel error code (0 = success).",
+		}, []string{"method", "code"}),
+		serviceDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "service",
+			Name:      "call_duration_seconds",
+			Help:      "FileSystemService call latency by method.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"method"}),
+		serviceQueries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "service",
+			Name:      "call_queries",
+			Help:      "SQL statements per FileSystemService call by method, including BEGIN and COMMIT.",
+			Buckets:   []float64{0, 1, 2, 3, 4, 6, 8, 12, 16, 32},
+		}, []string{"method"}),
+		bytesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_read_total",
+			Help:      "Number of file content bytes returned by reads.",
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_written_total",
+			Help:      "Number of file content bytes stored by writes.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.serviceCalls,
+		m.serviceDuration,
+		m.serviceQueries,
+		m.bytesRead,
+		m.bytesWritten,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "transaction_retries_total",
+			Help:      "Number of transactions re-run after serialization failure or deadlock.",
+		}, func() float64 { return float64(postgresql.TxRetries()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "transaction_conflicts_total",
+			Help:      "Number of transactions failed by serialization failure or deadlock after all retries.",
+		}, func() float64 { return float64(postgresql.TxConflicts()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db",
+			Name:      "queries_total",
+			Help:      "Number of SQL statements sent to the database, including BEGIN and COMMIT.",
+		}, func() float64 { return float64(postgresql.Queries()) }),
+	)
+
+	return m
+}
+
+// RegisterPool exposes connection pool statistics
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) {
+	gauge := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(pool.Stat()) })
+	}
+	counter := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(pool.Stat()) })
+	}
+
+	m.registry.MustRegister(
+		gauge("acquired_conns", "Connections currently in use.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }),
+		gauge("idle_conns", "Idle connections.",
+			func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }),
+		gauge("total_conns", "Total connections in the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }),
+		gauge("max_conns", "Maximum size of the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }),
+		counter("acquires_total", "Number of successful connection acquires.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }),
+		counter("empty_acquires_total", "Number of acquires that had to wait for a connection.",
+			func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }),
+		counter("canceled_acquires_total", "Number of acquires cancelled by context.",
+			func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }),
+		counter("acquire_duration_seconds_total", "Total time spent waiting for connections.",
+			func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }),
+	)
+}
+
+// RegisterCache exposes hit, miss and eviction counters of a metadata cache
+func (m *Metrics) RegisterCache(name string, stats func() lru.Stats) {
+	counter := func(metric, help string, value func(s lru.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "cache",
+			Name:        metric,
+			Help:        help,
+			ConstLabels: prometheus.Labels{"cache": name},
+		}, func() float64 { return float64(value(stats())) })
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Number of cache hits.", func(s lru.Stats) uint64 { return s.Hits }),
+		counter("misses_total", "Number of cache misses.", func(s lru.Stats) uint64 { return s.Misses }),
+		counter("evictions_total", "Number of entries evicted to stay within size.", func(s lru.Stats) uint64 { return s.Evictions }),
+	)
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) observeCall(method string, start time.Time, queries uint64, err error) {
+	code := int64(0)
+	if err != nil {
+		code = service.ErrorCode(err)
+	}
+
+	m.serviceCalls.WithLabelValues(method, strconv.FormatInt(code, 10)).Inc()
+	m.serviceDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	m.serviceQueries.WithLabelValues(method).Observe(float64(queries))
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/middleware"
+)
+
+// Middleware records request count and latency per registered mux pattern
+// (raw paths are not used as labels to keep cardinality bounded)
+func (m *Metrics) Middleware(next http.Handler, routes *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		endpoint := "other"
+		if _, pattern := routes.Handler(r); pattern != "" {
+			endpoint = pattern
+		}
+
+		rec := middleware.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		m.httpRequests.WithLabelValues(endpoint, r.Method, strconv.Itoa(rec.Status)).Inc()
+		m.httpRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+)
+
+// instrumentedService records latency, result codes, SQL statements and
+// transferred bytes of every FileSystemService call
+type instrumentedService struct {
+	next    service.FileSystemService
+	metrics *Metrics
+}
+
+func NewInstrumentedService(next service.FileSystemService, metrics *Metrics) service.FileSystemService {
+	return &instrumentedService{next: next, metrics: metrics}
+}
+
+func (s *instrumentedService) Init(ctx context.Context, token string) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Init", start, queries.Load(), err) }(time.Now())
+	return s.next.Init(ctx, token)
+}
+
+func (s *instrumentedService) GetRoot(ctx context.Context, token string) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("GetRoot", start, queries.Load(), err) }(time.Now())
+	return s.next.GetRoot(ctx, token)
+}
+
+func (s *instrumentedService) Lookup(ctx context.Context, token string, parentIno int64, name string) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Lookup", start, queries.Load(), err) }(time.Now())
+	return s.next.Lookup(ctx, token, parentIno, name)
+}
+
+func (s *instrumentedService) ResolvePath(ctx context.Context, token string, path string) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("ResolvePath", start, queries.Load(), err) }(time.Now())
+	return s.next.ResolvePath(ctx, token, path)
+}
+
+func (s *instrumentedService) IterateDir(ctx context.Context, token string, dirIno int64, offset *uint64) (dirent *models.Dirent, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("IterateDir", start, queries.Load(), err) }(time.Now())
+	return s.next.IterateDir(ctx, token, dirIno, offset)
+}
+
+func (s *instrumentedService) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("CreateFile", start, queries.Load(), err) }(time.Now())
+	return s.next.CreateFile(ctx, token, parentIno, name, mode)
+}
+
+func (s *instrumentedService) Unlink(ctx context.Context, token string, parentIno int64, name string) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Unlink", start, queries.Load(), err) }(time.Now())
+	return s.next.Unlink(ctx, token, parentIno, name)
+}
+
+func (s *instrumentedService) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("CreateDir", start, queries.Load(), err) }(time.Now())
+	return s.next.CreateDir(ctx, token, parentIno, name, mode)
+}
+
+func (s *instrumentedService) Rmdir(ctx context.Context, token string, parentIno int64, name string) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Rmdir", start, queries.Load(), err) }(time.Now())
+	return s.next.Rmdir(ctx, token, parentIno, name)
+}
+
+func (s *instrumentedService) Read(ctx context.Context, token string, ino int64, buffer []byte, offset int64) (read int64, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) {
+		s.metrics.observeCall("Read", start, queries.Load(), err)
+		if err == nil {
+			s.metrics.bytesRead.Add(float64(read))
+		}
+	}(time.Now())
+	return s.next.Read(ctx, token, ino, buffer, offset)
+}
+
+func (s *instrumentedService) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (written int64, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) {
+		s.metrics.observeCall("Write", start, queries.Load(), err)
+		if err == nil {
+			s.metrics.bytesWritten.Add(float64(written))
+		}
+	}(time.Now())
+	return s.next.Write(ctx, token, ino, data, length, offset)
+}
+
+func (s *instrumentedService) Truncate(ctx context.Context, token string, ino int64, size int64) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Truncate", start, queries.Load(), err) }(time.Now())
+	return s.next.Truncate(ctx, token, ino, size)
+}
+
+func (s *instrumentedService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("ReplaceContent", start, queries.Load(), err) }(time.Now())
+	return s.next.ReplaceContent(ctx, token, ino, data)
+}
+
+func (s *instrumentedService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Link", start, queries.Load(), err) }(time.Now())
+	return s.next.Link(ctx, token, targetIno, parentIno, name)
+}
+
+func (s *instrumentedService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Rename", start, queries.Load(), err) }(time.Now())
+	return s.next.Rename(ctx, token, oldParentIno, oldName, newParentIno, newName)
+}
+
+func (s *instrumentedService) CountLinks(ctx context.Context, token string, ino int64) (count uint32, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("CountLinks", start, queries.Load(), err) }(time.Now())
+	return s.next.CountLinks(ctx, token, ino)
+}
+
+func (s *instrumentedService) Open(ctx context.Context, token string, ino int64) (fh int64, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Open", start, queries.Load(), err) }(time.Now())
+	return s.next.Open(ctx, token, ino)
+}
+
+func (s *instrumentedService) Renew(ctx context.Context, token string, fh int64) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Renew", start, queries.Load(), err) }(time.Now())
+	return s.next.Renew(ctx, token, fh)
+}
+
+func (s *instrumentedService) Release(ctx context.Context, token string, fh int64) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("Release", start, queries.Load(), err) }(time.Now())
+	return s.next.Release(ctx, token, fh)
+}
+
+func (s *instrumentedService) SetTrash(ctx context.Context, token string, enabled bool) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("SetTrash", start, queries.Load(), err) }(time.Now())
+	return s.next.SetTrash(ctx, token, enabled)
+}
+
+func (s *instrumentedService) ListTrash(ctx context.Context, token string) (entries []models.TrashEntry, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("ListTrash", start, queries.Load(), err) }(time.Now())
+	return s.next.ListTrash(ctx, token)
+}
+
+func (s *instrumentedService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (meta *models.NodeMeta, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("RestoreTrash", start, queries.Load(), err) }(time.Now())
+	return s.next.RestoreTrash(ctx, token, id, parentIno, name)
+}
+
+func (s *instrumentedService) SetVersioning(ctx context.Context, token string, ino int64, keep int) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("SetVersioning", start, queries.Load(), err) }(time.Now())
+	return s.next.SetVersioning(ctx, token, ino, keep)
+}
+
+func (s *instrumentedService) ListVersions(ctx context.Context, token string, ino int64) (versions []models.FileVersion, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("ListVersions", start, queries.Load(), err) }(time.Now())
+	return s.next.ListVersions(ctx, token, ino)
+}
+
+func (s *instrumentedService) ReadVersion(ctx context.Context, token string, ino int64, version int64) (data []byte, err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("ReadVersion", start, queries.Load(), err) }(time.Now())
+	return s.next.ReadVersion(ctx, token, ino, version)
+}
+
+func (s *instrumentedService) RestoreVersion(ctx context.Context, token string, ino int64, version int64) (err error) {
+	ctx, queries := postgresql.CountQueries(ctx)
+	defer func(start time.Time) { s.metrics.observeCall("RestoreVersion", start, queries.Load(), err) }(time.Now())
+	return s.next.RestoreVersion(ctx, token, ino, version)
+}
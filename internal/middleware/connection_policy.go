@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Every response closes the connection (behaviour expected by the kernel module)
+	KeepAliveClose = "close"
+	// Connection is kept only if the client asks for it with
+	// "Connection: keep-alive" or "X-VTFS-Keep-Alive: 1"
+	KeepAliveNegotiate = "negotiate"
+	// Standard net/http behaviour: HTTP/1.1 connections are reused
+	KeepAliveAlways = "always"
+)
+
+func ConnectionPolicyMiddleware(policy string, next http.Handler) (http.Handler, error) {
+	switch policy {
+	case KeepAliveAlways:
+		return next, nil
+	case KeepAliveClose, KeepAliveNegotiate:
+	default:
+		return nil, fmt.Errorf("unknown keep-alive policy %q", policy)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if policy == KeepAliveClose || !wantsKeepAlive(r) {
+			w.Header().Set("Connection", "close")
+		}
+
+		next.ServeHTTP(w, r)
+	}), nil
+}
+
+func wantsKeepAlive(r *http.Request) bool {
+	if r.Header.Get("X-VTFS-Keep-Alive") == "1" {
+		return true
+	}
+
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "keep-alive") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+)
+
+// RemoteAddrMiddleware puts the client address into request context, so
+// layers below HTTP (e.g. audit) can attribute calls
+func RemoteAddrMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logging.MakeContextWithRemoteAddr(r.Context(), r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
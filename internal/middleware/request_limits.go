@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+// RequestLimitsMiddleware rejects query strings longer than maxQuery bytes
+// and cuts request bodies at maxBody bytes. Binary /api/* clients get
+// EINVAL in the usual reply format, everyone else 414 URI Too Long
+func RequestLimitsMiddleware(maxQuery int, maxBody int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.RawQuery) > maxQuery {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				binary.WriteResponse(w, kerrors.EINVAL_NEG, nil)
+				return
+			}
+			http.Error(w, "Query string too long", http.StatusRequestURITooLong)
+			return
+		}
+
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -23,6 +23,91 @@ type Dirent struct {
 	Type NodeType `json:"type"`
 }
 
+type LockType int16
+
+const (
+	LockTypeRead   LockType = 0 // F_RDLCK
+	LockTypeWrite  LockType = 1 // F_WRLCK
+	LockTypeUnlock LockType = 2 // F_UNLCK
+)
+
+type LockKind int16
+
+const (
+	LockKindFlock LockKind = 0 // flock(2), whole file
+	LockKindPosix LockKind = 1 // fcntl(2) byte-range
+)
+
+type FileLock struct {
+	Type  LockType `json:"type"`
+	Kind  LockKind `json:"kind"`
+	Start int64    `json:"start"`
+	Len   int64    `json:"len"` // 0 = up to EOF
+	Owner uint64   `json:"owner"`
+}
+
+type EventType string
+
+const (
+	EventCreate EventType = "create"
+	EventUnlink EventType = "unlink"
+	EventMkdir  EventType = "mkdir"
+	EventRmdir  EventType = "rmdir"
+	EventWrite  EventType = "write"
+	EventLink   EventType = "link"
+	EventRename EventType = "rename"
+)
+
+type Event struct {
+	Seq       uint64    `json:"seq"`
+	Type      EventType `json:"type"`
+	Token     string    `json:"token"`
+	Ino       int64     `json:"ino"`
+	ParentIno int64     `json:"parent_ino"`
+	Name      string    `json:"name,omitempty"`
+	// Set for rename only
+	OldParentIno int64     `json:"old_parent_ino,omitempty"`
+	OldName      string    `json:"old_name,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// FileVersion is a committed content of a versioned file
+type FileVersion struct {
+	ID        int64     `json:"version"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditRecord is a mutating call as stored in the audit log
+type AuditRecord struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Token      string    `json:"token"`
+	Op         string    `json:"op"`
+	// Inode the call acted on, 0 if unknown (e.g. unlink by name)
+	Ino       int64  `json:"ino,omitempty"`
+	ParentIno int64  `json:"parent_ino,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Set for rename only
+	NewParentIno int64  `json:"new_parent_ino,omitempty"`
+	NewName      string `json:"new_name,omitempty"`
+	// Kernel error code, 0 on success
+	Code int64 `json:"code"`
+}
+
+// AuditFilter selects audit records, zero fields match everything
+type AuditFilter struct {
+	Token string
+	Op    string
+	Since time.Time
+	Until time.Time
+	// Only records with smaller ID, for paging backwards
+	BeforeID int64
+	Limit    int
+}
+
 type Inode struct {
 	Ino      int64
 	Token    string
@@ -33,8 +118,51 @@ type Inode struct {
 }
 
 type Filesystem struct {
-	Token    string
-	RootIno  int64
-	NextIno  int64
-	CreateAt time.Time
+	Token        string
+	RootIno      int64
+	NextIno      int64
+	TrashEnabled bool
+	CreateAt     time.Time
+}
+
+// TrashEntry is a file whose last link was removed while trash was enabled
+type TrashEntry struct {
+	ID  int64 `json:"id"`
+	Ino int64 `json:"ino"`
+	// Where the file was linked before deletion
+	ParentIno int64     `json:"parent_ino"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Mode      uint32    `json:"mode"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// DedupReport compares file data as seen by files (logical) with data held
+// in shared chunks (stored) and with the bytes the chunks take after
+// compression (physical). Ratio is logical / stored, 1 means nothing is
+// shared; CompressionRatio is stored / physical
+type DedupReport struct {
+	ChunkSize        int64   `json:"chunk_size"`
+	Chunks           int64   `json:"chunks"`
+	LogicalBytes     int64   `json:"logical_bytes"`
+	StoredBytes      int64   `json:"stored_bytes"`
+	PhysicalBytes    int64   `json:"physical_bytes"`
+	Ratio            float64 `json:"ratio"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	// Unreferenced chunks waiting for the collector
+	GarbageChunks int64             `json:"garbage_chunks"`
+	GarbageBytes  int64             `json:"garbage_bytes"`
+	Filesystems   []FilesystemDedup `json:"filesystems"`
+}
+
+// FilesystemDedup is the dedup of one filesystem. Stored and physical
+// bytes count every chunk it references once, chunks shared with other
+// filesystems included
+type FilesystemDedup struct {
+	Token            string  `json:"token"`
+	LogicalBytes     int64   `json:"logical_bytes"`
+	StoredBytes      int64   `json:"stored_bytes"`
+	PhysicalBytes    int64   `json:"physical_bytes"`
+	Ratio            float64 `json:"ratio"`
+	CompressionRatio float64 `json:"compression_ratio"`
 }
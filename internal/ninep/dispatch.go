@@ -0,0 +1,660 @@
+package ninep
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+)
+
+const (
+	// Reported by Rstatfs
+	v9fsMagic = 0x01021997
+	blockSize = 4096
+	nameMax   = 255
+)
+
+var (
+	errBadFid     = &service.ServiceError{Code: kerrors.EBADF, Message: "unknown fid"}
+	errBadMessage = &service.ServiceError{Code: kerrors.EINVAL, Message: "malformed message"}
+	errNotOpen    = &service.ServiceError{Code: kerrors.EBADF, Message: "fid is not open"}
+	errNotDir     = &service.ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"}
+)
+
+// handle executes one request and returns reply type, tag and body
+func (s *session) handle(ctx context.Context, msg *message) (msgType, uint16, []byte) {
+	const op = "ninep.session.handle"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Message received", slog.Int("type", int(msg.typ)), slog.Int("tag", int(msg.tag)))
+
+	d := binary.NewDecoder(msg.body)
+	e := binary.NewEncoder()
+
+	var err error
+	switch msg.typ {
+	case tversion:
+		err = s.version(ctx, d, e)
+	case tattach:
+		err = s.attach(ctx, d, e)
+	case twalk:
+		err = s.walk(ctx, d, e)
+	case tlopen:
+		err = s.lopen(ctx, d, e)
+	case tlcreate:
+		err = s.lcreate(ctx, d, e)
+	case tread:
+		err = s.read(ctx, d, e)
+	case twrite:
+		err = s.write(ctx, d, e)
+	case treaddir:
+		err = s.readdir(ctx, d, e)
+	case tgetattr:
+		err = s.getattr(ctx, d, e)
+	case tsetattr:
+		err = s.setattr(ctx, d)
+	case tmkdir:
+		err = s.mkdir(ctx, d, e)
+	case tunlinkat:
+		err = s.unlinkat(ctx, d)
+	case tlink:
+		err = s.link(ctx, d)
+	case trenameat:
+		err = s.renameat(ctx, d)
+	case trename:
+		err = s.rename(ctx, d)
+	case tstatfs:
+		err = s.statfs(d, e)
+	case tclunk:
+		_, err = s.remove(ctx, d.Uint32())
+	case tremove:
+		err = s.removeFile(ctx, d)
+	case tfsync, tflush:
+		// Every write is committed before it is acknowledged
+	default:
+		logger.Debug("Unsupported message", slog.Int("type", int(msg.typ)))
+		err = &service.ServiceError{Code: kerrors.EOPNOTSUPP, Message: "operation not supported"}
+	}
+
+	if err == nil && d.Err() != nil {
+		err = errBadMessage
+	}
+	if err != nil {
+		logger.Debug("Request failed", slog.Int("type", int(msg.typ)), slog.String("error", err.Error()))
+		return rlerror, msg.tag, binary.NewEncoder().PutUint32(errno(err)).Bytes()
+	}
+
+	return msg.typ + 1, msg.tag, e.Bytes()
+}
+
+// errno converts service error into positive Linux errno for Rlerror
+func errno(err error) uint32 {
+	code := service.ErrorCode(err)
+	if code < 0 {
+		code = -code
+	}
+	return uint32(code)
+}
+
+// version: msize u32, version s -> msize u32, version s
+func (s *session) version(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	msize := d.Uint32()
+	version := d.String()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	// Version starts a new session, previous fids are gone
+	s.clunkAll(ctx)
+
+	s.mu.Lock()
+	s.msize = min(s.msize, msize)
+	msize = s.msize
+	s.mu.Unlock()
+
+	if version != protocolVersion {
+		version = "unknown"
+	}
+
+	e.PutUint32(msize).PutString(version)
+	return nil
+}
+
+// attach: fid u32, afid u32, uname s, aname s, n_uname u32 -> qid
+func (s *session) attach(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	_ = d.Uint32() // afid, authentication is not supported
+	_ = d.String() // uname
+	token := strings.Trim(d.String(), "/")
+	_ = d.Uint32() // n_uname
+	if d.Err() != nil || token == "" {
+		return errBadMessage
+	}
+
+	meta, err := s.service.GetRoot(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.put(id, fid{token: token, path: "/", meta: *meta}, false); err != nil {
+		return err
+	}
+
+	putQid(e, meta.Ino, meta.Type)
+	return nil
+}
+
+// walk: fid u32, newfid u32, nwname u16, wname[nwname] s -> nwqid u16, qid[nwqid]
+func (s *session) walk(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	newID := d.Uint32()
+	n := d.Uint16()
+	if d.Err() != nil || n > maxWalkElements {
+		return errBadMessage
+	}
+
+	names := make([]string, n)
+	for i := range names {
+		names[i] = d.String()
+	}
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if f.opened {
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "cannot walk from open fid"}
+	}
+
+	cur := fid{token: f.token, path: f.path, meta: f.meta}
+	qids := binary.NewEncoder()
+	walked := 0
+
+	for _, name := range names {
+		var meta *models.NodeMeta
+		switch {
+		case cur.meta.Type != models.NodeTypeDir:
+			err = errNotDir
+		case name == "..":
+			cur.path = path.Dir(cur.path)
+			meta, err = s.service.ResolvePath(ctx, cur.token, cur.path)
+		case name == "." || name == "":
+			meta = &cur.meta
+		default:
+			cur.path = childPath(cur.path, name)
+			meta, err = s.service.Lookup(ctx, cur.token, cur.meta.Ino, name)
+		}
+		if err != nil {
+			// Error is returned only for the first element, otherwise the
+			// client learns how far the walk went from the number of qids
+			if walked == 0 {
+				return err
+			}
+			break
+		}
+
+		cur.meta = *meta
+		putQid(qids, meta.Ino, meta.Type)
+		walked++
+	}
+
+	if walked == len(names) {
+		if err := s.put(newID, cur, newID == id); err != nil {
+			return err
+		}
+	}
+
+	e.PutUint16(uint16(walked))
+	e.PutFixed(qids.Bytes())
+	return nil
+}
+
+// lopen: fid u32, flags u32 -> qid, iounit u32
+func (s *session) lopen(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	flags := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if f.opened {
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "fid is already open"}
+	}
+
+	if f.meta.Type == models.NodeTypeFile {
+		if flags&oTrunc != 0 {
+			if err := s.service.Truncate(ctx, f.token, f.meta.Ino, 0); err != nil {
+				return err
+			}
+			f.meta.Size = 0
+		}
+
+		f.fh, err = s.service.Open(ctx, f.token, f.meta.Ino)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.opened = true
+	if err := s.put(id, f, true); err != nil {
+		return err
+	}
+
+	putQid(e, f.meta.Ino, f.meta.Type).PutUint32(s.iounit())
+	return nil
+}
+
+// lcreate: fid u32, name s, flags u32, mode u32, gid u32 -> qid, iounit u32.
+// fid changes from the directory to the new open file
+func (s *session) lcreate(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	name := d.String()
+	_ = d.Uint32() // flags
+	mode := d.Uint32()
+	_ = d.Uint32() // gid
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	dir, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if dir.meta.Type != models.NodeTypeDir {
+		return errNotDir
+	}
+
+	meta, err := s.service.CreateFile(ctx, dir.token, dir.meta.Ino, name, mode&service.S_IRWXUGO)
+	if err != nil {
+		return err
+	}
+
+	fh, err := s.service.Open(ctx, dir.token, meta.Ino)
+	if err != nil {
+		return err
+	}
+
+	f := fid{token: dir.token, path: childPath(dir.path, name), meta: *meta, fh: fh, opened: true}
+	if err := s.put(id, f, true); err != nil {
+		return err
+	}
+
+	putQid(e, meta.Ino, meta.Type).PutUint32(s.iounit())
+	return nil
+}
+
+// read: fid u32, offset u64, count u32 -> count u32, data[count]
+func (s *session) read(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	offset := d.Int64()
+	count := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if !f.opened {
+		return errNotOpen
+	}
+	if f.meta.Type == models.NodeTypeDir {
+		return &service.ServiceError{Code: kerrors.EISDIR, Message: "is a directory"}
+	}
+
+	buffer := make([]byte, min(count, s.iounit(), s.maxReadSize))
+	read, err := s.service.Read(ctx, f.token, f.meta.Ino, buffer, offset)
+	if err != nil {
+		return err
+	}
+
+	e.PutBytes(buffer[:read])
+	return nil
+}
+
+// write: fid u32, offset u64, count u32, data[count] -> count u32
+func (s *session) write(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	offset := d.Int64()
+	data := d.Bytes()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if !f.opened {
+		return errNotOpen
+	}
+
+	written, err := s.service.Write(ctx, f.token, f.meta.Ino, data, uint64(len(data)), offset)
+	if err != nil {
+		return err
+	}
+
+	// Keep size of an unlinked open file current for getattr
+	s.mu.Lock()
+	if cur, ok := s.fids[id]; ok {
+		cur.meta.Size = max(cur.meta.Size, offset+written)
+	}
+	s.mu.Unlock()
+
+	e.PutUint32(uint32(written))
+	return nil
+}
+
+// readdir: fid u32, offset u64, count u32 -> count u32, entries.
+// Entry: qid, offset u64 (of the next entry), type u8, name s
+func (s *session) readdir(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	offset := d.Uint64()
+	count := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if !f.opened {
+		return errNotOpen
+	}
+	if f.meta.Type != models.NodeTypeDir {
+		return errNotDir
+	}
+
+	count = min(count, s.iounit())
+	entries := binary.NewEncoder()
+	for {
+		dirent, err := s.service.IterateDir(ctx, f.token, f.meta.Ino, &offset)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := binary.NewEncoder()
+		putQid(entry, dirent.Ino, dirent.Type).
+			PutUint64(offset).
+			PutUint8(direntType(dirent.Type)).
+			PutString(dirent.Name)
+
+		// Entry that does not fit is returned by the next Treaddir from the same offset
+		if len(entries.Bytes())+len(entry.Bytes()) > int(count) {
+			break
+		}
+		entries.PutFixed(entry.Bytes())
+	}
+
+	e.PutBytes(entries.Bytes())
+	return nil
+}
+
+// getattr: fid u32, request_mask u64 -> valid u64, qid, mode u32, uid u32,
+// gid u32, nlink u64, rdev u64, size u64, blksize u64, blocks u64,
+// atime, mtime, ctime, btime (sec u64, nsec u64 each), gen u64, data_version u64
+func (s *session) getattr(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	_ = d.Uint64() // request_mask, basic attributes are always returned
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	meta, err := s.stat(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	nlink, err := s.service.CountLinks(ctx, f.token, meta.Ino)
+	if err != nil {
+		if !f.opened {
+			return err
+		}
+		nlink = 0
+	}
+
+	e.PutUint64(getattrBasic)
+	putQid(e, meta.Ino, meta.Type)
+	e.PutUint32(meta.Mode).
+		PutUint32(0). // uid
+		PutUint32(0). // gid
+		PutUint64(uint64(nlink)).
+		PutUint64(0). // rdev
+		PutUint64(uint64(meta.Size)).
+		PutUint64(blockSize).
+		PutUint64(uint64((meta.Size + 511) / 512))
+	// Timestamps (atime, mtime, ctime, btime) are not tracked, gen and
+	// data_version are unused
+	for range 10 {
+		e.PutUint64(0)
+	}
+	return nil
+}
+
+// setattr: fid u32, valid u32, mode u32, uid u32, gid u32, size u64,
+// atime_sec u64, atime_nsec u64, mtime_sec u64, mtime_nsec u64 -> empty.
+// Only size can be changed, timestamps are accepted and ignored
+func (s *session) setattr(ctx context.Context, d *binary.Decoder) error {
+	id := d.Uint32()
+	valid := d.Uint32()
+	_ = d.Uint32() // mode
+	_ = d.Uint32() // uid
+	_ = d.Uint32() // gid
+	size := d.Int64()
+	_ = d.Fixed(4 * 8) // atime, mtime
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	if valid&(setattrMode|setattrUID|setattrGID) != 0 {
+		return &service.ServiceError{Code: kerrors.EPERM, Message: "mode and ownership cannot be changed"}
+	}
+
+	if valid&setattrSize != 0 {
+		return s.service.Truncate(ctx, f.token, f.meta.Ino, size)
+	}
+	return nil
+}
+
+// mkdir: dfid u32, name s, mode u32, gid u32 -> qid
+func (s *session) mkdir(ctx context.Context, d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	name := d.String()
+	mode := d.Uint32()
+	_ = d.Uint32() // gid
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	dir, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	meta, err := s.service.CreateDir(ctx, dir.token, dir.meta.Ino, name, mode&service.S_IRWXUGO)
+	if err != nil {
+		return err
+	}
+
+	putQid(e, meta.Ino, meta.Type)
+	return nil
+}
+
+// unlinkat: dfid u32, name s, flags u32 -> empty
+func (s *session) unlinkat(ctx context.Context, d *binary.Decoder) error {
+	id := d.Uint32()
+	name := d.String()
+	flags := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	dir, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	if flags&atRemoveDir != 0 {
+		return s.service.Rmdir(ctx, dir.token, dir.meta.Ino, name)
+	}
+	return s.service.Unlink(ctx, dir.token, dir.meta.Ino, name)
+}
+
+// link: dfid u32, fid u32, name s -> empty
+func (s *session) link(ctx context.Context, d *binary.Decoder) error {
+	dirID := d.Uint32()
+	id := d.Uint32()
+	name := d.String()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	dir, err := s.get(dirID)
+	if err != nil {
+		return err
+	}
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	return s.service.Link(ctx, dir.token, f.meta.Ino, dir.meta.Ino, name)
+}
+
+// renameat: olddirfid u32, oldname s, newdirfid u32, newname s -> empty
+func (s *session) renameat(ctx context.Context, d *binary.Decoder) error {
+	oldDirID := d.Uint32()
+	oldName := d.String()
+	newDirID := d.Uint32()
+	newName := d.String()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	oldDir, err := s.get(oldDirID)
+	if err != nil {
+		return err
+	}
+	newDir, err := s.get(newDirID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.service.Rename(ctx, oldDir.token, oldDir.meta.Ino, oldName, newDir.meta.Ino, newName); err != nil {
+		return err
+	}
+
+	s.renamed(oldDir.token, childPath(oldDir.path, oldName), childPath(newDir.path, newName))
+	return nil
+}
+
+// rename: fid u32, dfid u32, name s -> empty
+func (s *session) rename(ctx context.Context, d *binary.Decoder) error {
+	id := d.Uint32()
+	dirID := d.Uint32()
+	name := d.String()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	newDir, err := s.get(dirID)
+	if err != nil {
+		return err
+	}
+
+	oldDir, err := s.service.ResolvePath(ctx, f.token, path.Dir(f.path))
+	if err != nil {
+		return err
+	}
+
+	if err := s.service.Rename(ctx, f.token, oldDir.Ino, path.Base(f.path), newDir.meta.Ino, name); err != nil {
+		return err
+	}
+
+	s.renamed(f.token, f.path, childPath(newDir.path, name))
+	return nil
+}
+
+// statfs: fid u32 -> type u32, bsize u32, blocks u64, bfree u64, bavail u64,
+// files u64, ffree u64, fsid u64, namelen u32
+func (s *session) statfs(d *binary.Decoder, e *binary.Encoder) error {
+	id := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+
+	// Capacity is not tracked, zero counters mean "unknown"
+	e.PutUint32(v9fsMagic).
+		PutUint32(blockSize).
+		PutUint64(0). // blocks
+		PutUint64(0). // bfree
+		PutUint64(0). // bavail
+		PutUint64(0). // files
+		PutUint64(0). // ffree
+		PutUint64(0). // fsid
+		PutUint32(nameMax)
+	return nil
+}
+
+// remove: fid u32 -> empty. fid is clunked even if removal fails
+func (s *session) removeFile(ctx context.Context, d *binary.Decoder) error {
+	id := d.Uint32()
+	if d.Err() != nil {
+		return errBadMessage
+	}
+
+	f, err := s.remove(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if f.path == "/" {
+		return &service.ServiceError{Code: kerrors.EPERM, Message: "cannot remove root directory"}
+	}
+
+	dir, err := s.service.ResolvePath(ctx, f.token, path.Dir(f.path))
+	if err != nil {
+		return err
+	}
+
+	if f.meta.Type == models.NodeTypeDir {
+		return s.service.Rmdir(ctx, f.token, dir.Ino, path.Base(f.path))
+	}
+	return s.service.Unlink(ctx, f.token, dir.Ino, path.Base(f.path))
+}
@@ -0,0 +1,136 @@
+package ninep
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	pbinary "github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+// 9P2000.L message (all integers little-endian):
+//
+//	size u32 | type u8 | tag u16 | body
+//
+// size counts the whole message including itself. Strings are u16-length
+// prefixed, so bodies are encoded with binary.Encoder/Decoder. Only the
+// messages used by the Linux v9fs client are implemented, everything else
+// is answered with Rlerror(EOPNOTSUPP). Reply type is request type + 1
+type msgType uint8
+
+const (
+	rlerror   msgType = 7
+	tstatfs   msgType = 8
+	tlopen    msgType = 12
+	tlcreate  msgType = 14
+	trename   msgType = 20
+	tgetattr  msgType = 24
+	tsetattr  msgType = 26
+	treaddir  msgType = 40
+	tfsync    msgType = 50
+	tlink     msgType = 70
+	tmkdir    msgType = 72
+	trenameat msgType = 74
+	tunlinkat msgType = 76
+	tversion  msgType = 100
+	tattach   msgType = 104
+	tflush    msgType = 108
+	twalk     msgType = 110
+	tread     msgType = 116
+	twrite    msgType = 118
+	tclunk    msgType = 120
+	tremove   msgType = 122
+)
+
+const (
+	protocolVersion = "9P2000.L"
+	// Tversion uses this tag
+	noTag uint16 = 0xFFFF
+	noFid uint32 = 0xFFFFFFFF
+
+	headerSize = 4 + 1 + 2
+	// Header of Rread/Twrite: size, type, tag, fid, offset, count
+	ioHeaderSize = 24
+	// Maximum number of path elements in one Twalk
+	maxWalkElements = 16
+
+	qidTypeDir  uint8 = 0x80
+	qidTypeFile uint8 = 0x00
+
+	// Tunlinkat flag
+	atRemoveDir = 0x200
+
+	// Tgetattr/Tsetattr masks
+	getattrBasic uint64 = 0x000007ff
+	setattrMode  uint32 = 0x00000001
+	setattrUID   uint32 = 0x00000002
+	setattrGID   uint32 = 0x00000004
+	setattrSize  uint32 = 0x00000008
+
+	// Linux open(2) flags carried by Tlopen/Tlcreate
+	oTrunc = 0o1000
+)
+
+var ErrMessageTooLarge = errors.New("9p: message too large")
+
+type message struct {
+	typ  msgType
+	tag  uint16
+	body []byte
+}
+
+func readMessage(r io.Reader, msize uint32) (*message, error) {
+	var sizeBuf [4]byte
+	if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(sizeBuf[:])
+	if size < headerSize {
+		return nil, fmt.Errorf("9p: message too short: %d", size)
+	}
+	if size > msize {
+		return nil, ErrMessageTooLarge
+	}
+
+	frame := make([]byte, size-4)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	return &message{
+		typ:  msgType(frame[0]),
+		tag:  binary.LittleEndian.Uint16(frame[1:3]),
+		body: frame[3:],
+	}, nil
+}
+
+func writeMessage(w io.Writer, typ msgType, tag uint16, body []byte) error {
+	frame := make([]byte, headerSize, headerSize+len(body))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(headerSize+len(body)))
+	frame[4] = uint8(typ)
+	binary.LittleEndian.PutUint16(frame[5:7], tag)
+	frame = append(frame, body...)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// putQid encodes qid: type u8 | version u32 | path u64 (inode number)
+func putQid(e *pbinary.Encoder, ino int64, nodeType models.NodeType) *pbinary.Encoder {
+	qidType := qidTypeFile
+	if nodeType == models.NodeTypeDir {
+		qidType = qidTypeDir
+	}
+	return e.PutUint8(qidType).PutUint32(0).PutUint64(uint64(ino))
+}
+
+// dirent type in Rreaddir, as in linux/fs.h
+func direntType(nodeType models.NodeType) uint8 {
+	if nodeType == models.NodeTypeDir {
+		return 4 // DT_DIR
+	}
+	return 8 // DT_REG
+}
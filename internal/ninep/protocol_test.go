@@ -0,0 +1,84 @@
+package ninep
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	pbinary "github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	body := pbinary.NewEncoder().PutUint32(8192).PutString(protocolVersion).Bytes()
+	if err := writeMessage(&buf, tversion, noTag, body); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := buf.Bytes()
+	if size := binary.LittleEndian.Uint32(frame); size != uint32(headerSize+len(body)) || int(size) != len(frame) {
+		t.Fatalf("size field = %d, frame is %d bytes", size, len(frame))
+	}
+
+	msg, err := readMessage(&buf, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.typ != tversion || msg.tag != noTag || !bytes.Equal(msg.body, body) {
+		t.Fatalf("readMessage = %+v", msg)
+	}
+
+	d := pbinary.NewDecoder(msg.body)
+	if msize, version := d.Uint32(), d.String(); d.Err() != nil || msize != 8192 || version != protocolVersion {
+		t.Fatalf("body = %d %q, err %v", msize, version, d.Err())
+	}
+}
+
+func TestReadMessageRejectsBadSize(t *testing.T) {
+	tooShort := binary.LittleEndian.AppendUint32(nil, headerSize-1)
+	if _, err := readMessage(bytes.NewReader(tooShort), 8192); err == nil {
+		t.Fatal("message shorter than header accepted")
+	}
+
+	var buf bytes.Buffer
+	if err := writeMessage(&buf, twrite, 1, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readMessage(&buf, 64); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("readMessage over msize = %v, want ErrMessageTooLarge", err)
+	}
+
+	buf.Reset()
+	if err := writeMessage(&buf, tclunk, 1, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-1]
+	if _, err := readMessage(bytes.NewReader(truncated), 8192); err == nil {
+		t.Fatal("truncated message accepted")
+	}
+}
+
+func TestPutQid(t *testing.T) {
+	tests := []struct {
+		nodeType models.NodeType
+		want     uint8
+	}{
+		{models.NodeTypeDir, qidTypeDir},
+		{models.NodeTypeFile, qidTypeFile},
+	}
+
+	for _, tt := range tests {
+		qid := putQid(pbinary.NewEncoder(), 1234, tt.nodeType).Bytes()
+		if len(qid) != 13 {
+			t.Fatalf("qid is %d bytes, want 13", len(qid))
+		}
+
+		d := pbinary.NewDecoder(qid)
+		typ, version, path := d.Uint8(), d.Uint32(), d.Uint64()
+		if d.Err() != nil || typ != tt.want || version != 0 || path != 1234 {
+			t.Fatalf("qid of %v = type %#x version %d path %d", tt.nodeType, typ, version, path)
+		}
+	}
+}
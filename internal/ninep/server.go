@@ -0,0 +1,100 @@
+package ninep
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/netserver"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Server speaks 9P2000.L, so filesystems can be mounted with the in-tree
+// v9fs client:
+//
+//	mount -t 9p -o trans=tcp,port=5640,version=9p2000.L,aname=<token> <host> /mnt
+//
+// The attach name selects the token
+type Server struct {
+	service     service.FileSystemService
+	msize       uint32
+	maxInFlight int
+	maxReadSize uint32
+
+	// Serve and Shutdown
+	*netserver.Server
+}
+
+func NewServer(service service.FileSystemService, msize uint32, maxInFlight int, maxReadSize uint32) *Server {
+	s := &Server{
+		service:     service,
+		msize:       msize,
+		maxInFlight: maxInFlight,
+		maxReadSize: maxReadSize,
+	}
+	s.Server = netserver.New(s.serveConn)
+	return s
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	const op = "ninep.Server.serveConn"
+
+	ctx = logging.MakeContextWithRemoteAddr(ctx, conn.RemoteAddr().String())
+	logger := logging.GetLoggerFromContextWithOp(ctx, op).With(slog.String("remote_addr", conn.RemoteAddr().String()))
+	logger.Debug("Connection opened")
+	defer logger.Debug("Connection closed")
+
+	sess := newSession(s.service, s.msize, s.maxReadSize)
+	// Open handles must not outlive the connection
+	defer sess.clunkAll(ctx)
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	var writeMu sync.Mutex
+
+	reply := func(typ msgType, tag uint16, body []byte) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		if err := writeMessage(writer, typ, tag, body); err != nil {
+			logger.Warn("Failed to write reply", slogext.Err(err))
+			return
+		}
+		if err := writer.Flush(); err != nil {
+			logger.Warn("Failed to flush reply", slogext.Err(err))
+		}
+	}
+
+	inFlight := netserver.NewInFlight(s.maxInFlight)
+	defer inFlight.Wait()
+
+	for {
+		msg, err := readMessage(reader, sess.maxMessageSize())
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Failed to read message", slogext.Err(err))
+			}
+			return
+		}
+
+		// Tversion resets the session. Requests are never cancelled, so Tflush
+		// is answered once everything in flight has replied, as the spec
+		// requires for a flushed request that was already running
+		if msg.typ == tversion || msg.typ == tflush {
+			inFlight.Wait()
+			reply(sess.handle(ctx, msg))
+			continue
+		}
+
+		inFlight.Go(func() {
+			reqCtx := logging.MakeContextWithNewRequestID(ctx)
+			reply(sess.handle(reqCtx, msg))
+		})
+	}
+}
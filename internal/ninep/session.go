@@ -0,0 +1,151 @@
+package ninep
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+// fid is a client reference to a node. Path is kept to resolve ".." and to
+// refresh attributes, walking itself goes by inode number
+type fid struct {
+	token string
+	path  string
+	meta  models.NodeMeta
+	// Handle from service.Open, set by Tlopen/Tlcreate on files
+	fh     int64
+	opened bool
+}
+
+// session is the state of one connection
+type session struct {
+	service service.FileSystemService
+	// Longest Rread payload whatever msize was negotiated
+	maxReadSize uint32
+
+	mu    sync.Mutex
+	msize uint32
+	fids  map[uint32]*fid
+}
+
+func newSession(service service.FileSystemService, msize uint32, maxReadSize uint32) *session {
+	return &session{
+		service:     service,
+		maxReadSize: maxReadSize,
+		msize:       msize,
+		fids:        make(map[uint32]*fid),
+	}
+}
+
+func (s *session) maxMessageSize() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.msize
+}
+
+// iounit is the largest read/write payload that fits into a message
+func (s *session) iounit() uint32 {
+	return s.maxMessageSize() - ioHeaderSize
+}
+
+// get returns copy of fid state
+func (s *session) get(id uint32) (fid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.fids[id]
+	if !ok {
+		return fid{}, errBadFid
+	}
+	return *f, nil
+}
+
+// put binds id to f. With replace unset id must be free
+func (s *session) put(id uint32, f fid, replace bool) error {
+	if id == noFid {
+		return errBadFid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.fids[id]; ok && !replace {
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "fid already in use"}
+	}
+	s.fids[id] = &f
+	return nil
+}
+
+// remove drops fid and releases its handle
+func (s *session) remove(ctx context.Context, id uint32) (fid, error) {
+	s.mu.Lock()
+	f, ok := s.fids[id]
+	delete(s.fids, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return fid{}, errBadFid
+	}
+	if f.fh != 0 {
+		if err := s.service.Release(ctx, f.token, f.fh); err != nil {
+			return *f, err
+		}
+	}
+	return *f, nil
+}
+
+func (s *session) clunkAll(ctx context.Context) {
+	s.mu.Lock()
+	ids := make([]uint32, 0, len(s.fids))
+	for id := range s.fids {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		_, _ = s.remove(ctx, id)
+	}
+}
+
+// renamed rewrites paths of fids under oldPath after a rename through this session
+func (s *session) renamed(token string, oldPath string, newPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.fids {
+		if f.token != token {
+			continue
+		}
+		switch {
+		case f.path == oldPath:
+			f.path = newPath
+		case strings.HasPrefix(f.path, oldPath+"/"):
+			f.path = newPath + strings.TrimPrefix(f.path, oldPath)
+		}
+	}
+}
+
+// stat refreshes attributes of f. An open file that was unlinked in the
+// meantime keeps its last known attributes
+func (s *session) stat(ctx context.Context, f fid) (*models.NodeMeta, error) {
+	meta, err := s.service.ResolvePath(ctx, f.token, f.path)
+	if err == nil && meta.Ino == f.meta.Ino {
+		return meta, nil
+	}
+	if f.opened {
+		return &f.meta, nil
+	}
+	if err == nil {
+		return nil, &service.ServiceError{Code: kerrors.ENOENT, Message: "file was replaced"}
+	}
+	return nil, err
+}
+
+func childPath(dir string, name string) string {
+	return path.Join(dir, name)
+}
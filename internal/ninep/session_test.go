@@ -0,0 +1,184 @@
+package ninep
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service/servicetest"
+	pbinary "github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+const testMsize = 8192
+
+// testClient sends one request at a time over the client end of a pipe
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	tag  uint16
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+
+	server, conn := net.Pipe()
+	s := NewServer(servicetest.NewMemory(), testMsize, 4, 4096)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serveConn(context.Background(), server)
+	}()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+
+	return &testClient{t: t, conn: conn}
+}
+
+// call returns the reply body of a successful request or the errno of Rlerror
+func (c *testClient) call(typ msgType, body *pbinary.Encoder) (*pbinary.Decoder, uint32) {
+	c.t.Helper()
+
+	c.tag++
+	tag := c.tag
+	if typ == tversion {
+		tag = noTag
+	}
+	if err := writeMessage(c.conn, typ, tag, body.Bytes()); err != nil {
+		c.t.Fatalf("write %d: %v", typ, err)
+	}
+
+	reply, err := readMessage(c.conn, testMsize)
+	if err != nil {
+		c.t.Fatalf("read reply to %d: %v", typ, err)
+	}
+	if reply.tag != tag {
+		c.t.Fatalf("reply tag = %d, want %d", reply.tag, tag)
+	}
+
+	d := pbinary.NewDecoder(reply.body)
+	if reply.typ == rlerror {
+		return nil, d.Uint32()
+	}
+	if reply.typ != typ+1 {
+		c.t.Fatalf("reply type = %d, want %d", reply.typ, typ+1)
+	}
+	return d, 0
+}
+
+func (c *testClient) mustCall(typ msgType, body *pbinary.Encoder) *pbinary.Decoder {
+	c.t.Helper()
+
+	d, errno := c.call(typ, body)
+	if errno != 0 {
+		c.t.Fatalf("request %d failed with errno %d", typ, errno)
+	}
+	return d
+}
+
+func (c *testClient) walk(fid uint32, newFid uint32, names ...string) (uint16, uint32) {
+	c.t.Helper()
+
+	e := pbinary.NewEncoder().PutUint32(fid).PutUint32(newFid).PutUint16(uint16(len(names)))
+	for _, name := range names {
+		e.PutString(name)
+	}
+	d, errno := c.call(twalk, e)
+	if errno != 0 {
+		return 0, errno
+	}
+	return d.Uint16(), 0
+}
+
+func TestSession(t *testing.T) {
+	c := newTestClient(t)
+
+	d := c.mustCall(tversion, pbinary.NewEncoder().PutUint32(65536).PutString(protocolVersion))
+	if msize, version := d.Uint32(), d.String(); msize != testMsize || version != protocolVersion {
+		t.Fatalf("Rversion = %d %q", msize, version)
+	}
+
+	const root = 0
+	d = c.mustCall(tattach, pbinary.NewEncoder().PutUint32(root).PutUint32(noFid).PutString("user").PutString("token").PutUint32(0))
+	if typ := d.Uint8(); typ != qidTypeDir {
+		t.Fatalf("root qid type = %#x", typ)
+	}
+
+	// Create and write a file through a clone of the root fid
+	if n, errno := c.walk(root, 1); errno != 0 || n != 0 {
+		t.Fatalf("clone walk = %d qids, errno %d", n, errno)
+	}
+	d = c.mustCall(tlcreate, pbinary.NewEncoder().PutUint32(1).PutString("hello.txt").PutUint32(0o2).PutUint32(0o644).PutUint32(0))
+	if typ := d.Uint8(); typ != qidTypeFile {
+		t.Fatalf("created qid type = %#x", typ)
+	}
+
+	content := []byte("hello, 9p")
+	d = c.mustCall(twrite, pbinary.NewEncoder().PutUint32(1).PutUint64(0).PutBytes(content))
+	if n := d.Uint32(); n != uint32(len(content)) {
+		t.Fatalf("Rwrite count = %d", n)
+	}
+	c.mustCall(tclunk, pbinary.NewEncoder().PutUint32(1))
+
+	c.mustCall(tmkdir, pbinary.NewEncoder().PutUint32(root).PutString("sub").PutUint32(0o755).PutUint32(0))
+
+	// Walk to the file again and read it back
+	if n, errno := c.walk(root, 2, "sub", "..", "hello.txt"); errno != 0 || n != 3 {
+		t.Fatalf("walk = %d qids, errno %d", n, errno)
+	}
+	c.mustCall(tlopen, pbinary.NewEncoder().PutUint32(2).PutUint32(0))
+
+	d = c.mustCall(tread, pbinary.NewEncoder().PutUint32(2).PutUint64(0).PutUint32(100))
+	if data := d.Bytes(); string(data) != string(content) {
+		t.Fatalf("Rread = %q, want %q", data, content)
+	}
+	d = c.mustCall(tread, pbinary.NewEncoder().PutUint32(2).PutUint64(7).PutUint32(100))
+	if data := d.Bytes(); string(data) != "9p" {
+		t.Fatalf("Rread at offset 7 = %q", data)
+	}
+
+	// Walk from an open fid is refused
+	if _, errno := c.walk(2, 3); errno != uint32(kerrors.EINVAL) {
+		t.Fatalf("walk from open fid: errno %d, want EINVAL", errno)
+	}
+	c.mustCall(tclunk, pbinary.NewEncoder().PutUint32(2))
+
+	if _, errno := c.walk(root, 3, "missing"); errno != uint32(kerrors.ENOENT) {
+		t.Fatalf("walk to missing name: errno %d, want ENOENT", errno)
+	}
+
+	// Read the root directory
+	if _, errno := c.walk(root, 4); errno != 0 {
+		t.Fatalf("clone walk: errno %d", errno)
+	}
+	c.mustCall(tlopen, pbinary.NewEncoder().PutUint32(4).PutUint32(0))
+
+	var names []string
+	var offset uint64
+	for {
+		d = c.mustCall(treaddir, pbinary.NewEncoder().PutUint32(4).PutUint64(offset).PutUint32(4096))
+		entries := pbinary.NewDecoder(d.Bytes())
+		if entries.Remaining() == 0 {
+			break
+		}
+		for entries.Remaining() > 0 {
+			_ = entries.Fixed(13) // qid
+			offset = entries.Uint64()
+			_ = entries.Uint8() // type
+			names = append(names, entries.String())
+		}
+		if entries.Err() != nil {
+			t.Fatalf("decode Rreaddir: %v", entries.Err())
+		}
+	}
+	if len(names) != 2 || names[0] != "hello.txt" || names[1] != "sub" {
+		t.Fatalf("readdir = %v", names)
+	}
+	c.mustCall(tclunk, pbinary.NewEncoder().PutUint32(4))
+
+	if _, errno := c.call(tclunk, pbinary.NewEncoder().PutUint32(4)); errno == 0 {
+		t.Fatal("clunk of unknown fid succeeded")
+	}
+}
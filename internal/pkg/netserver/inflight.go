@@ -0,0 +1,32 @@
+package netserver
+
+import "sync"
+
+// InFlight bounds the number of requests of one connection that execute
+// concurrently and waits for them
+type InFlight struct {
+	slots   chan struct{}
+	pending sync.WaitGroup
+}
+
+func NewInFlight(limit int) *InFlight {
+	return &InFlight{slots: make(chan struct{}, limit)}
+}
+
+// Go runs fn in a new goroutine once fewer than limit requests are running
+func (f *InFlight) Go(fn func()) {
+	f.slots <- struct{}{}
+	f.pending.Add(1)
+	go func() {
+		defer func() {
+			<-f.slots
+			f.pending.Done()
+		}()
+		fn()
+	}()
+}
+
+// Wait blocks until every request started by Go has finished
+func (f *InFlight) Wait() {
+	f.pending.Wait()
+}
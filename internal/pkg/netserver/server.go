@@ -0,0 +1,96 @@
+package netserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// ConnHandler serves one connection until it is closed. The connection is
+// closed by Server once the handler returns
+type ConnHandler func(ctx context.Context, conn net.Conn)
+
+// Server accepts stream connections and serves each in its own goroutine.
+// It is the common part of the RPC, 9P and SFTP listeners, which supply
+// only their per-connection handler
+type Server struct {
+	handler ConnHandler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+}
+
+func New(handler ConnHandler) *Server {
+	return &Server{
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections until listener is closed by Shutdown
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	const op = "netserver.Server.Serve"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			logger.Error("Failed to accept connection", slogext.Err(err))
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handler(ctx, conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, closes open ones and waits for their handlers
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
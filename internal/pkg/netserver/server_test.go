@@ -0,0 +1,72 @@
+package netserver
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownClosesConnections(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan struct{})
+	s := New(func(ctx context.Context, conn net.Conn) {
+		close(served)
+		// Blocks until Shutdown closes the connection
+		_, _ = conn.Read(make([]byte, 1))
+	})
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.Serve(ctx, ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-served
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-serveErr; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+}
+
+func TestInFlightBound(t *testing.T) {
+	const limit = 3
+
+	f := NewInFlight(limit)
+	var running, peak atomic.Int32
+	for range 20 {
+		f.Go(func() {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	f.Wait()
+
+	if running.Load() != 0 {
+		t.Fatalf("%d requests still running after Wait", running.Load())
+	}
+	if peak.Load() > limit {
+		t.Fatalf("%d requests ran at once, want at most %d", peak.Load(), limit)
+	}
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+)
+
+type AuditRepository interface {
+	Insert(ctx context.Context, record *models.AuditRecord) error
+	// List returns matching records, newest first
+	List(ctx context.Context, filter models.AuditFilter) ([]models.AuditRecord, error)
+	DeleteOlderThan(ctx context.Context, age time.Duration) (int64, error)
+}
+
+type auditRepository struct {
+	db postgresql.Client
+}
+
+func NewAuditRepository(db postgresql.Client) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Insert(ctx context.Context, record *models.AuditRecord) error {
+	const op = "repository.auditRepository.Insert"
+
+	query := `
+		INSERT INTO audit_log (request_id, remote_addr, token, op, ino, parent_ino, name, new_parent_ino, new_name, code)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, at
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query,
+		record.RequestID, record.RemoteAddr, record.Token, record.Op,
+		record.Ino, record.ParentIno, record.Name, record.NewParentIno, record.NewName, record.Code,
+	).Scan(&record.ID, &record.Time)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *auditRepository) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditRecord, error) {
+	const op = "repository.auditRepository.List"
+
+	// NULL parameters disable their condition
+	query := `
+		SELECT id, at, request_id, remote_addr, token, op, ino, parent_ino, name, new_parent_ino, new_name, code
+		FROM audit_log
+		WHERE ($1::VARCHAR IS NULL OR token = $1)
+		  AND ($2::VARCHAR IS NULL OR op = $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR at >= $3)
+		  AND ($4::TIMESTAMPTZ IS NULL OR at < $4)
+		  AND ($5::BIGINT IS NULL OR id < $5)
+		ORDER BY id DESC
+		LIMIT $6
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query,
+		nullIfZero(filter.Token), nullIfZero(filter.Op),
+		nullIfZeroTime(filter.Since), nullIfZeroTime(filter.Until),
+		nullIfZero(filter.BeforeID), filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	records := []models.AuditRecord{}
+	for rows.Next() {
+		var rec models.AuditRecord
+		err := rows.Scan(
+			&rec.ID, &rec.Time, &rec.RequestID, &rec.RemoteAddr, &rec.Token, &rec.Op,
+			&rec.Ino, &rec.ParentIno, &rec.Name, &rec.NewParentIno, &rec.NewName, &rec.Code,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		records = append(records, rec)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return records, nil
+}
+
+func (r *auditRepository) DeleteOlderThan(ctx context.Context, age time.Duration) (int64, error) {
+	const op = "repository.auditRepository.DeleteOlderThan"
+
+	query := `
+		DELETE FROM audit_log
+		WHERE at < NOW() - $1::interval
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query, age)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func nullIfZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func nullIfZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
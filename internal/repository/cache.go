@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/lru"
+)
+
+// Caches below sit in front of the inode and directory repositories.
+//
+// Reads outside a transaction are served from the cache and fill it on a
+// miss. Reads inside a transaction always go to the database: they may see
+// the transaction's own uncommitted writes, which must never reach the
+// cache, and they keep the transaction's view consistent.
+//
+// Every mutation drops the affected keys right away and once more after
+// its transaction commits, so a reader that loaded the old row in between
+// cannot leave it behind (see lru.Cache.AddIfGeneration).
+
+type inodeKey struct {
+	token string
+	ino   int64
+}
+
+type direntKey struct {
+	token     string
+	parentIno int64
+	name      string
+}
+
+// MetadataCache holds cached inodes and directory entries shared by the
+// repositories it wraps, so that operations of one repository that change
+// rows of the other drop them as well
+type MetadataCache struct {
+	inodes *lru.Cache[inodeKey, models.Inode]
+	// Negative lookups are cached as zero ino
+	dirents *lru.Cache[direntKey, int64]
+}
+
+func NewMetadataCache(inodeEntries int, direntEntries int) *MetadataCache {
+	return &MetadataCache{
+		inodes:  lru.New[inodeKey, models.Inode](inodeEntries),
+		dirents: lru.New[direntKey, int64](direntEntries),
+	}
+}
+
+func (c *MetadataCache) InodeStats() lru.Stats {
+	return c.inodes.Stats()
+}
+
+func (c *MetadataCache) DirentStats() lru.Stats {
+	return c.dirents.Stats()
+}
+
+// InodeRepository caches Get, IsDir and IsFile of repo
+func (c *MetadataCache) InodeRepository(repo InodeRepository) InodeRepository {
+	return &cachedInodeRepository{InodeRepository: repo, cache: c}
+}
+
+// DirectoryRepository caches Lookup, Exists and LookupInode of repo
+func (c *MetadataCache) DirectoryRepository(repo DirectoryRepository) DirectoryRepository {
+	return &cachedDirectoryRepository{DirectoryRepository: repo, cache: c}
+}
+
+func (c *MetadataCache) invalidateInode(ctx context.Context, key inodeKey) {
+	c.inodes.Remove(key)
+	postgresql.AfterCommit(ctx, func() { c.inodes.Remove(key) })
+}
+
+func (c *MetadataCache) invalidateDirent(ctx context.Context, key direntKey) {
+	c.dirents.Remove(key)
+	postgresql.AfterCommit(ctx, func() { c.dirents.Remove(key) })
+}
+
+type cachedInodeRepository struct {
+	InodeRepository
+	cache *MetadataCache
+}
+
+func (r *cachedInodeRepository) Get(ctx context.Context, token string, ino int64) (*models.Inode, error) {
+	if postgresql.InTransaction(ctx) {
+		return r.InodeRepository.Get(ctx, token, ino)
+	}
+
+	key := inodeKey{token: token, ino: ino}
+	if inode, ok := r.cache.inodes.Get(key); ok {
+		return &inode, nil
+	}
+
+	gen := r.cache.inodes.Generation()
+	inode, err := r.InodeRepository.Get(ctx, token, ino)
+	if err != nil || inode == nil {
+		return inode, err
+	}
+	r.cache.inodes.AddIfGeneration(gen, key, *inode)
+	return inode, nil
+}
+
+func (r *cachedInodeRepository) IsDir(ctx context.Context, token string, ino int64) (bool, error) {
+	inode, err := r.Get(ctx, token, ino)
+	if err != nil || inode == nil {
+		return false, err
+	}
+	return inode.Type == models.NodeTypeDir, nil
+}
+
+func (r *cachedInodeRepository) IsFile(ctx context.Context, token string, ino int64) (bool, error) {
+	inode, err := r.Get(ctx, token, ino)
+	if err != nil || inode == nil {
+		return false, err
+	}
+	return inode.Type == models.NodeTypeFile, nil
+}
+
+func (r *cachedInodeRepository) Create(ctx context.Context, inode *models.Inode) error {
+	defer r.cache.invalidateInode(ctx, inodeKey{token: inode.Token, ino: inode.Ino})
+	return r.InodeRepository.Create(ctx, inode)
+}
+
+func (r *cachedInodeRepository) UpdateSize(ctx context.Context, token string, ino int64, size int64) error {
+	defer r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	return r.InodeRepository.UpdateSize(ctx, token, ino, size)
+}
+
+func (r *cachedInodeRepository) UpdateRefCount(ctx context.Context, token string, ino int64, delta int) error {
+	defer r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	return r.InodeRepository.UpdateRefCount(ctx, token, ino, delta)
+}
+
+func (r *cachedInodeRepository) Delete(ctx context.Context, token string, ino int64) error {
+	defer r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	return r.InodeRepository.Delete(ctx, token, ino)
+}
+
+// DeleteOrphans doesn't report which inodes it removed, so everything goes
+func (r *cachedInodeRepository) DeleteOrphans(ctx context.Context) (int64, error) {
+	defer func() {
+		r.cache.inodes.Purge()
+		postgresql.AfterCommit(ctx, r.cache.inodes.Purge)
+	}()
+	return r.InodeRepository.DeleteOrphans(ctx)
+}
+
+type cachedDirectoryRepository struct {
+	DirectoryRepository
+	cache *MetadataCache
+}
+
+func (r *cachedDirectoryRepository) Lookup(ctx context.Context, token string, parentIno int64, name string) (int64, error) {
+	if postgresql.InTransaction(ctx) {
+		return r.DirectoryRepository.Lookup(ctx, token, parentIno, name)
+	}
+
+	key := direntKey{token: token, parentIno: parentIno, name: name}
+	if ino, ok := r.cache.dirents.Get(key); ok {
+		return ino, nil
+	}
+
+	gen := r.cache.dirents.Generation()
+	ino, err := r.DirectoryRepository.Lookup(ctx, token, parentIno, name)
+	if err != nil {
+		return 0, err
+	}
+	r.cache.dirents.AddIfGeneration(gen, key, ino)
+	return ino, nil
+}
+
+func (r *cachedDirectoryRepository) Exists(ctx context.Context, token string, parentIno int64, name string) (bool, error) {
+	ino, err := r.Lookup(ctx, token, parentIno, name)
+	return ino != 0, err
+}
+
+func (r *cachedDirectoryRepository) CreateEntry(ctx context.Context, token string, parentIno int64, name string, ino int64) error {
+	defer r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: parentIno, name: name})
+	return r.DirectoryRepository.CreateEntry(ctx, token, parentIno, name, ino)
+}
+
+func (r *cachedDirectoryRepository) DeleteEntry(ctx context.Context, token string, parentIno int64, name string) error {
+	defer r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: parentIno, name: name})
+	return r.DirectoryRepository.DeleteEntry(ctx, token, parentIno, name)
+}
+
+// LookupInode is served from the cache only when parent, entry and inode are
+// all there, otherwise the query fills every one of them
+func (r *cachedDirectoryRepository) LookupInode(ctx context.Context, token string, parentIno int64, name string) (*models.Inode, *models.Inode, error) {
+	if postgresql.InTransaction(ctx) {
+		return r.DirectoryRepository.LookupInode(ctx, token, parentIno, name)
+	}
+
+	if parent, inode, ok := r.lookupCached(token, parentIno, name); ok {
+		return parent, inode, nil
+	}
+
+	inodeGen, direntGen := r.cache.inodes.Generation(), r.cache.dirents.Generation()
+	parent, inode, err := r.DirectoryRepository.LookupInode(ctx, token, parentIno, name)
+	if err != nil || parent == nil {
+		return parent, inode, err
+	}
+
+	r.cache.inodes.AddIfGeneration(inodeGen, inodeKey{token: token, ino: parentIno}, *parent)
+	if parent.Type != models.NodeTypeDir {
+		return parent, inode, nil
+	}
+
+	key := direntKey{token: token, parentIno: parentIno, name: name}
+	if inode == nil {
+		r.cache.dirents.AddIfGeneration(direntGen, key, 0)
+		return parent, nil, nil
+	}
+	r.cache.dirents.AddIfGeneration(direntGen, key, inode.Ino)
+	r.cache.inodes.AddIfGeneration(inodeGen, inodeKey{token: token, ino: inode.Ino}, *inode)
+	return parent, inode, nil
+}
+
+func (r *cachedDirectoryRepository) lookupCached(token string, parentIno int64, name string) (*models.Inode, *models.Inode, bool) {
+	parent, ok := r.cache.inodes.Get(inodeKey{token: token, ino: parentIno})
+	if !ok {
+		return nil, nil, false
+	}
+	if parent.Type != models.NodeTypeDir {
+		return &parent, nil, true
+	}
+
+	ino, ok := r.cache.dirents.Get(direntKey{token: token, parentIno: parentIno, name: name})
+	if !ok {
+		return nil, nil, false
+	}
+	if ino == 0 {
+		return &parent, nil, true
+	}
+
+	inode, ok := r.cache.inodes.Get(inodeKey{token: token, ino: ino})
+	if !ok {
+		return nil, nil, false
+	}
+	return &parent, &inode, true
+}
+
+func (r *cachedDirectoryRepository) CreateInode(ctx context.Context, parentIno int64, name string, inode *models.Inode) (EntryStatus, error) {
+	defer r.cache.invalidateDirent(ctx, direntKey{token: inode.Token, parentIno: parentIno, name: name})
+	return r.DirectoryRepository.CreateInode(ctx, parentIno, name, inode)
+}
+
+func (r *cachedDirectoryRepository) UnlinkFile(ctx context.Context, token string, parentIno int64, name string) (int64, int, EntryStatus, error) {
+	ino, refCount, status, err := r.DirectoryRepository.UnlinkFile(ctx, token, parentIno, name)
+	r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: parentIno, name: name})
+	if ino != 0 {
+		r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	}
+	return ino, refCount, status, err
+}
+
+func (r *cachedDirectoryRepository) RemoveDir(ctx context.Context, token string, parentIno int64, name string) (int64, EntryStatus, error) {
+	ino, status, err := r.DirectoryRepository.RemoveDir(ctx, token, parentIno, name)
+	r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: parentIno, name: name})
+	if ino != 0 {
+		r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	}
+	return ino, status, err
+}
+
+func (r *cachedDirectoryRepository) LinkFile(ctx context.Context, token string, ino int64, parentIno int64, name string) (EntryStatus, error) {
+	defer r.cache.invalidateInode(ctx, inodeKey{token: token, ino: ino})
+	defer r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: parentIno, name: name})
+	return r.DirectoryRepository.LinkFile(ctx, token, ino, parentIno, name)
+}
+
+func (r *cachedDirectoryRepository) RestoreEntry(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.TrashEntry, EntryStatus, error) {
+	entry, status, err := r.DirectoryRepository.RestoreEntry(ctx, token, id, parentIno, name)
+	if entry != nil {
+		r.cache.invalidateDirent(ctx, direntKey{token: token, parentIno: entry.ParentIno, name: entry.Name})
+	}
+	return entry, status, err
+}
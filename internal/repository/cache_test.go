@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+const testToken = "token"
+
+// fakeStore stands in for PostgreSQL under the cache. Every repository
+// method the cache forwards to is a single statement, so calls are counted
+// as statements
+type fakeStore struct {
+	inodes     map[int64]models.Inode
+	dirents    map[direntKey]int64
+	statements int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		inodes: map[int64]models.Inode{
+			1:  {Ino: 1, Token: testToken, Type: models.NodeTypeDir, Mode: 0o755, RefCount: 1},
+			10: {Ino: 10, Token: testToken, Type: models.NodeTypeFile, Mode: 0o644, Size: 5, RefCount: 1},
+		},
+		dirents: map[direntKey]int64{
+			{token: testToken, parentIno: 1, name: "file"}: 10,
+		},
+	}
+}
+
+type fakeInodeRepository struct {
+	InodeRepository
+	store *fakeStore
+}
+
+func (r *fakeInodeRepository) Get(ctx context.Context, token string, ino int64) (*models.Inode, error) {
+	r.store.statements++
+	inode, ok := r.store.inodes[ino]
+	if !ok {
+		return nil, nil
+	}
+	return &inode, nil
+}
+
+type fakeDirectoryRepository struct {
+	DirectoryRepository
+	store *fakeStore
+}
+
+func (r *fakeDirectoryRepository) LookupInode(ctx context.Context, token string, parentIno int64, name string) (*models.Inode, *models.Inode, error) {
+	r.store.statements++
+	parent, ok := r.store.inodes[parentIno]
+	if !ok {
+		return nil, nil, nil
+	}
+	ino, ok := r.store.dirents[direntKey{token: token, parentIno: parentIno, name: name}]
+	if !ok {
+		return &parent, nil, nil
+	}
+	inode := r.store.inodes[ino]
+	return &parent, &inode, nil
+}
+
+func (r *fakeDirectoryRepository) UnlinkFile(ctx context.Context, token string, parentIno int64, name string) (int64, int, EntryStatus, error) {
+	r.store.statements++
+	key := direntKey{token: token, parentIno: parentIno, name: name}
+	ino, ok := r.store.dirents[key]
+	if !ok {
+		return 0, 0, EntryNotFound, nil
+	}
+	delete(r.store.dirents, key)
+	delete(r.store.inodes, ino)
+	return ino, 0, EntryOK, nil
+}
+
+func newRepositories(store *fakeStore, cached bool) (InodeRepository, DirectoryRepository) {
+	var inodeRepo InodeRepository = &fakeInodeRepository{store: store}
+	var dirRepo DirectoryRepository = &fakeDirectoryRepository{store: store}
+	if cached {
+		cache := NewMetadataCache(16, 16)
+		inodeRepo, dirRepo = cache.InodeRepository(inodeRepo), cache.DirectoryRepository(dirRepo)
+	}
+	return inodeRepo, dirRepo
+}
+
+// TestCacheStatements counts statements of a repeated lookup and of the
+// metadata part of a read (file contents aren't cached, so a read adds one
+// more) once the cache is warm
+func TestCacheStatements(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name    string
+		cached  bool
+		lookup  int
+		getAttr int
+	}{
+		{name: "cache off", cached: false, lookup: 1, getAttr: 1},
+		{name: "cache on", cached: true, lookup: 0, getAttr: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			inodeRepo, dirRepo := newRepositories(store, tt.cached)
+
+			if _, _, err := dirRepo.LookupInode(ctx, testToken, 1, "file"); err != nil {
+				t.Fatal(err)
+			}
+
+			store.statements = 0
+			_, inode, err := dirRepo.LookupInode(ctx, testToken, 1, "file")
+			if err != nil || inode == nil || inode.Ino != 10 {
+				t.Fatalf("LookupInode = %+v, %v, want ino 10", inode, err)
+			}
+			if store.statements != tt.lookup {
+				t.Errorf("lookup took %d statements, want %d", store.statements, tt.lookup)
+			}
+
+			store.statements = 0
+			if inode, err = inodeRepo.Get(ctx, testToken, 10); err != nil || inode == nil {
+				t.Fatalf("Get = %+v, %v, want inode", inode, err)
+			}
+			if store.statements != tt.getAttr {
+				t.Errorf("get took %d statements, want %d", store.statements, tt.getAttr)
+			}
+		})
+	}
+}
+
+func TestCacheInvalidatedByUnlink(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	inodeRepo, dirRepo := newRepositories(store, true)
+
+	if _, _, err := dirRepo.LookupInode(ctx, testToken, 1, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, status, err := dirRepo.UnlinkFile(ctx, testToken, 1, "file"); err != nil || status != EntryOK {
+		t.Fatalf("UnlinkFile = %v, %v", status, err)
+	}
+
+	_, inode, err := dirRepo.LookupInode(ctx, testToken, 1, "file")
+	if err != nil || inode != nil {
+		t.Errorf("LookupInode after unlink = %+v, %v, want nothing", inode, err)
+	}
+	if inode, err = inodeRepo.Get(ctx, testToken, 10); err != nil || inode != nil {
+		t.Errorf("Get after unlink = %+v, %v, want nothing", inode, err)
+	}
+}
+
+func BenchmarkLookupInode(b *testing.B) {
+	ctx := context.Background()
+
+	for _, bb := range []struct {
+		name   string
+		cached bool
+	}{
+		{name: "cache=off", cached: false},
+		{name: "cache=on", cached: true},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			store := newFakeStore()
+			_, dirRepo := newRepositories(store, bb.cached)
+
+			for b.Loop() {
+				if _, _, err := dirRepo.LookupInode(ctx, testToken, 1, "file"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(store.statements)/float64(b.N), "statements/op")
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+)
+
+// ChunkSize is the size of content chunks, all but the last chunk of a file
+// are full. Changing it makes existing files share nothing with new ones
+const ChunkSize = 64 << 10
+
+// splitChunks cuts data into chunks and returns them with their SHA-256
+func splitChunks(data []byte) (hashes [][]byte, chunks [][]byte) {
+	n := (len(data) + ChunkSize - 1) / ChunkSize
+	hashes = make([][]byte, 0, n)
+	chunks = make([][]byte, 0, n)
+	for start := 0; start < len(data); start += ChunkSize {
+		chunk := data[start:min(start+ChunkSize, len(data))]
+		hash := sha256.Sum256(chunk)
+		hashes = append(hashes, hash[:])
+		chunks = append(chunks, chunk)
+	}
+	return hashes, chunks
+}
+
+// lockDroppedChunks is a CTE that locks every chunk of contents and
+// versions of the inodes listed by a preceding CTE dropped(token, ino), in
+// hash order like contentRepository.apply does. A statement deleting those
+// inodes or their chunk lists joins it, so the chunks are locked before
+// the triggers release them and such statements can't deadlock with writes
+const lockDroppedChunks = `
+	locked AS (
+		SELECT hash
+		FROM chunks
+		WHERE hash IN (
+			SELECT f.hash
+			FROM file_chunks f
+			JOIN dropped d ON d.token = f.token AND d.ino = f.ino
+			UNION
+			SELECT vc.hash
+			FROM version_chunks vc
+			JOIN file_versions v ON v.id = vc.version_id
+			JOIN dropped d ON d.token = v.token AND d.ino = v.ino
+		)
+		ORDER BY hash
+		FOR NO KEY UPDATE
+	)`
+
+// ChunkRepository manages chunks shared by file contents and versions.
+// Chunks are reference-counted by the database on every change of
+// file_chunks and version_chunks, here they are only collected and reported
+type ChunkRepository interface {
+	// DeleteUnreferenced deletes at most limit chunks no file refers to
+	DeleteUnreferenced(ctx context.Context, limit int) (int64, error)
+	Report(ctx context.Context) (*models.DedupReport, error)
+}
+
+type chunkRepository struct {
+	db postgresql.Client
+}
+
+func NewChunkRepository(db postgresql.Client) ChunkRepository {
+	return &chunkRepository{db: db}
+}
+
+func (r *chunkRepository) DeleteUnreferenced(ctx context.Context, limit int) (int64, error) {
+	const op = "repository.chunkRepository.DeleteUnreferenced"
+
+	// The outer ref_count check is re-evaluated on the latest row if a
+	// writer referenced the chunk meanwhile, so such a chunk is skipped.
+	// Chunks locked by writers are skipped too, the collector never waits
+	query := `
+		DELETE FROM chunks
+		WHERE ref_count = 0
+		  AND hash IN (
+			SELECT hash
+			FROM chunks
+			WHERE ref_count = 0
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (r *chunkRepository) Report(ctx context.Context) (*models.DedupReport, error) {
+	const op = "repository.chunkRepository.Report"
+
+	report := &models.DedupReport{ChunkSize: ChunkSize, Filesystems: []models.FilesystemDedup{}}
+
+	totalsQuery := `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(size * ref_count), 0)::BIGINT,
+			COALESCE(SUM(size), 0),
+			COALESCE(SUM(LENGTH(data)), 0),
+			COUNT(*) FILTER (WHERE ref_count = 0),
+			COALESCE(SUM(size) FILTER (WHERE ref_count = 0), 0)
+		FROM chunks
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, totalsQuery).Scan(
+		&report.Chunks,
+		&report.LogicalBytes,
+		&report.StoredBytes,
+		&report.PhysicalBytes,
+		&report.GarbageChunks,
+		&report.GarbageBytes,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	report.Ratio = dedupRatio(report.LogicalBytes, report.StoredBytes-report.GarbageBytes)
+	report.CompressionRatio = dedupRatio(report.StoredBytes, report.PhysicalBytes)
+
+	filesystemsQuery := `
+		SELECT token, SUM(logical)::BIGINT, SUM(size)::BIGINT, SUM(physical)::BIGINT
+		FROM (
+			SELECT refs.token, c.size, COUNT(*) * c.size AS logical, LENGTH(c.data) AS physical
+			FROM (
+				SELECT token, hash FROM file_chunks
+				UNION ALL
+				SELECT v.token, vc.hash
+				FROM version_chunks vc
+				JOIN file_versions v ON v.id = vc.version_id
+			) refs
+			JOIN chunks c ON c.hash = refs.hash
+			GROUP BY refs.token, c.hash
+		) per_chunk
+		GROUP BY token
+		ORDER BY token
+	`
+
+	rows, err := db.Query(ctx, filesystemsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fs models.FilesystemDedup
+		if err := rows.Scan(&fs.Token, &fs.LogicalBytes, &fs.StoredBytes, &fs.PhysicalBytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		fs.Ratio = dedupRatio(fs.LogicalBytes, fs.StoredBytes)
+		fs.CompressionRatio = dedupRatio(fs.StoredBytes, fs.PhysicalBytes)
+		report.Filesystems = append(report.Filesystems, fs)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+func dedupRatio(logical int64, stored int64) float64 {
+	if stored == 0 {
+		return 1
+	}
+	return float64(logical) / float64(stored)
+}
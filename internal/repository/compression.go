@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Encoding is how a chunk is stored, chunks.encoding
+type Encoding int16
+
+const (
+	EncodingNone Encoding = 0
+	EncodingGzip Encoding = 1
+)
+
+// ParseEncoding accepts the names used in config: none and gzip
+func ParseEncoding(name string) (Encoding, error) {
+	switch name {
+	case "", "none":
+		return EncodingNone, nil
+	case "gzip":
+		return EncodingGzip, nil
+	}
+	return 0, fmt.Errorf("unknown compression %q, want none or gzip", name)
+}
+
+// Compression picks the encoding of chunks written by each filesystem.
+// Chunks are shared by hash of their plain data, so a chunk keeps the
+// encoding of the filesystem that stored it first
+type Compression struct {
+	defaultEncoding Encoding
+	filesystems     map[string]Encoding
+}
+
+// NewCompression builds the policy from encoding names, filesystems maps
+// tokens to their encoding, others get defaultName
+func NewCompression(defaultName string, filesystems map[string]string) (*Compression, error) {
+	defaultEncoding, err := ParseEncoding(defaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Compression{defaultEncoding: defaultEncoding, filesystems: make(map[string]Encoding, len(filesystems))}
+	for token, name := range filesystems {
+		if c.filesystems[token], err = ParseEncoding(name); err != nil {
+			return nil, fmt.Errorf("filesystem %q: %w", token, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Compression) encodingFor(token string) Encoding {
+	if c == nil {
+		return EncodingNone
+	}
+	if encoding, ok := c.filesystems[token]; ok {
+		return encoding
+	}
+	return c.defaultEncoding
+}
+
+// encodeChunk compresses chunk with encoding. Chunks that don't get smaller
+// are stored as is
+func encodeChunk(encoding Encoding, chunk []byte) ([]byte, Encoding) {
+	if encoding != EncodingGzip || len(chunk) == 0 {
+		return chunk, EncodingNone
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(chunk); err != nil {
+		return chunk, EncodingNone
+	}
+	if err := zw.Close(); err != nil || buf.Len() >= len(chunk) {
+		return chunk, EncodingNone
+	}
+
+	return buf.Bytes(), EncodingGzip
+}
+
+func decodeChunk(encoding Encoding, data []byte) ([]byte, error) {
+	switch encoding {
+	case EncodingNone:
+		return data, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown chunk encoding %d", encoding)
+}
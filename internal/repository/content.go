@@ -1,98 +1,436 @@
 package repository
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"crypto/sha256"
 	"fmt"
 
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
-	"github.com/jackc/pgx/v5"
 )
 
+// ContentRepository stores file data as ChunkSize chunks shared by all
+// files with the same bytes, see ChunkRepository. Chunks may be compressed,
+// data going in and out is always plain.
+//
+// Every change of a versioned file is also stored as a new version, and
+// versions beyond the file's limit are dropped. A version is a list of
+// chunks like the file itself, so it shares the chunks it didn't change.
+// Write and Truncate need the current size of the file: call them in a
+// transaction that locked the inode (InodeRepository.GetForUpdate)
 type ContentRepository interface {
-	Get(ctx context.Context, token string, ino int64) ([]byte, error)
 	GetRange(ctx context.Context, token string, ino int64, offset int64, length int64) ([]byte, error)
+	// Set replaces content. Chunks that didn't change are neither encoded
+	// nor sent, so call it in a transaction that locked the inode too
 	Set(ctx context.Context, token string, ino int64, data []byte) error
+	// Write puts data at offset of ino, which is size bytes long, extending
+	// it with zeros up to offset if needed. Only the chunks the write
+	// overlaps are read and stored
+	Write(ctx context.Context, token string, ino int64, size int64, data []byte, offset int64) error
+	// Truncate cuts ino from size bytes down to newSize or extends it with zeros
+	Truncate(ctx context.Context, token string, ino int64, size int64, newSize int64) error
 	Delete(ctx context.Context, token string, ino int64) error
+	// SetKeepVersions sets how many versions of ino are kept, 0 disables
+	// versioning. Versions beyond the limit are dropped right away. It
+	// returns false if ino doesn't exist
+	SetKeepVersions(ctx context.Context, token string, ino int64, keep int) (bool, error)
+	// ListVersions returns versions of ino, oldest first
+	ListVersions(ctx context.Context, token string, ino int64) ([]models.FileVersion, error)
+	// GetVersion returns data of version id of ino and false if there is no such version
+	GetVersion(ctx context.Context, token string, ino int64, id int64) ([]byte, bool, error)
 }
 
 type contentRepository struct {
-	db postgresql.Client
+	db          postgresql.Client
+	compression *Compression
 }
 
-func NewContentRepository(db postgresql.Client) ContentRepository {
-	return &contentRepository{db: db}
+// NewContentRepository stores chunks as compression says, nil stores them plain
+func NewContentRepository(db postgresql.Client, compression *Compression) ContentRepository {
+	return &contentRepository{db: db, compression: compression}
 }
 
-func (r *contentRepository) Get(ctx context.Context, token string, ino int64) ([]byte, error) {
-	const op = "repository.contentRepository.Get"
+// chunkEdit is the new content of chunk idx
+type chunkEdit struct {
+	idx  int32
+	hash []byte
+	data []byte
+}
+
+func (r *contentRepository) GetRange(ctx context.Context, token string, ino int64, offset int64, length int64) ([]byte, error) {
+	const op = "repository.contentRepository.GetRange"
+
+	if length <= 0 {
+		return []byte{}, nil
+	}
 
+	// Only chunks overlapping the range leave the database
+	first := offset / ChunkSize
+	last := (offset + length - 1) / ChunkSize
+	data, err := r.readChunks(ctx, token, ino, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	start := min(offset-first*ChunkSize, int64(len(data)))
+	end := min(start+length, int64(len(data)))
+	return data[start:end], nil
+}
+
+// readChunks returns plain data of chunks first..last of ino joined together
+func (r *contentRepository) readChunks(ctx context.Context, token string, ino int64, first int64, last int64) ([]byte, error) {
 	query := `
-		SELECT data
-		FROM file_contents
-		WHERE token = $1 AND ino = $2
+		SELECT c.encoding, c.data
+		FROM file_chunks f
+		JOIN chunks c ON c.hash = f.hash
+		WHERE f.token = $1 AND f.ino = $2 AND f.idx BETWEEN $3 AND $4
+		ORDER BY f.idx
 	`
 
-	var data []byte
 	db := postgresql.GetDBClient(ctx, r.db)
-	err := db.QueryRow(ctx, query, token, ino).Scan(&data)
+	rows, err := db.Query(ctx, query, token, ino, first, last)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return []byte{}, nil
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := []byte{}
+	for rows.Next() {
+		var encoding Encoding
+		var stored []byte
+		if err := rows.Scan(&encoding, &stored); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		chunk, err := decodeChunk(encoding, stored)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return data, nil
 }
 
-func (r *contentRepository) GetRange(ctx context.Context, token string, ino int64, offset int64, length int64) ([]byte, error) {
-	const op = "repository.contentRepository.GetRange"
+// readChunkMap returns plain data of chunks idxs of ino by index. Chunks
+// past the end of the file are missing from the map
+func (r *contentRepository) readChunkMap(ctx context.Context, token string, ino int64, idxs []int32) (map[int32][]byte, error) {
+	query := `
+		SELECT f.idx, c.encoding, c.data
+		FROM file_chunks f
+		JOIN chunks c ON c.hash = f.hash
+		WHERE f.token = $1 AND f.ino = $2 AND f.idx = ANY($3::INTEGER[])
+	`
 
-	data, err := r.Get(ctx, token, ino)
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query, token, ino, idxs)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	dataLen := int64(len(data))
-	if offset >= dataLen {
-		return []byte{}, nil
+	chunks := make(map[int32][]byte, len(idxs))
+	for rows.Next() {
+		var idx int32
+		var encoding Encoding
+		var stored []byte
+		if err := rows.Scan(&idx, &encoding, &stored); err != nil {
+			return nil, err
+		}
+		if chunks[idx], err = decodeChunk(encoding, stored); err != nil {
+			return nil, err
+		}
 	}
 
-	available := dataLen - offset
-	toRead := length
-	if toRead > available {
-		toRead = available
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return data[offset : offset+toRead], nil
+	return chunks, nil
 }
 
-func (r *contentRepository) Set(ctx context.Context, token string, ino int64, data []byte) error {
-	const op = "repository.contentRepository.Set"
-
+// readChunkHashes returns hashes of all chunks of ino by index
+func (r *contentRepository) readChunkHashes(ctx context.Context, token string, ino int64) (map[int32][]byte, error) {
 	query := `
-		INSERT INTO file_contents (token, ino, data)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (token, ino)
-		DO UPDATE SET data = EXCLUDED.data
+		SELECT idx, hash
+		FROM file_chunks
+		WHERE token = $1 AND ino = $2
 	`
 
 	db := postgresql.GetDBClient(ctx, r.db)
-	_, err := db.Exec(ctx, query, token, ino, data)
+	rows, err := db.Query(ctx, query, token, ino)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[int32][]byte)
+	for rows.Next() {
+		var idx int32
+		var hash []byte
+		if err := rows.Scan(&idx, &hash); err != nil {
+			return nil, err
+		}
+		hashes[idx] = hash
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+func (r *contentRepository) Set(ctx context.Context, token string, ino int64, data []byte) error {
+	const op = "repository.contentRepository.Set"
+
+	current, err := r.readChunkHashes(ctx, token, ino)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Chunks already mapped at their index stay as they are
+	hashes, chunks := splitChunks(data)
+	edits := make([]chunkEdit, 0, len(chunks))
+	for i := range chunks {
+		if bytes.Equal(current[int32(i)], hashes[i]) {
+			continue
+		}
+		edits = append(edits, chunkEdit{idx: int32(i), hash: hashes[i], data: chunks[i]})
+	}
+
+	if err := r.apply(ctx, token, ino, edits, int64(len(data))); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *contentRepository) Write(ctx context.Context, token string, ino int64, size int64, data []byte, offset int64) error {
+	const op = "repository.contentRepository.Write"
+
+	newSize := max(size, offset+int64(len(data)))
+	edits, err := r.rewrite(ctx, token, ino, size, newSize, data, offset)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := r.apply(ctx, token, ino, edits, newSize); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *contentRepository) Truncate(ctx context.Context, token string, ino int64, size int64, newSize int64) error {
+	const op = "repository.contentRepository.Truncate"
+
+	edits, err := r.rewrite(ctx, token, ino, size, newSize, nil, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := r.apply(ctx, token, ino, edits, newSize); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	return nil
 }
 
+// rewrite returns new contents of the chunks changed by resizing a file
+// from size to newSize and putting data at offset. Bytes between the old
+// end and offset are zeros. The changed bytes are contiguous, so only the
+// first and the last changed chunk can keep old bytes, and only they are
+// read. Chunks of zeros are hashed once per length however many there are
+func (r *contentRepository) rewrite(ctx context.Context, token string, ino int64, size int64, newSize int64, data []byte, offset int64) ([]chunkEdit, error) {
+	// Changed byte range [lo, hi). A cut inside a chunk changes that chunk
+	lo, hi := newSize, int64(0)
+	if newSize > size {
+		lo, hi = size, newSize
+	}
+	if newSize < size && newSize%ChunkSize != 0 {
+		lo, hi = min(lo, newSize-1), max(hi, newSize)
+	}
+	if len(data) > 0 {
+		lo, hi = min(lo, offset), max(hi, offset+int64(len(data)))
+	}
+	if lo >= hi {
+		return nil, nil
+	}
+
+	first, last := int32(lo/ChunkSize), int32((hi-1)/ChunkSize)
+	old, err := r.readChunkMap(ctx, token, ino, []int32{first, last})
+	if err != nil {
+		return nil, err
+	}
+
+	zeros := make(map[int64]chunkEdit)
+	edits := make([]chunkEdit, 0, last-first+1)
+	for idx := first; idx <= last; idx++ {
+		start := int64(idx) * ChunkSize
+		length := min(ChunkSize, newSize-start)
+		kept := old[idx][:min(int64(len(old[idx])), length)]
+		dataStart, dataEnd := max(offset, start), min(offset+int64(len(data)), start+length)
+
+		if len(kept) == 0 && dataStart >= dataEnd {
+			zero, ok := zeros[length]
+			if !ok {
+				zero.data = make([]byte, length)
+				hash := sha256.Sum256(zero.data)
+				zero.hash = hash[:]
+				zeros[length] = zero
+			}
+			zero.idx = idx
+			edits = append(edits, zero)
+			continue
+		}
+
+		chunk := make([]byte, length)
+		copy(chunk, kept)
+		if dataStart < dataEnd {
+			copy(chunk[dataStart-start:], data[dataStart-offset:dataEnd-offset])
+		}
+		hash := sha256.Sum256(chunk)
+		edits = append(edits, chunkEdit{idx: idx, hash: hash[:], data: chunk})
+	}
+
+	return edits, nil
+}
+
+// apply maps edits into ino, drops chunks past size and, for a versioned
+// file, stores the result as a new version. Each distinct chunk is encoded
+// and sent once
+func (r *contentRepository) apply(ctx context.Context, token string, ino int64, edits []chunkEdit, size int64) error {
+	// Hashes are of plain data, so equal chunks are shared however they are stored
+	encoding := r.compression.encodingFor(token)
+
+	idxs := make([]int32, len(edits))
+	editHashes := make([][]byte, len(edits))
+	var hashes, chunks [][]byte
+	var encodings []int16
+	var sizes []int32
+	seen := make(map[string]bool, len(edits))
+	for i, edit := range edits {
+		idxs[i], editHashes[i] = edit.idx, edit.hash
+		if seen[string(edit.hash)] {
+			continue
+		}
+		seen[string(edit.hash)] = true
+
+		chunk, chunkEncoding := encodeChunk(encoding, edit.data)
+		hashes = append(hashes, edit.hash)
+		chunks = append(chunks, chunk)
+		encodings = append(encodings, int16(chunkEncoding))
+		sizes = append(sizes, int32(len(edit.data)))
+	}
+	count := (size + ChunkSize - 1) / ChunkSize
+
+	// Every chunk whose ref_count this statement changes through the
+	// triggers (new ones, replaced or cut off ones, the whole file when a
+	// version is taken, chunks of dropped versions) is locked by locked
+	// first, in hash order, and stored waits for it. That keeps the
+	// collector from deleting a chunk before it is referenced, and two
+	// writers going through here from deadlocking on chunks that existed
+	// when they started, or with deletions, which lock the chunks they
+	// release the same way (lockDroppedChunks). The one case order can't
+	// cover is a chunk first inserted by a concurrent writer, stored waits
+	// for that writer instead: the deadlock fails one transaction and
+	// WithTransaction runs it again.
+	// mapped leaves unchanged chunks alone. version is built from the
+	// chunks before this statement with edits applied, and pruned sees the
+	// versions from before this statement, so it keeps keep - 1 of them
+	// next to the new one
+	query := `
+		WITH split AS (
+			SELECT n.hash, n.data, n.encoding, n.size
+			FROM UNNEST($3::BYTEA[], $4::BYTEA[], $5::SMALLINT[], $6::INTEGER[])
+				AS n(hash, data, encoding, size)
+		), edits AS (
+			SELECT n.idx, n.hash
+			FROM UNNEST($7::INTEGER[], $8::BYTEA[]) AS n(idx, hash)
+		), current AS (
+			SELECT idx, hash
+			FROM file_chunks
+			WHERE token = $1 AND ino = $2
+		), setting AS (
+			SELECT keep_versions AS keep
+			FROM inodes
+			WHERE token = $1 AND ino = $2 AND keep_versions > 0
+		), expired AS (
+			SELECT v.id
+			FROM file_versions v, setting s
+			WHERE v.token = $1 AND v.ino = $2
+			ORDER BY v.id DESC
+			OFFSET (SELECT keep - 1 FROM setting)
+		), locked AS (
+			SELECT hash
+			FROM chunks
+			WHERE hash IN (
+				SELECT hash FROM split
+				UNION
+				SELECT hash FROM current
+				WHERE idx >= $9 OR idx = ANY($7::INTEGER[]) OR EXISTS (SELECT 1 FROM setting)
+				UNION
+				SELECT hash FROM version_chunks
+				WHERE version_id IN (SELECT id FROM expired)
+			)
+			ORDER BY hash
+			FOR NO KEY UPDATE
+		), stored AS (
+			INSERT INTO chunks (hash, data, size, encoding)
+			SELECT s.hash, s.data, s.size, s.encoding
+			FROM split s, (SELECT COUNT(*) FROM locked) l
+			ORDER BY s.hash
+			ON CONFLICT (hash) DO NOTHING
+		), mapped AS (
+			INSERT INTO file_chunks (token, ino, idx, hash)
+			SELECT $1, $2, idx, hash
+			FROM edits
+			ON CONFLICT (token, ino, idx)
+			DO UPDATE SET hash = EXCLUDED.hash WHERE file_chunks.hash <> EXCLUDED.hash
+		), truncated AS (
+			DELETE FROM file_chunks
+			WHERE token = $1 AND ino = $2 AND idx >= $9
+		), version AS (
+			INSERT INTO file_versions (token, ino, size)
+			SELECT $1, $2, $10
+			FROM setting
+			RETURNING id
+		), version_chunked AS (
+			INSERT INTO version_chunks (version_id, idx, hash)
+			SELECT v.id, c.idx, c.hash
+			FROM version v, (
+				SELECT idx, hash FROM current
+				WHERE idx < $9 AND idx <> ALL($7::INTEGER[])
+				UNION ALL
+				SELECT idx, hash FROM edits
+			) c
+		), pruned AS (
+			DELETE FROM file_versions
+			WHERE id IN (SELECT id FROM expired)
+		)
+		SELECT (SELECT COUNT(*) FROM locked)
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	_, err := db.Exec(ctx, query, token, ino, hashes, chunks, encodings, sizes, idxs, editHashes, count, size)
+	return err
+}
+
 func (r *contentRepository) Delete(ctx context.Context, token string, ino int64) error {
 	const op = "repository.contentRepository.Delete"
 
 	query := `
-		DELETE FROM file_contents
-		WHERE token = $1 AND ino = $2
+		WITH dropped AS (
+			SELECT $1::VARCHAR AS token, $2::BIGINT AS ino
+		), ` + lockDroppedChunks + `
+		DELETE FROM file_chunks f
+		USING (SELECT COUNT(*) FROM locked) l
+		WHERE f.token = $1 AND f.ino = $2
 	`
 
 	db := postgresql.GetDBClient(ctx, r.db)
@@ -103,3 +441,125 @@ func (r *contentRepository) Delete(ctx context.Context, token string, ino int64)
 
 	return nil
 }
+
+func (r *contentRepository) SetKeepVersions(ctx context.Context, token string, ino int64, keep int) (bool, error) {
+	const op = "repository.contentRepository.SetKeepVersions"
+
+	// Chunks of dropped versions are locked in hash order as in apply
+	query := `
+		WITH setting AS (
+			UPDATE inodes
+			SET keep_versions = $3
+			WHERE token = $1 AND ino = $2
+			RETURNING ino
+		), expired AS (
+			SELECT id
+			FROM file_versions
+			WHERE token = $1 AND ino = $2
+			ORDER BY id DESC
+			OFFSET $3
+		), locked AS (
+			SELECT hash
+			FROM chunks
+			WHERE hash IN (
+				SELECT hash FROM version_chunks
+				WHERE version_id IN (SELECT id FROM expired)
+			)
+			ORDER BY hash
+			FOR NO KEY UPDATE
+		), pruned AS (
+			DELETE FROM file_versions
+			WHERE id IN (SELECT id FROM expired)
+		)
+		SELECT EXISTS(SELECT 1 FROM setting), (SELECT COUNT(*) FROM locked)
+	`
+
+	var found bool
+	var locked int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, ino, keep).Scan(&found, &locked)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return found, nil
+}
+
+func (r *contentRepository) ListVersions(ctx context.Context, token string, ino int64) ([]models.FileVersion, error) {
+	const op = "repository.contentRepository.ListVersions"
+
+	query := `
+		SELECT id, size, created_at
+		FROM file_versions
+		WHERE token = $1 AND ino = $2
+		ORDER BY id
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query, token, ino)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	versions := []models.FileVersion{}
+	for rows.Next() {
+		var version models.FileVersion
+		if err := rows.Scan(&version.ID, &version.Size, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		versions = append(versions, version)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return versions, nil
+}
+
+func (r *contentRepository) GetVersion(ctx context.Context, token string, ino int64, id int64) ([]byte, bool, error) {
+	const op = "repository.contentRepository.GetVersion"
+
+	// An empty version has no chunks and comes as a single row of NULLs
+	query := `
+		SELECT c.encoding, c.data
+		FROM file_versions v
+		LEFT JOIN version_chunks vc ON vc.version_id = v.id
+		LEFT JOIN chunks c ON c.hash = vc.hash
+		WHERE v.token = $1 AND v.ino = $2 AND v.id = $3
+		ORDER BY vc.idx
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query, token, ino, id)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	data := []byte{}
+	found := false
+	for rows.Next() {
+		found = true
+		var encoding *Encoding
+		var stored []byte
+		if err := rows.Scan(&encoding, &stored); err != nil {
+			return nil, false, fmt.Errorf("%s: %w", op, err)
+		}
+		if encoding == nil {
+			continue
+		}
+		chunk, err := decodeChunk(*encoding, stored)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", op, err)
+		}
+		data = append(data, chunk...)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return data, found, nil
+}
@@ -8,6 +8,24 @@ import (
 	"github.com/S1riyS/os-course-lab-4/server/internal/models"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// EntryStatus tells why a combined directory operation changed nothing
+type EntryStatus int
+
+const (
+	EntryOK EntryStatus = iota
+	// Parent is missing or is not a directory
+	EntryParentNotDir
+	// Name is already taken
+	EntryExists
+	// Name or target inode doesn't exist
+	EntryNotFound
+	// Inode has the wrong type for the operation
+	EntryWrongType
+	// Directory still has entries
+	EntryNotEmpty
 )
 
 type DirectoryRepository interface {
@@ -18,6 +36,43 @@ type DirectoryRepository interface {
 	GetEntryByOffset(ctx context.Context, token string, parentIno int64, offset uint64) (*models.Dirent, error)
 	IsEmpty(ctx context.Context, token string, dirIno int64) (bool, error)
 	Exists(ctx context.Context, token string, parentIno int64, name string) (bool, error)
+	// ResolvePath walks names starting at rootIno in a single query. It returns
+	// number of components resolved, the last inode reached and its parent
+	ResolvePath(ctx context.Context, token string, rootIno int64, names []string) (int, int64, int64, error)
+	// IsAncestor reports whether ancestorIno is ino itself or one of its parents
+	IsAncestor(ctx context.Context, token string, ancestorIno int64, ino int64) (bool, error)
+	// LockRenameEntries locks entries oldName of oldParentIno and newName of
+	// newParentIno with their inodes until the transaction ends. It returns
+	// their inodes, nil for a missing entry
+	LockRenameEntries(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) (*models.Inode, *models.Inode, error)
+	// LockTree serializes moves of directories between parents within the
+	// transaction, so two of them can't make a cycle
+	LockTree(ctx context.Context, token string) error
+
+	// Methods below check preconditions and apply the change in a single
+	// statement, instead of separate reads followed by a transaction
+
+	// LookupInode returns parent inode and the inode name refers to. Parent is
+	// nil if it doesn't exist, inode is nil if there is no such entry
+	LookupInode(ctx context.Context, token string, parentIno int64, name string) (*models.Inode, *models.Inode, error)
+	// CreateInode allocates ino for inode and adds it to parentIno as name.
+	// A new file is empty: size 0 and no chunks. On success inode.Ino is set
+	CreateInode(ctx context.Context, parentIno int64, name string, inode *models.Inode) (EntryStatus, error)
+	// UnlinkFile removes entry of a file and decrements its ref_count. The
+	// inode is deleted once no links and no open handles remain, or moved to
+	// trash instead if the filesystem has it enabled. It returns the file's
+	// ino and the new ref_count (1 for trashed files)
+	UnlinkFile(ctx context.Context, token string, parentIno int64, name string) (int64, int, EntryStatus, error)
+	// RemoveDir deletes empty directory together with its entry and returns its ino
+	RemoveDir(ctx context.Context, token string, parentIno int64, name string) (int64, EntryStatus, error)
+	// LinkFile adds entry name to parentIno for file ino and increments its
+	// ref_count. A file that is unlinked but still open or whose last link
+	// is in trash is not found, as link(2) does
+	LinkFile(ctx context.Context, token string, ino int64, parentIno int64, name string) (EntryStatus, error)
+	// RestoreEntry links trashed file id back as name in parentIno, which
+	// default to its original location when zero. It returns the entry with
+	// the location it was restored to, nil if id is not in trash
+	RestoreEntry(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.TrashEntry, EntryStatus, error)
 }
 
 type directoryRepository struct {
@@ -187,3 +242,475 @@ func (r *directoryRepository) Exists(ctx context.Context, token string, parentIn
 
 	return exists, nil
 }
+
+func (r *directoryRepository) ResolvePath(ctx context.Context, token string, rootIno int64, names []string) (int, int64, int64, error) {
+	const op = "repository.directoryRepository.ResolvePath"
+
+	query := `
+		WITH RECURSIVE walk(depth, ino, parent_ino) AS (
+			SELECT 0, $2::BIGINT, $2::BIGINT
+			UNION ALL
+			SELECT w.depth + 1, de.ino, w.ino
+			FROM walk w
+			JOIN directory_entries de
+				ON de.token = $1 AND de.parent_ino = w.ino AND de.name = ($3::TEXT[])[w.depth + 1]
+			WHERE w.depth < cardinality($3::TEXT[])
+		)
+		SELECT depth, ino, parent_ino
+		FROM walk
+		ORDER BY depth DESC
+		LIMIT 1
+	`
+
+	var depth int
+	var ino, parentIno int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, rootIno, names).Scan(&depth, &ino, &parentIno)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return depth, ino, parentIno, nil
+}
+
+func (r *directoryRepository) IsAncestor(ctx context.Context, token string, ancestorIno int64, ino int64) (bool, error) {
+	const op = "repository.directoryRepository.IsAncestor"
+
+	query := `
+		WITH RECURSIVE up(ino) AS (
+			SELECT $3::BIGINT
+			UNION
+			SELECT de.parent_ino
+			FROM up
+			JOIN directory_entries de ON de.token = $1 AND de.ino = up.ino
+		)
+		SELECT EXISTS(SELECT 1 FROM up WHERE ino = $2)
+	`
+
+	var isAncestor bool
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, ancestorIno, ino).Scan(&isAncestor)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return isAncestor, nil
+}
+
+func (r *directoryRepository) LockRenameEntries(
+	ctx context.Context,
+	token string,
+	oldParentIno int64,
+	oldName string,
+	newParentIno int64,
+	newName string,
+) (*models.Inode, *models.Inode, error) {
+	const op = "repository.directoryRepository.LockRenameEntries"
+
+	// Rows are locked in ino order, so renames over each other's names
+	// don't deadlock. Unlink locks the inode before the entry and waits here
+	query := `
+		SELECT de.parent_ino = $2 AND de.name = $3, i.ino, i.type, i.mode, i.size, i.ref_count
+		FROM directory_entries de
+		JOIN inodes i ON i.token = de.token AND i.ino = de.ino
+		WHERE de.token = $1
+		  AND ((de.parent_ino = $2 AND de.name = $3) OR (de.parent_ino = $4 AND de.name = $5))
+		ORDER BY i.ino
+		FOR UPDATE OF de, i
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query, token, oldParentIno, oldName, newParentIno, newName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var source, target *models.Inode
+	for rows.Next() {
+		var isSource bool
+		inode := models.Inode{Token: token}
+		err := rows.Scan(&isSource, &inode.Ino, &inode.Type, &inode.Mode, &inode.Size, &inode.RefCount)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if isSource {
+			source = &inode
+		} else {
+			target = &inode
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return source, target, nil
+}
+
+func (r *directoryRepository) LockTree(ctx context.Context, token string) error {
+	const op = "repository.directoryRepository.LockTree"
+
+	query := `SELECT pg_advisory_xact_lock(hashtextextended('tree:' || $1, 0))`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	_, err := db.Exec(ctx, query, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (r *directoryRepository) LookupInode(ctx context.Context, token string, parentIno int64, name string) (*models.Inode, *models.Inode, error) {
+	const op = "repository.directoryRepository.LookupInode"
+
+	query := `
+		SELECT p.ino, p.token, p.type, p.mode, p.size, p.ref_count,
+			i.ino IS NOT NULL,
+			COALESCE(i.ino, 0), COALESCE(i.type, 0), COALESCE(i.mode, 0), COALESCE(i.size, 0), COALESCE(i.ref_count, 0)
+		FROM inodes p
+		LEFT JOIN directory_entries de ON de.token = p.token AND de.parent_ino = p.ino AND de.name = $3
+		LEFT JOIN inodes i ON i.token = de.token AND i.ino = de.ino
+		WHERE p.token = $1 AND p.ino = $2
+	`
+
+	var parent, inode models.Inode
+	var found bool
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, parentIno, name).Scan(
+		&parent.Ino,
+		&parent.Token,
+		&parent.Type,
+		&parent.Mode,
+		&parent.Size,
+		&parent.RefCount,
+		&found,
+		&inode.Ino,
+		&inode.Type,
+		&inode.Mode,
+		&inode.Size,
+		&inode.RefCount,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !found {
+		return &parent, nil, nil
+	}
+	inode.Token = token
+	return &parent, &inode, nil
+}
+
+func (r *directoryRepository) CreateInode(ctx context.Context, parentIno int64, name string, inode *models.Inode) (EntryStatus, error) {
+	const op = "repository.directoryRepository.CreateInode"
+
+	// Inode and entry are inserted by sibling statements, foreign keys are
+	// checked at the end of the whole statement and see both
+	query := `
+		WITH parent AS (
+			SELECT type
+			FROM inodes
+			WHERE token = $1 AND ino = $2
+		), taken AS (
+			SELECT EXISTS(
+				SELECT 1
+				FROM directory_entries
+				WHERE token = $1 AND parent_ino = $2 AND name = $3
+			) AS taken
+		), alloc AS (
+			UPDATE filesystems
+			SET next_ino = next_ino + 1
+			WHERE token = $1
+			  AND (SELECT type FROM parent) = $6
+			  AND NOT (SELECT taken FROM taken)
+			RETURNING next_ino - 1 AS ino
+		), inode AS (
+			INSERT INTO inodes (ino, token, type, mode, size, ref_count)
+			SELECT ino, $1, $4::SMALLINT, $5::INTEGER, 0, 1
+			FROM alloc
+			RETURNING ino
+		), entry AS (
+			INSERT INTO directory_entries (token, parent_ino, name, ino)
+			SELECT $1, $2, $3, ino
+			FROM inode
+			RETURNING ino
+		)
+		SELECT (SELECT type FROM parent), (SELECT taken FROM taken), (SELECT ino FROM entry)
+	`
+
+	var parentType *int16
+	var taken bool
+	var ino *int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query,
+		inode.Token,
+		parentIno,
+		name,
+		inode.Type,
+		inode.Mode,
+		int16(models.NodeTypeDir),
+	).Scan(&parentType, &taken, &ino)
+	if err != nil {
+		// Concurrent create of the same name got there first
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return EntryExists, nil
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case parentType == nil || models.NodeType(*parentType) != models.NodeTypeDir:
+		return EntryParentNotDir, nil
+	case taken:
+		return EntryExists, nil
+	case ino == nil:
+		return 0, fmt.Errorf("%s: filesystem %q not found", op, inode.Token)
+	}
+
+	inode.Ino = *ino
+	inode.Size = 0
+	inode.RefCount = 1
+	return EntryOK, nil
+}
+
+func (r *directoryRepository) UnlinkFile(ctx context.Context, token string, parentIno int64, name string) (int64, int, EntryStatus, error) {
+	const op = "repository.directoryRepository.UnlinkFile"
+
+	// The inode row is locked first, so ref_count seen by target is current.
+	// trashed, released and removed are mutually exclusive and never touch
+	// the same row. A trashed inode keeps its last reference. Chunks of a
+	// removed inode are locked before it is, see lockDroppedChunks
+	query := `
+		WITH target AS (
+			SELECT de.ino, i.type, i.ref_count, f.trash_enabled AS trash,
+				EXISTS(
+					SELECT 1
+					FROM open_handles h
+					WHERE h.token = $1 AND h.ino = de.ino AND h.expires_at > NOW()
+				) AS open
+			FROM directory_entries de
+			JOIN inodes i ON i.token = de.token AND i.ino = de.ino
+			JOIN filesystems f ON f.token = de.token
+			WHERE de.token = $1 AND de.parent_ino = $2 AND de.name = $3
+			FOR UPDATE OF i
+		), entry AS (
+			DELETE FROM directory_entries de
+			USING target t
+			WHERE de.token = $1 AND de.parent_ino = $2 AND de.name = $3 AND t.type = $4
+			RETURNING de.ino
+		), trashed AS (
+			INSERT INTO trash (token, ino, parent_ino, name)
+			SELECT $1, e.ino, $2, $3
+			FROM entry e, target t
+			WHERE t.ref_count <= 1 AND t.trash
+			RETURNING 1 AS ref_count
+		), released AS (
+			UPDATE inodes i
+			SET ref_count = t.ref_count - 1
+			FROM entry e, target t
+			WHERE i.token = $1 AND i.ino = e.ino AND (t.ref_count > 1 OR (t.open AND NOT t.trash))
+			RETURNING i.ref_count
+		), dropped AS (
+			SELECT $1::VARCHAR AS token, t.ino
+			FROM target t
+			WHERE t.type = $4 AND t.ref_count <= 1 AND NOT t.open AND NOT t.trash
+		), ` + lockDroppedChunks + `, removed AS (
+			DELETE FROM inodes i
+			USING entry e, target t, (SELECT COUNT(*) FROM locked) l
+			WHERE i.token = $1 AND i.ino = e.ino AND t.ref_count <= 1 AND NOT t.open AND NOT t.trash
+		)
+		SELECT t.ino, t.type, COALESCE((SELECT ref_count FROM released), (SELECT ref_count FROM trashed), 0)
+		FROM target t
+	`
+
+	var ino int64
+	var nodeType models.NodeType
+	var refCount int
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, parentIno, name, int16(models.NodeTypeFile)).Scan(&ino, &nodeType, &refCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, EntryNotFound, nil
+		}
+		return 0, 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if nodeType != models.NodeTypeFile {
+		return ino, 0, EntryWrongType, nil
+	}
+	return ino, refCount, EntryOK, nil
+}
+
+func (r *directoryRepository) RemoveDir(ctx context.Context, token string, parentIno int64, name string) (int64, EntryStatus, error) {
+	const op = "repository.directoryRepository.RemoveDir"
+
+	// Entry of the directory goes away with the inode by ON DELETE CASCADE
+	query := `
+		WITH target AS (
+			SELECT de.ino, i.type,
+				EXISTS(
+					SELECT 1
+					FROM directory_entries c
+					WHERE c.token = $1 AND c.parent_ino = de.ino
+				) AS has_entries
+			FROM directory_entries de
+			JOIN inodes i ON i.token = de.token AND i.ino = de.ino
+			WHERE de.token = $1 AND de.parent_ino = $2 AND de.name = $3
+			FOR UPDATE OF i
+		), removed AS (
+			DELETE FROM inodes i
+			USING target t
+			WHERE i.token = $1 AND i.ino = t.ino AND t.type = $4 AND NOT t.has_entries
+		)
+		SELECT ino, type, has_entries
+		FROM target
+	`
+
+	var ino int64
+	var nodeType models.NodeType
+	var hasEntries bool
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, parentIno, name, int16(models.NodeTypeDir)).Scan(&ino, &nodeType, &hasEntries)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, EntryNotFound, nil
+		}
+		return 0, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case nodeType != models.NodeTypeDir:
+		return ino, EntryWrongType, nil
+	case hasEntries:
+		return ino, EntryNotEmpty, nil
+	}
+	return ino, EntryOK, nil
+}
+
+func (r *directoryRepository) LinkFile(ctx context.Context, token string, ino int64, parentIno int64, name string) (EntryStatus, error) {
+	const op = "repository.directoryRepository.LinkFile"
+
+	// The target row is locked, so a concurrent unlink can't drop the last
+	// link between the check and the new entry
+	query := `
+		WITH target AS (
+			SELECT i.type,
+				i.ref_count > 0 AND NOT EXISTS(
+					SELECT 1
+					FROM trash t
+					WHERE t.token = $1 AND t.ino = $2
+				) AS live
+			FROM inodes i
+			WHERE i.token = $1 AND i.ino = $2
+			FOR UPDATE
+		), parent AS (
+			SELECT type
+			FROM inodes
+			WHERE token = $1 AND ino = $3
+		), entry AS (
+			INSERT INTO directory_entries (token, parent_ino, name, ino)
+			SELECT $1, $3, $4::VARCHAR, $2
+			WHERE (SELECT type FROM target) = $5 AND (SELECT live FROM target) AND (SELECT type FROM parent) = $6
+			ON CONFLICT DO NOTHING
+			RETURNING ino
+		), linked AS (
+			UPDATE inodes
+			SET ref_count = ref_count + 1
+			WHERE token = $1 AND ino IN (SELECT ino FROM entry)
+		)
+		SELECT (SELECT type FROM target), COALESCE((SELECT live FROM target), FALSE),
+			(SELECT type FROM parent), EXISTS(SELECT 1 FROM entry)
+	`
+
+	var targetType, parentType *int16
+	var live, linked bool
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query,
+		token,
+		ino,
+		parentIno,
+		name,
+		int16(models.NodeTypeFile),
+		int16(models.NodeTypeDir),
+	).Scan(&targetType, &live, &parentType, &linked)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case targetType == nil || !live:
+		return EntryNotFound, nil
+	case models.NodeType(*targetType) != models.NodeTypeFile:
+		return EntryWrongType, nil
+	case parentType == nil || models.NodeType(*parentType) != models.NodeTypeDir:
+		return EntryParentNotDir, nil
+	case !linked:
+		return EntryExists, nil
+	}
+	return EntryOK, nil
+}
+
+func (r *directoryRepository) RestoreEntry(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.TrashEntry, EntryStatus, error) {
+	const op = "repository.directoryRepository.RestoreEntry"
+
+	// The trash entry's reference passes to the new directory entry, so
+	// ref_count stays as it is
+	query := `
+		WITH item AS (
+			SELECT t.ino,
+				COALESCE(NULLIF($3::BIGINT, 0), t.parent_ino) AS parent_ino,
+				COALESCE(NULLIF($4::VARCHAR, ''), t.name) AS name,
+				t.deleted_at, i.size, i.mode
+			FROM trash t
+			JOIN inodes i ON i.token = t.token AND i.ino = t.ino
+			WHERE t.token = $1 AND t.id = $2
+			FOR UPDATE OF t
+		), parent AS (
+			SELECT i.type
+			FROM inodes i, item
+			WHERE i.token = $1 AND i.ino = item.parent_ino
+		), entry AS (
+			INSERT INTO directory_entries (token, parent_ino, name, ino)
+			SELECT $1, item.parent_ino, item.name, item.ino
+			FROM item
+			WHERE (SELECT type FROM parent) = $5
+			ON CONFLICT DO NOTHING
+			RETURNING ino
+		), restored AS (
+			DELETE FROM trash
+			WHERE token = $1 AND id = $2 AND EXISTS(SELECT 1 FROM entry)
+		)
+		SELECT item.ino, item.parent_ino, item.name, item.size, item.mode, item.deleted_at,
+			(SELECT type FROM parent), EXISTS(SELECT 1 FROM entry)
+		FROM item
+	`
+
+	entry := models.TrashEntry{ID: id}
+	var parentType *int16
+	var restored bool
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, id, parentIno, name, int16(models.NodeTypeDir)).Scan(
+		&entry.Ino, &entry.ParentIno, &entry.Name, &entry.Size, &entry.Mode, &entry.DeletedAt,
+		&parentType, &restored,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, EntryNotFound, nil
+		}
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch {
+	case parentType == nil || models.NodeType(*parentType) != models.NodeTypeDir:
+		return &entry, EntryParentNotDir, nil
+	case !restored:
+		return &entry, EntryExists, nil
+	}
+	return &entry, EntryOK, nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tests below need PostgreSQL. Each run migrates a schema of its own and
+// drops it afterwards
+const testDatabaseEnv = "VTFS_TEST_DATABASE_URL"
+
+func newTestDB(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("vtfs_test_%d", time.Now().UnixNano())
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg.ConnConfig.Tracer = postgresql.QueryTracer()
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		pool.Close()
+	})
+
+	if _, err = pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		tb.Fatal(err)
+	}
+
+	migrations, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err = pool.Exec(ctx, string(sql)); err != nil {
+			tb.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+
+	if _, err = NewFilesystemRepository(pool).GetOrCreate(ctx, testToken); err != nil {
+		tb.Fatal(err)
+	}
+	return pool
+}
+
+// statements runs fn and returns how many statements it sent
+func statements(fn func(ctx context.Context)) uint64 {
+	ctx, counter := postgresql.CountQueries(context.Background())
+	fn(ctx)
+	return counter.Load()
+}
+
+// TestNamespaceStatements checks that each combined directory operation
+// is a single statement
+func TestNamespaceStatements(t *testing.T) {
+	repo := NewDirectoryRepository(newTestDB(t))
+
+	file := &models.Inode{Token: testToken, Type: models.NodeTypeFile, Mode: 0o644}
+	dir := &models.Inode{Token: testToken, Type: models.NodeTypeDir, Mode: 0o755}
+
+	for _, tt := range []struct {
+		name string
+		fn   func(ctx context.Context) (EntryStatus, error)
+	}{
+		{"CreateInode file", func(ctx context.Context) (EntryStatus, error) {
+			return repo.CreateInode(ctx, VTFS_ROOT_INO, "file", file)
+		}},
+		{"CreateInode dir", func(ctx context.Context) (EntryStatus, error) {
+			return repo.CreateInode(ctx, VTFS_ROOT_INO, "dir", dir)
+		}},
+		{"LookupInode", func(ctx context.Context) (EntryStatus, error) {
+			_, inode, err := repo.LookupInode(ctx, testToken, VTFS_ROOT_INO, "file")
+			if err == nil && (inode == nil || inode.Ino != file.Ino) {
+				return EntryNotFound, nil
+			}
+			return EntryOK, err
+		}},
+		{"LinkFile", func(ctx context.Context) (EntryStatus, error) {
+			return repo.LinkFile(ctx, testToken, file.Ino, dir.Ino, "link")
+		}},
+		{"UnlinkFile", func(ctx context.Context) (EntryStatus, error) {
+			_, _, status, err := repo.UnlinkFile(ctx, testToken, dir.Ino, "link")
+			return status, err
+		}},
+		{"RemoveDir", func(ctx context.Context) (EntryStatus, error) {
+			_, status, err := repo.RemoveDir(ctx, testToken, VTFS_ROOT_INO, "dir")
+			return status, err
+		}},
+	} {
+		var status EntryStatus
+		var err error
+		n := statements(func(ctx context.Context) { status, err = tt.fn(ctx) })
+		if err != nil || status != EntryOK {
+			t.Fatalf("%s = %v, %v, want EntryOK", tt.name, status, err)
+		}
+		if n != 1 {
+			t.Errorf("%s took %d statements, want 1", tt.name, n)
+		}
+	}
+}
+
+// TestLinkDeletedFile checks that files gone from the namespace can't be
+// linked back: one unlinked but still open, one whose last link is in trash
+func TestLinkDeletedFile(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewDirectoryRepository(db)
+
+	open := &models.Inode{Token: testToken, Type: models.NodeTypeFile, Mode: 0o644}
+	if _, err := repo.CreateInode(ctx, VTFS_ROOT_INO, "open", open); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHandleRepository(db).Create(ctx, testToken, open.Ino, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := repo.UnlinkFile(ctx, testToken, VTFS_ROOT_INO, "open"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFilesystemRepository(db).SetTrashEnabled(ctx, testToken, true); err != nil {
+		t.Fatal(err)
+	}
+	trashed := &models.Inode{Token: testToken, Type: models.NodeTypeFile, Mode: 0o644}
+	if _, err := repo.CreateInode(ctx, VTFS_ROOT_INO, "trashed", trashed); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := repo.UnlinkFile(ctx, testToken, VTFS_ROOT_INO, "trashed"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inode := range []*models.Inode{open, trashed} {
+		status, err := repo.LinkFile(ctx, testToken, inode.Ino, VTFS_ROOT_INO, "link")
+		if err != nil || status != EntryNotFound {
+			t.Errorf("LinkFile(%d) = %v, %v, want EntryNotFound", inode.Ino, status, err)
+		}
+	}
+}
+
+func BenchmarkDirectoryLookupInode(b *testing.B) {
+	repo := NewDirectoryRepository(newTestDB(b))
+	ctx, counter := postgresql.CountQueries(context.Background())
+
+	file := &models.Inode{Token: testToken, Type: models.NodeTypeFile, Mode: 0o644}
+	if _, err := repo.CreateInode(ctx, VTFS_ROOT_INO, "file", file); err != nil {
+		b.Fatal(err)
+	}
+
+	counter.Store(0)
+	for b.Loop() {
+		if _, _, err := repo.LookupInode(ctx, testToken, VTFS_ROOT_INO, "file"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.Load())/float64(b.N), "statements/op")
+}
+
+// BenchmarkDirectoryCreateLinkUnlink creates a file, links it under a
+// second name and unlinks both
+func BenchmarkDirectoryCreateLinkUnlink(b *testing.B) {
+	repo := NewDirectoryRepository(newTestDB(b))
+	ctx, counter := postgresql.CountQueries(context.Background())
+
+	for b.Loop() {
+		file := &models.Inode{Token: testToken, Type: models.NodeTypeFile, Mode: 0o644}
+		if _, err := repo.CreateInode(ctx, VTFS_ROOT_INO, "file", file); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := repo.LinkFile(ctx, testToken, file.Ino, VTFS_ROOT_INO, "link"); err != nil {
+			b.Fatal(err)
+		}
+		for _, name := range []string{"link", "file"} {
+			if _, _, _, err := repo.UnlinkFile(ctx, testToken, VTFS_ROOT_INO, name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(counter.Load())/float64(b.N), "statements/op")
+}
+
+func BenchmarkDirectoryCreateRemoveDir(b *testing.B) {
+	repo := NewDirectoryRepository(newTestDB(b))
+	ctx, counter := postgresql.CountQueries(context.Background())
+
+	for b.Loop() {
+		dir := &models.Inode{Token: testToken, Type: models.NodeTypeDir, Mode: 0o755}
+		if _, err := repo.CreateInode(ctx, VTFS_ROOT_INO, "dir", dir); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := repo.RemoveDir(ctx, testToken, VTFS_ROOT_INO, "dir"); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.Load())/float64(b.N), "statements/op")
+}
@@ -21,8 +21,8 @@ type FilesystemRepository interface {
 	Create(ctx context.Context, token string) error
 	Get(ctx context.Context, token string) (*models.Filesystem, error)
 	GetOrCreate(ctx context.Context, token string) (*models.Filesystem, error)
-	GetNextIno(ctx context.Context, token string) (int64, error)
-	IncrementNextIno(ctx context.Context, token string) error
+	// SetTrashEnabled returns false if the filesystem doesn't exist
+	SetTrashEnabled(ctx context.Context, token string, enabled bool) (bool, error)
 }
 
 type filesystemRepository struct {
@@ -58,7 +58,7 @@ func (r *filesystemRepository) Get(ctx context.Context, token string) (*models.F
 	const op = "repository.filesystemRepository.Get"
 
 	query := `
-		SELECT token, root_ino, next_ino, created_at
+		SELECT token, root_ino, next_ino, trash_enabled, created_at
 		FROM filesystems
 		WHERE token = $1
 	`
@@ -69,6 +69,7 @@ func (r *filesystemRepository) Get(ctx context.Context, token string) (*models.F
 		&fs.Token,
 		&fs.RootIno,
 		&fs.NextIno,
+		&fs.TrashEnabled,
 		&fs.CreateAt,
 	)
 	if err != nil {
@@ -137,39 +138,20 @@ func (r *filesystemRepository) GetOrCreate(ctx context.Context, token string) (*
 	return r.Get(ctx, token)
 }
 
-func (r *filesystemRepository) GetNextIno(ctx context.Context, token string) (int64, error) {
-	const op = "repository.filesystemRepository.GetNextIno"
-
-	query := `
-		SELECT next_ino
-		FROM filesystems
-		WHERE token = $1
-	`
-
-	var nextIno int64
-	db := postgresql.GetDBClient(ctx, r.db)
-	err := db.QueryRow(ctx, query, token).Scan(&nextIno)
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
-	}
-
-	return nextIno, nil
-}
-
-func (r *filesystemRepository) IncrementNextIno(ctx context.Context, token string) error {
-	const op = "repository.filesystemRepository.IncrementNextIno"
+func (r *filesystemRepository) SetTrashEnabled(ctx context.Context, token string, enabled bool) (bool, error) {
+	const op = "repository.filesystemRepository.SetTrashEnabled"
 
 	query := `
 		UPDATE filesystems
-		SET next_ino = next_ino + 1
+		SET trash_enabled = $2
 		WHERE token = $1
 	`
 
 	db := postgresql.GetDBClient(ctx, r.db)
-	_, err := db.Exec(ctx, query, token)
+	tag, err := db.Exec(ctx, query, token, enabled)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return nil
+	return tag.RowsAffected() > 0, nil
 }
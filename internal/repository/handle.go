@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/jackc/pgx/v5"
+)
+
+type HandleRepository interface {
+	Create(ctx context.Context, token string, ino int64, lease time.Duration) (int64, error)
+	Renew(ctx context.Context, token string, fh int64, lease time.Duration) (bool, error)
+	Delete(ctx context.Context, token string, fh int64) (int64, error)
+	CountOpen(ctx context.Context, token string, ino int64) (int, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type handleRepository struct {
+	db postgresql.Client
+}
+
+func NewHandleRepository(db postgresql.Client) HandleRepository {
+	return &handleRepository{db: db}
+}
+
+func (r *handleRepository) Create(ctx context.Context, token string, ino int64, lease time.Duration) (int64, error) {
+	const op = "repository.handleRepository.Create"
+
+	query := `
+		INSERT INTO open_handles (token, ino, expires_at)
+		VALUES ($1, $2, NOW() + $3::interval)
+		RETURNING fh
+	`
+
+	var fh int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, ino, lease).Scan(&fh)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return fh, nil
+}
+
+func (r *handleRepository) Renew(ctx context.Context, token string, fh int64, lease time.Duration) (bool, error) {
+	const op = "repository.handleRepository.Renew"
+
+	query := `
+		UPDATE open_handles
+		SET expires_at = NOW() + $1::interval
+		WHERE token = $2 AND fh = $3
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query, lease, token, fh)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// Delete removes handle and returns inode it was opened for (0 if handle does not exist)
+func (r *handleRepository) Delete(ctx context.Context, token string, fh int64) (int64, error) {
+	const op = "repository.handleRepository.Delete"
+
+	query := `
+		DELETE FROM open_handles
+		WHERE token = $1 AND fh = $2
+		RETURNING ino
+	`
+
+	var ino int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, fh).Scan(&ino)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ino, nil
+}
+
+func (r *handleRepository) CountOpen(ctx context.Context, token string, ino int64) (int, error) {
+	const op = "repository.handleRepository.CountOpen"
+
+	query := `
+		SELECT COUNT(*)
+		FROM open_handles
+		WHERE token = $1 AND ino = $2 AND expires_at > NOW()
+	`
+
+	var count int
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, ino).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return count, nil
+}
+
+func (r *handleRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	const op = "repository.handleRepository.DeleteExpired"
+
+	query := `
+		DELETE FROM open_handles
+		WHERE expires_at <= NOW()
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
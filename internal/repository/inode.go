@@ -12,12 +12,16 @@ import (
 
 type InodeRepository interface {
 	Get(ctx context.Context, token string, ino int64) (*models.Inode, error)
+	// GetForUpdate is Get that locks the inode row until the transaction
+	// ends, so changes of the same file's contents don't interleave
+	GetForUpdate(ctx context.Context, token string, ino int64) (*models.Inode, error)
 	Create(ctx context.Context, inode *models.Inode) error
 	UpdateSize(ctx context.Context, token string, ino int64, size int64) error
 	UpdateRefCount(ctx context.Context, token string, ino int64, delta int) error
 	Delete(ctx context.Context, token string, ino int64) error
 	IsDir(ctx context.Context, token string, ino int64) (bool, error)
 	IsFile(ctx context.Context, token string, ino int64) (bool, error)
+	DeleteOrphans(ctx context.Context) (int64, error)
 }
 
 type inodeRepository struct {
@@ -37,6 +41,34 @@ func (r *inodeRepository) Get(ctx context.Context, token string, ino int64) (*mo
 		WHERE token = $1 AND ino = $2
 	`
 
+	inode, err := r.scan(ctx, query, token, ino)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inode, nil
+}
+
+func (r *inodeRepository) GetForUpdate(ctx context.Context, token string, ino int64) (*models.Inode, error) {
+	const op = "repository.inodeRepository.GetForUpdate"
+
+	query := `
+		SELECT ino, token, type, mode, size, ref_count
+		FROM inodes
+		WHERE token = $1 AND ino = $2
+		FOR UPDATE
+	`
+
+	inode, err := r.scan(ctx, query, token, ino)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inode, nil
+}
+
+// scan runs query selecting a single inode, nil if there is no row
+func (r *inodeRepository) scan(ctx context.Context, query string, token string, ino int64) (*models.Inode, error) {
 	var inode models.Inode
 	db := postgresql.GetDBClient(ctx, r.db)
 	err := db.QueryRow(ctx, query, token, ino).Scan(
@@ -51,7 +83,7 @@ func (r *inodeRepository) Get(ctx context.Context, token string, ino int64) (*mo
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 
 	return &inode, nil
@@ -121,8 +153,15 @@ func (r *inodeRepository) Delete(ctx context.Context, token string, ino int64) e
 	const op = "repository.inodeRepository.Delete"
 
 	query := `
-		DELETE FROM inodes
-		WHERE token = $1 AND ino = $2
+		WITH dropped AS (
+			SELECT token, ino
+			FROM inodes
+			WHERE token = $1 AND ino = $2
+			FOR UPDATE
+		), ` + lockDroppedChunks + `
+		DELETE FROM inodes i
+		USING dropped d, (SELECT COUNT(*) FROM locked) l
+		WHERE i.token = d.token AND i.ino = d.ino
 	`
 
 	db := postgresql.GetDBClient(ctx, r.db)
@@ -177,3 +216,35 @@ func (r *inodeRepository) IsFile(ctx context.Context, token string, ino int64) (
 
 	return nodeType == int16(models.NodeTypeFile), nil
 }
+
+// DeleteOrphans removes unlinked inodes (ref_count = 0) that are no longer held open by any live handle
+func (r *inodeRepository) DeleteOrphans(ctx context.Context) (int64, error) {
+	const op = "repository.inodeRepository.DeleteOrphans"
+
+	// Orphans are locked in key order, then their chunks in hash order
+	query := `
+		WITH dropped AS (
+			SELECT i.token, i.ino
+			FROM inodes i
+			WHERE i.ref_count <= 0
+			  AND NOT EXISTS (
+				SELECT 1
+				FROM open_handles h
+				WHERE h.token = i.token AND h.ino = i.ino AND h.expires_at > NOW()
+			  )
+			ORDER BY i.token, i.ino
+			FOR UPDATE
+		), ` + lockDroppedChunks + `
+		DELETE FROM inodes i
+		USING dropped d, (SELECT COUNT(*) FROM locked) l
+		WHERE i.token = d.token AND i.ino = d.ino
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/jackc/pgx/v5"
+)
+
+// TrashRepository keeps files whose last link was removed while trash was
+// enabled. A trashed inode keeps ref_count 1 on behalf of its trash entry.
+// Restoring is DirectoryRepository.RestoreEntry, it changes the namespace
+type TrashRepository interface {
+	// Add moves ino into trash if the filesystem has trash enabled, the
+	// caller has already removed its last directory entry. It reports
+	// whether the inode was trashed
+	Add(ctx context.Context, token string, ino int64, parentIno int64, name string) (bool, error)
+	List(ctx context.Context, token string) ([]models.TrashEntry, error)
+	// Purge drops entries older than ttl and their reference. Inodes left
+	// without references are removed by InodeRepository.DeleteOrphans
+	Purge(ctx context.Context, ttl time.Duration) (int64, error)
+}
+
+type trashRepository struct {
+	db postgresql.Client
+}
+
+func NewTrashRepository(db postgresql.Client) TrashRepository {
+	return &trashRepository{db: db}
+}
+
+func (r *trashRepository) Add(ctx context.Context, token string, ino int64, parentIno int64, name string) (bool, error) {
+	const op = "repository.trashRepository.Add"
+
+	query := `
+		INSERT INTO trash (token, ino, parent_ino, name)
+		SELECT token, $2, $3, $4
+		FROM filesystems
+		WHERE token = $1 AND trash_enabled
+		RETURNING id
+	`
+
+	var id int64
+	db := postgresql.GetDBClient(ctx, r.db)
+	err := db.QueryRow(ctx, query, token, ino, parentIno, name).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+func (r *trashRepository) List(ctx context.Context, token string) ([]models.TrashEntry, error) {
+	const op = "repository.trashRepository.List"
+
+	query := `
+		SELECT t.id, t.ino, t.parent_ino, t.name, i.size, i.mode, t.deleted_at
+		FROM trash t
+		JOIN inodes i ON i.token = t.token AND i.ino = t.ino
+		WHERE t.token = $1
+		ORDER BY t.id
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	rows, err := db.Query(ctx, query, token)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	entries := []models.TrashEntry{}
+	for rows.Next() {
+		var entry models.TrashEntry
+		err := rows.Scan(&entry.ID, &entry.Ino, &entry.ParentIno, &entry.Name, &entry.Size, &entry.Mode, &entry.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+func (r *trashRepository) Purge(ctx context.Context, ttl time.Duration) (int64, error) {
+	const op = "repository.trashRepository.Purge"
+
+	query := `
+		WITH expired AS (
+			DELETE FROM trash
+			WHERE deleted_at < NOW() - $1::interval
+			RETURNING token, ino
+		)
+		UPDATE inodes i
+		SET ref_count = i.ref_count - 1
+		FROM expired e
+		WHERE i.token = e.token AND i.ino = e.ino
+	`
+
+	db := postgresql.GetDBClient(ctx, r.db)
+	tag, err := db.Exec(ctx, query, ttl)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,214 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+)
+
+// dispatch decodes payload, calls the service and returns response code and data
+func (s *Server) dispatch(ctx context.Context, req *request, version uint32) (int64, []byte) {
+	const op = "rpc.Server.dispatch"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Request received",
+		slog.Uint64("request_id", req.id),
+		slog.Int("opcode", int(req.opcode)),
+		slog.Int("payload_len", len(req.payload)),
+	)
+
+	d := binary.NewDecoder(req.payload)
+	token := d.String()
+
+	switch req.opcode {
+	case OpInit:
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		return result(nil, s.service.Init(ctx, token))
+
+	case OpGetRoot:
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		return metaResult(version)(s.service.GetRoot(ctx, token))
+
+	case OpLookup:
+		parent := d.Int64()
+		name := d.String()
+		if !valid(d, token) || name == "" {
+			return kerrors.EINVAL_NEG, nil
+		}
+		return metaResult(version)(s.service.Lookup(ctx, token, parent, name))
+
+	case OpResolve:
+		path := d.String()
+		if !valid(d, token) || path == "" {
+			return kerrors.EINVAL_NEG, nil
+		}
+		return metaResult(version)(s.service.ResolvePath(ctx, token, path))
+
+	case OpIterateDir:
+		dirIno := d.Int64()
+		offset := d.Uint64()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		dirent, err := s.service.IterateDir(ctx, token, dirIno, &offset)
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		data, err := binary.EncodeDirentVersion(version, dirent)
+		if err != nil {
+			return kerrors.ENOMEM_NEG, nil
+		}
+		return 0, data
+
+	case OpCreateFile, OpMkdir:
+		parent := d.Int64()
+		name := d.String()
+		mode := d.Uint32()
+		if !valid(d, token) || name == "" {
+			return kerrors.EINVAL_NEG, nil
+		}
+		if req.opcode == OpMkdir {
+			return metaResult(version)(s.service.CreateDir(ctx, token, parent, name, mode))
+		}
+		return metaResult(version)(s.service.CreateFile(ctx, token, parent, name, mode))
+
+	case OpUnlink, OpRmdir:
+		parent := d.Int64()
+		name := d.String()
+		if !valid(d, token) || name == "" {
+			return kerrors.EINVAL_NEG, nil
+		}
+		if req.opcode == OpRmdir {
+			return result(nil, s.service.Rmdir(ctx, token, parent, name))
+		}
+		return result(nil, s.service.Unlink(ctx, token, parent, name))
+
+	case OpRead:
+		ino := d.Int64()
+		offset := d.Int64()
+		length := d.Uint32()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		// Same cap as /api/read, a short reply is a valid read(2) result
+		length = min(length, s.maxFrameSize-responseHeaderSize, s.maxReadSize)
+		buffer := make([]byte, length)
+		read, err := s.service.Read(ctx, token, ino, buffer, offset)
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		return 0, buffer[:read]
+
+	case OpWrite:
+		ino := d.Int64()
+		offset := d.Int64()
+		data := d.Bytes()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		written, err := s.service.Write(ctx, token, ino, data, uint64(len(data)), offset)
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		return 0, binary.NewEncoder().PutInt64(written).Bytes()
+
+	case OpLink:
+		targetIno := d.Int64()
+		parent := d.Int64()
+		name := d.String()
+		if !valid(d, token) || name == "" {
+			return kerrors.EINVAL_NEG, nil
+		}
+		return result(nil, s.service.Link(ctx, token, targetIno, parent, name))
+
+	case OpCountLinks:
+		ino := d.Int64()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		count, err := s.service.CountLinks(ctx, token, ino)
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		return 0, binary.NewEncoder().PutUint32(count).Bytes()
+
+	case OpOpen:
+		ino := d.Int64()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		fh, err := s.service.Open(ctx, token, ino)
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		return 0, binary.NewEncoder().PutInt64(fh).Bytes()
+
+	case OpRenew, OpRelease:
+		fh := d.Int64()
+		if !valid(d, token) {
+			return kerrors.EINVAL_NEG, nil
+		}
+		if req.opcode == OpRelease {
+			return result(nil, s.service.Release(ctx, token, fh))
+		}
+		return result(nil, s.service.Renew(ctx, token, fh))
+
+	default:
+		logger.Warn("Unknown opcode", slog.Int("opcode", int(req.opcode)))
+		return kerrors.EINVAL_NEG, nil
+	}
+}
+
+// valid reports whether payload was decoded completely and token is present
+func valid(d *binary.Decoder, token string) bool {
+	return d.Err() == nil && d.Remaining() == 0 && token != ""
+}
+
+func result(data []byte, err error) (int64, []byte) {
+	if err != nil {
+		return service.ErrorCode(err), nil
+	}
+	return 0, data
+}
+
+// metaResult encodes NodeMeta in the negotiated layout
+func metaResult(version uint32) func(meta *models.NodeMeta, err error) (int64, []byte) {
+	return func(meta *models.NodeMeta, err error) (int64, []byte) {
+		if err != nil {
+			return service.ErrorCode(err), nil
+		}
+		data, err := binary.EncodeNodeMetaVersion(version, meta)
+		if err != nil {
+			return kerrors.ENOMEM_NEG, nil
+		}
+		return 0, data
+	}
+}
+
+// hello negotiates protocol version of the connection
+func hello(req *request, version *atomic.Uint32) (int64, []byte) {
+	d := binary.NewDecoder(req.payload)
+	clientVersion := d.Uint32()
+	_ = d.Uint64() // client features, nothing depends on them yet
+	if d.Err() != nil || d.Remaining() != 0 {
+		return kerrors.EINVAL_NEG, nil
+	}
+
+	negotiated, ok := binary.NegotiateVersion(clientVersion)
+	if !ok {
+		return kerrors.EINVAL_NEG, nil
+	}
+
+	version.Store(negotiated)
+	return 0, binary.EncodeHello(negotiated)
+}
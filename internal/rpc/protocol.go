@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Wire format (all integers little-endian):
+//
+//	request:  u32 length | u64 request_id | u16 opcode | payload
+//	response: u32 length | u64 request_id | i64 code   | data
+//
+// length counts bytes after the length field itself. Responses may come
+// out of order; clients match them by request_id, so several requests can
+// be in flight on one connection. Payload fields are encoded with
+// binary.Encoder: strings are u16-length prefixed, write data is
+// u32-length prefixed. Response data is the same as the HTTP API body
+// after the return code (NodeMeta, Dirent, int64 or uint32).
+// Hello has no token.
+type Opcode uint16
+
+const (
+	OpInit       Opcode = 1  // token
+	OpGetRoot    Opcode = 2  // token -> NodeMeta
+	OpLookup     Opcode = 3  // token, parent i64, name -> NodeMeta
+	OpIterateDir Opcode = 4  // token, dir_ino i64, offset u64 -> Dirent
+	OpCreateFile Opcode = 5  // token, parent i64, name, mode u32 -> NodeMeta
+	OpUnlink     Opcode = 6  // token, parent i64, name
+	OpMkdir      Opcode = 7  // token, parent i64, name, mode u32 -> NodeMeta
+	OpRmdir      Opcode = 8  // token, parent i64, name
+	OpRead       Opcode = 9  // token, ino i64, offset i64, len u32 -> data
+	OpWrite      Opcode = 10 // token, ino i64, offset i64, data -> i64 written
+	OpLink       Opcode = 11 // token, target_ino i64, parent i64, name
+	OpCountLinks Opcode = 12 // token, ino i64 -> u32
+	OpOpen       Opcode = 13 // token, ino i64 -> i64 fh
+	OpRenew      Opcode = 14 // token, fh i64
+	OpRelease    Opcode = 15 // token, fh i64
+	// version u32, features u64 -> hello reply (see binary.EncodeHello).
+	// Processed in order: requests sent after hello use negotiated version
+	// for NodeMeta/Dirent layouts, connection starts at v1
+	OpHello   Opcode = 16
+	OpResolve Opcode = 17 // token, path -> NodeMeta
+)
+
+const (
+	requestHeaderSize  = 8 + 2
+	responseHeaderSize = 8 + 8
+)
+
+var ErrFrameTooLarge = errors.New("rpc: frame too large")
+
+type request struct {
+	id      uint64
+	opcode  Opcode
+	payload []byte
+}
+
+func readRequest(r io.Reader, maxFrameSize uint32) (*request, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.LittleEndian.Uint32(lenBuf[:])
+	if length < requestHeaderSize {
+		return nil, fmt.Errorf("rpc: frame too short: %d", length)
+	}
+	if length > maxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+
+	return &request{
+		id:      binary.LittleEndian.Uint64(frame[0:8]),
+		opcode:  Opcode(binary.LittleEndian.Uint16(frame[8:10])),
+		payload: frame[requestHeaderSize:],
+	}, nil
+}
+
+func writeResponse(w io.Writer, id uint64, code int64, data []byte) error {
+	frame := make([]byte, 4+responseHeaderSize, 4+responseHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(responseHeaderSize+len(data)))
+	binary.LittleEndian.PutUint64(frame[4:12], id)
+	binary.LittleEndian.PutUint64(frame[12:20], uint64(code))
+	frame = append(frame, data...)
+
+	_, err := w.Write(frame)
+	return err
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/netserver"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// Server speaks the binary protocol over long-lived stream connections
+// and dispatches requests into the same FileSystemService as the HTTP API
+type Server struct {
+	service      service.FileSystemService
+	maxFrameSize uint32
+	maxInFlight  int
+	maxReadSize  uint32
+
+	// Serve and Shutdown
+	*netserver.Server
+}
+
+func NewServer(service service.FileSystemService, maxFrameSize uint32, maxInFlight int, maxReadSize uint32) *Server {
+	s := &Server{
+		service:      service,
+		maxFrameSize: maxFrameSize,
+		maxInFlight:  maxInFlight,
+		maxReadSize:  maxReadSize,
+	}
+	s.Server = netserver.New(s.serveConn)
+	return s
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	const op = "rpc.Server.serveConn"
+
+	ctx = logging.MakeContextWithRemoteAddr(ctx, conn.RemoteAddr().String())
+	logger := logging.GetLoggerFromContextWithOp(ctx, op).With(slog.String("remote_addr", conn.RemoteAddr().String()))
+	logger.Debug("Connection opened")
+	defer logger.Debug("Connection closed")
+
+	// Negotiated protocol version of this connection
+	var version atomic.Uint32
+	version.Store(binary.ProtocolV1)
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	var writeMu sync.Mutex
+
+	inFlight := netserver.NewInFlight(s.maxInFlight)
+	defer inFlight.Wait()
+
+	for {
+		req, err := readRequest(reader, s.maxFrameSize)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("Failed to read request", slogext.Err(err))
+			}
+			return
+		}
+
+		if req.opcode == OpHello {
+			code, data := hello(req, &version)
+			writeMu.Lock()
+			err := writeResponse(writer, req.id, code, data)
+			if err == nil {
+				err = writer.Flush()
+			}
+			writeMu.Unlock()
+			if err != nil {
+				logger.Warn("Failed to write response", slogext.Err(err))
+				return
+			}
+			continue
+		}
+
+		inFlight.Go(func() {
+			reqCtx := logging.MakeContextWithNewRequestID(ctx)
+			code, data := s.dispatch(reqCtx, req, version.Load())
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+
+			if err := writeResponse(writer, req.id, code, data); err != nil {
+				logger.Warn("Failed to write response", slogext.Err(err))
+				return
+			}
+			if err := writer.Flush(); err != nil {
+				logger.Warn("Failed to flush response", slogext.Err(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+)
+
+// FileInfo adapts NodeMeta to fs.FileInfo for frontends built on io/fs
+// style interfaces (WebDAV, SFTP). Sys returns the underlying *models.NodeMeta
+type FileInfo struct {
+	name string
+	meta models.NodeMeta
+}
+
+func NewFileInfo(name string, meta *models.NodeMeta) *FileInfo {
+	return &FileInfo{name: name, meta: *meta}
+}
+
+func (fi *FileInfo) Name() string { return fi.name }
+func (fi *FileInfo) Size() int64  { return fi.meta.Size }
+func (fi *FileInfo) IsDir() bool  { return fi.meta.Type == models.NodeTypeDir }
+func (fi *FileInfo) Sys() any     { return &fi.meta }
+
+func (fi *FileInfo) Mode() fs.FileMode {
+	mode := fs.FileMode(fi.meta.Mode & S_IRWXUGO)
+	if fi.IsDir() {
+		mode |= fs.ModeDir
+	}
+	return mode
+}
+
+// ModTime is unknown: inodes don't expose modification time
+func (fi *FileInfo) ModTime() time.Time { return time.Time{} }
+
+// PathError converts service errors into *os.PathError with the matching os
+// sentinel (fs.ErrNotExist, fs.ErrExist, fs.ErrPermission), so that libraries
+// built around package os report proper status codes
+func PathError(op string, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var serviceErr *ServiceError
+	if !errors.As(err, &serviceErr) {
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	switch serviceErr.Code {
+	case kerrors.ENOENT:
+		err = os.ErrNotExist
+	case kerrors.EEXIST:
+		err = os.ErrExist
+	case kerrors.EPERM:
+		err = os.ErrPermission
+	}
+
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
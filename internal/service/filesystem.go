@@ -2,16 +2,20 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"path"
+	"strings"
+	"time"
 
+	"github.com/S1riyS/os-course-lab-4/server/internal/events"
 	"github.com/S1riyS/os-course-lab-4/server/internal/models"
 	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
 	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
 	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
-	"github.com/lib/pq"
 )
 
 const (
@@ -27,6 +31,7 @@ type FileSystemService interface {
 	Init(ctx context.Context, token string) error
 	GetRoot(ctx context.Context, token string) (*models.NodeMeta, error)
 	Lookup(ctx context.Context, token string, parentIno int64, name string) (*models.NodeMeta, error)
+	ResolvePath(ctx context.Context, token string, path string) (*models.NodeMeta, error)
 	IterateDir(ctx context.Context, token string, dirIno int64, offset *uint64) (*models.Dirent, error)
 	CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error)
 	Unlink(ctx context.Context, token string, parentIno int64, name string) error
@@ -34,8 +39,26 @@ type FileSystemService interface {
 	Rmdir(ctx context.Context, token string, parentIno int64, name string) error
 	Read(ctx context.Context, token string, ino int64, buffer []byte, offset int64) (int64, error)
 	Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (int64, error)
+	Truncate(ctx context.Context, token string, ino int64, size int64) error
+	// ReplaceContent makes data the whole content of file ino in one
+	// change, so a versioned file gets one version for it
+	ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error
 	Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error
+	Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error
 	CountLinks(ctx context.Context, token string, ino int64) (uint32, error)
+	Open(ctx context.Context, token string, ino int64) (int64, error)
+	Renew(ctx context.Context, token string, fh int64) error
+	Release(ctx context.Context, token string, fh int64) error
+	SetTrash(ctx context.Context, token string, enabled bool) error
+	ListTrash(ctx context.Context, token string) ([]models.TrashEntry, error)
+	// RestoreTrash links trashed file id back into parentIno as name. Zero
+	// parentIno and empty name mean the original location
+	RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error)
+	// SetVersioning keeps up to keep versions of file ino, 0 disables
+	SetVersioning(ctx context.Context, token string, ino int64, keep int) error
+	ListVersions(ctx context.Context, token string, ino int64) ([]models.FileVersion, error)
+	ReadVersion(ctx context.Context, token string, ino int64, version int64) ([]byte, error)
+	RestoreVersion(ctx context.Context, token string, ino int64, version int64) error
 }
 
 type fileSystemService struct {
@@ -44,6 +67,11 @@ type fileSystemService struct {
 	inodeRepo   repository.InodeRepository
 	dirRepo     repository.DirectoryRepository
 	contentRepo repository.ContentRepository
+	handleRepo  repository.HandleRepository
+	trashRepo   repository.TrashRepository
+	handleLease time.Duration
+	maxFileSize int64
+	publisher   events.Publisher
 }
 
 func NewFileSystemService(
@@ -52,6 +80,11 @@ func NewFileSystemService(
 	inodeRepo repository.InodeRepository,
 	dirRepo repository.DirectoryRepository,
 	contentRepo repository.ContentRepository,
+	handleRepo repository.HandleRepository,
+	trashRepo repository.TrashRepository,
+	handleLease time.Duration,
+	maxFileSize int64,
+	publisher events.Publisher,
 ) FileSystemService {
 	return &fileSystemService{
 		db:          db,
@@ -59,6 +92,11 @@ func NewFileSystemService(
 		inodeRepo:   inodeRepo,
 		dirRepo:     dirRepo,
 		contentRepo: contentRepo,
+		handleRepo:  handleRepo,
+		trashRepo:   trashRepo,
+		handleLease: handleLease,
+		maxFileSize: maxFileSize,
+		publisher:   publisher,
 	}
 }
 
@@ -150,29 +188,66 @@ func (s *fileSystemService) Lookup(ctx context.Context, token string, parentIno
 		slog.String("name", name),
 	)
 
-	isDir, err := s.inodeRepo.IsDir(ctx, token, parentIno)
+	parent, inode, err := s.dirRepo.LookupInode(ctx, token, parentIno, name)
 	if err != nil {
-		logger.Error("Failed to check if parent is directory", slogext.Err(err), slog.Int64("parent_ino", parentIno))
+		logger.Error("Failed to lookup directory entry", slogext.Err(err))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if !isDir {
+
+	if parent == nil || parent.Type != models.NodeTypeDir {
 		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
 		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
 	}
 
-	logger.Debug("Looking up directory entry", slog.Int64("parent_ino", parentIno), slog.String("name", name))
-	ino, err := s.dirRepo.Lookup(ctx, token, parentIno, name)
-	if err != nil {
-		logger.Error("Failed to lookup directory entry", slogext.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-
-	if ino == 0 {
+	if inode == nil {
 		logger.Debug("Entry not found", slog.Int64("parent_ino", parentIno), slog.String("name", name))
 		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
 	}
 
-	logger.Debug("Found entry, getting inode", slog.Int64("ino", ino))
+	mode := inode.Mode
+	switch inode.Type {
+	case models.NodeTypeDir:
+		mode = S_IFDIR | (mode & S_IRWXUGO)
+	case models.NodeTypeFile:
+		mode = S_IFREG | (mode & S_IRWXUGO)
+	}
+
+	meta := &models.NodeMeta{
+		Ino:       inode.Ino,
+		ParentIno: parentIno,
+		Type:      inode.Type,
+		Mode:      mode,
+		Size:      inode.Size,
+	}
+
+	logger.Debug("Lookup successful",
+		slog.String("name", name),
+		slog.Int64("ino", meta.Ino),
+		slog.Int64("parent_ino", meta.ParentIno),
+		slog.Int("type", int(meta.Type)),
+		slog.Int64("size", meta.Size),
+	)
+
+	return meta, nil
+}
+
+// ResolvePath resolves slash-separated path from the root of the filesystem
+// in a single query. "." and ".." are resolved lexically. There are no
+// symlinks yet, so the walk cannot loop; once they appear, following them
+// has to be bounded (ELOOP)
+func (s *fileSystemService) ResolvePath(ctx context.Context, token string, path string) (*models.NodeMeta, error) {
+	const op = "service.fileSystemService.ResolvePath"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("ResolvePath", slog.String("token", token), slog.String("path", path))
+
+	names := SplitPath(path)
+	depth, ino, parentIno, err := s.dirRepo.ResolvePath(ctx, token, VTFS_ROOT_INO, names)
+	if err != nil {
+		logger.Error("Failed to resolve path", slogext.Err(err), slog.String("path", path))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	inode, err := s.inodeRepo.Get(ctx, token, ino)
 	if err != nil {
 		logger.Error("Failed to get inode", slogext.Err(err), slog.Int64("ino", ino))
@@ -181,7 +256,20 @@ func (s *fileSystemService) Lookup(ctx context.Context, token string, parentIno
 
 	if inode == nil {
 		logger.Debug("Inode not found", slog.Int64("ino", ino))
-		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "inode not found"}
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	}
+
+	// Walk stopped early: either a component is missing or we hit a file
+	if depth < len(names) {
+		if inode.Type != models.NodeTypeDir {
+			logger.Debug("Intermediate component is not a directory",
+				slog.String("path", path),
+				slog.String("name", names[depth-1]),
+			)
+			return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"}
+		}
+		logger.Debug("Component not found", slog.String("path", path), slog.String("name", names[depth]))
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
 	}
 
 	mode := inode.Mode
@@ -200,12 +288,10 @@ func (s *fileSystemService) Lookup(ctx context.Context, token string, parentIno
 		Size:      inode.Size,
 	}
 
-	logger.Debug("Lookup successful",
-		slog.String("name", name),
+	logger.Debug("Path resolved",
+		slog.String("path", path),
 		slog.Int64("ino", meta.Ino),
 		slog.Int64("parent_ino", meta.ParentIno),
-		slog.Int("type", int(meta.Type)),
-		slog.Int64("size", meta.Size),
 	)
 
 	return meta, nil
@@ -215,6 +301,10 @@ func (s *fileSystemService) IterateDir(ctx context.Context, token string, dirIno
 	const op = "service.fileSystemService.IterateDir"
 
 	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	if offset == nil {
+		logger.Debug("Missing offset")
+		return nil, &ServiceError{Code: kerrors.EINVAL, Message: "offset is required"}
+	}
 	logger.Debug("IterateDir",
 		slog.String("token", token),
 		slog.Int64("dir_ino", dirIno),
@@ -265,83 +355,28 @@ func (s *fileSystemService) CreateFile(ctx context.Context, token string, parent
 		slog.Uint64("mode", uint64(mode)),
 	)
 
-	isDir, err := s.inodeRepo.IsDir(ctx, token, parentIno)
-	if err != nil {
-		logger.Error("Failed to check if parent is directory", slogext.Err(err), slog.Int64("parent_ino", parentIno))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	if !isDir {
-		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
-		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+	inode := &models.Inode{
+		Token: token,
+		Type:  models.NodeTypeFile,
+		Mode:  mode,
 	}
 
-	exists, err := s.dirRepo.Exists(ctx, token, parentIno, name)
+	status, err := s.dirRepo.CreateInode(ctx, parentIno, name, inode)
 	if err != nil {
-		logger.Error("Failed to check if file exists", slogext.Err(err))
+		logger.Error("Failed to create file", slogext.Err(err), slog.String("name", name))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if exists {
+
+	switch status {
+	case repository.EntryParentNotDir:
+		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
+		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+	case repository.EntryExists:
 		logger.Debug("File already exists", slog.String("name", name), slog.Int64("parent_ino", parentIno))
 		return nil, &ServiceError{Code: kerrors.EEXIST, Message: "file already exists"}
 	}
 
-	var newIno int64
-	var inode *models.Inode
-
-	logger.Debug("Creating file in transaction", slog.String("name", name))
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		nextIno, err := s.fsRepo.GetNextIno(ctx, token)
-		if err != nil {
-			return err
-		}
-
-		newIno = nextIno
-		logger.Debug("Allocated new ino", slog.Int64("new_ino", newIno))
-
-		inode = &models.Inode{
-			Ino:      newIno,
-			Token:    token,
-			Type:     models.NodeTypeFile,
-			Mode:     mode,
-			Size:     0,
-			RefCount: 1,
-		}
-
-		if err := s.inodeRepo.Create(ctx, inode); err != nil {
-			return err
-		}
-
-		logger.Debug("Created inode", slog.Int64("ino", newIno))
-
-		if err := s.dirRepo.CreateEntry(ctx, token, parentIno, name, newIno); err != nil {
-			return err
-		}
-
-		logger.Debug("Created directory entry", slog.String("name", name), slog.Int64("ino", newIno))
-
-		if err := s.fsRepo.IncrementNextIno(ctx, token); err != nil {
-			return err
-		}
-
-		if err := s.contentRepo.Set(ctx, token, newIno, []byte{}); err != nil {
-			return err
-		}
-
-		logger.Debug("Created empty file contents", slog.Int64("ino", newIno))
-
-		return nil
-	})
-
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" {
-				logger.Debug("File already exists (unique violation)", slog.String("name", name))
-				return nil, &ServiceError{Code: kerrors.EEXIST, Message: "file already exists"}
-			}
-		}
-		logger.Error("Failed to create file", slogext.Err(err), slog.String("name", name))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
+	logger.Debug("Created inode", slog.Int64("ino", inode.Ino))
 
 	modeVal := inode.Mode
 	switch inode.Type {
@@ -359,6 +394,8 @@ func (s *fileSystemService) CreateFile(ctx context.Context, token string, parent
 		Size:      inode.Size,
 	}
 
+	s.publisher.Publish(models.Event{Type: models.EventCreate, Token: token, Ino: meta.Ino, ParentIno: parentIno, Name: name})
+
 	logger.Debug("File created successfully",
 		slog.String("name", name),
 		slog.Int64("ino", meta.Ino),
@@ -378,70 +415,88 @@ func (s *fileSystemService) Unlink(ctx context.Context, token string, parentIno
 		slog.String("name", name),
 	)
 
-	ino, err := s.dirRepo.Lookup(ctx, token, parentIno, name)
+	ino, refCount, status, err := s.dirRepo.UnlinkFile(ctx, token, parentIno, name)
 	if err != nil {
-		logger.Error("Failed to lookup entry", slogext.Err(err), slog.String("name", name))
+		logger.Error("Failed to unlink file", slogext.Err(err), slog.String("name", name))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if ino == 0 {
+	switch status {
+	case repository.EntryNotFound:
 		logger.Debug("File not found", slog.String("name", name), slog.Int64("parent_ino", parentIno))
 		return &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	case repository.EntryWrongType:
+		logger.Debug("Cannot unlink directory", slog.Int64("ino", ino))
+		return &ServiceError{Code: kerrors.EPERM, Message: "cannot unlink directory"}
 	}
 
-	logger.Debug("Found entry", slog.Int64("ino", ino))
+	// Inode is gone unless other links or open handles keep it
+	logger.Debug("Removed directory entry", slog.Int64("ino", ino), slog.Int("ref_count", refCount))
+
+	s.publisher.Publish(models.Event{Type: models.EventUnlink, Token: token, Ino: ino, ParentIno: parentIno, Name: name})
+
+	logger.Debug("File unlinked successfully", slog.String("name", name), slog.Int64("ino", ino))
+	return nil
+}
 
-	isFile, err := s.inodeRepo.IsFile(ctx, token, ino)
+// dropLink decrements ref_count of a file whose directory entry name in
+// parentIno was just removed and deletes the inode once nothing references
+// it. With trash enabled the last link goes to trash instead. Must be
+// called inside a transaction
+func (s *fileSystemService) dropLink(ctx context.Context, token string, ino int64, parentIno int64, name string) error {
+	const op = "service.fileSystemService.dropLink"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	current, err := s.inodeRepo.Get(ctx, token, ino)
 	if err != nil {
-		logger.Error("Failed to check if ino is file", slogext.Err(err), slog.Int64("ino", ino))
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if !isFile {
-		logger.Debug("Cannot unlink directory", slog.Int64("ino", ino))
-		return &ServiceError{Code: kerrors.EPERM, Message: "cannot unlink directory"}
+		return err
 	}
-
-	logger.Debug("Unlinking file in transaction", slog.Int64("ino", ino))
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		if err := s.dirRepo.DeleteEntry(ctx, token, parentIno, name); err != nil {
+	if current != nil && current.RefCount <= 1 {
+		trashed, err := s.trashRepo.Add(ctx, token, ino, parentIno, name)
+		if err != nil {
 			return err
 		}
+		if trashed {
+			logger.Debug("Moved last link to trash", slog.Int64("ino", ino))
+			return nil
+		}
+	}
 
-		logger.Debug("Deleted directory entry", slog.String("name", name))
+	if err := s.inodeRepo.UpdateRefCount(ctx, token, ino, -1); err != nil {
+		return err
+	}
 
-		if err := s.inodeRepo.UpdateRefCount(ctx, token, ino, -1); err != nil {
-			return err
-		}
+	logger.Debug("Decremented ref_count", slog.Int64("ino", ino))
 
-		logger.Debug("Decremented ref_count", slog.Int64("ino", ino))
+	inode, err := s.inodeRepo.Get(ctx, token, ino)
+	if err != nil {
+		return err
+	}
 
-		inode, err := s.inodeRepo.Get(ctx, token, ino)
+	if inode != nil && inode.RefCount == 0 {
+		openCount, err := s.handleRepo.CountOpen(ctx, token, ino)
 		if err != nil {
 			return err
 		}
-
-		if inode != nil && inode.RefCount == 0 {
-			logger.Debug("Ref count reached zero, deleting inode and contents", slog.Int64("ino", ino))
-			if err := s.contentRepo.Delete(ctx, token, ino); err != nil {
-				return err
-			}
-			if err := s.inodeRepo.Delete(ctx, token, ino); err != nil {
-				return err
-			}
-			logger.Debug("Deleted inode and contents", slog.Int64("ino", ino))
-		} else if inode != nil {
-			logger.Debug("Inode still has references, keeping it", slog.Int64("ino", ino), slog.Int("ref_count", inode.RefCount))
+		if openCount > 0 {
+			// POSIX: unlinked file stays accessible until the last close
+			logger.Debug("Inode is still open, deferring deletion", slog.Int64("ino", ino), slog.Int("open_count", openCount))
+			return nil
 		}
 
-		return nil
-	})
-
-	if err != nil {
-		logger.Error("Failed to unlink file", slogext.Err(err), slog.String("name", name))
-		return fmt.Errorf("%s: %w", op, err)
+		logger.Debug("Ref count reached zero, deleting inode and contents", slog.Int64("ino", ino))
+		if err := s.contentRepo.Delete(ctx, token, ino); err != nil {
+			return err
+		}
+		if err := s.inodeRepo.Delete(ctx, token, ino); err != nil {
+			return err
+		}
+		logger.Debug("Deleted inode and contents", slog.Int64("ino", ino))
+	} else if inode != nil {
+		logger.Debug("Inode still has references, keeping it", slog.Int64("ino", ino), slog.Int("ref_count", inode.RefCount))
 	}
 
-	logger.Debug("File unlinked successfully", slog.String("name", name), slog.Int64("ino", ino))
 	return nil
 }
 
@@ -456,77 +511,28 @@ func (s *fileSystemService) CreateDir(ctx context.Context, token string, parentI
 		slog.Uint64("mode", uint64(mode)),
 	)
 
-	isDir, err := s.inodeRepo.IsDir(ctx, token, parentIno)
-	if err != nil {
-		logger.Error("Failed to check if parent is directory", slogext.Err(err), slog.Int64("parent_ino", parentIno))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
-	if !isDir {
-		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
-		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+	inode := &models.Inode{
+		Token: token,
+		Type:  models.NodeTypeDir,
+		Mode:  mode,
 	}
 
-	exists, err := s.dirRepo.Exists(ctx, token, parentIno, name)
+	status, err := s.dirRepo.CreateInode(ctx, parentIno, name, inode)
 	if err != nil {
-		logger.Error("Failed to check if directory exists", slogext.Err(err))
+		logger.Error("Failed to create directory", slogext.Err(err), slog.String("name", name))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if exists {
+
+	switch status {
+	case repository.EntryParentNotDir:
+		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
+		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+	case repository.EntryExists:
 		logger.Debug("Directory already exists", slog.String("name", name), slog.Int64("parent_ino", parentIno))
 		return nil, &ServiceError{Code: kerrors.EEXIST, Message: "directory already exists"}
 	}
 
-	var newIno int64
-	var inode *models.Inode
-
-	logger.Debug("Creating directory in transaction", slog.String("name", name))
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		nextIno, err := s.fsRepo.GetNextIno(ctx, token)
-		if err != nil {
-			return err
-		}
-
-		newIno = nextIno
-		logger.Debug("Allocated new ino", slog.Int64("new_ino", newIno))
-
-		inode = &models.Inode{
-			Ino:      newIno,
-			Token:    token,
-			Type:     models.NodeTypeDir,
-			Mode:     mode,
-			Size:     0,
-			RefCount: 1,
-		}
-
-		if err := s.inodeRepo.Create(ctx, inode); err != nil {
-			return err
-		}
-
-		logger.Debug("Created inode", slog.Int64("ino", newIno))
-
-		if err := s.dirRepo.CreateEntry(ctx, token, parentIno, name, newIno); err != nil {
-			return err
-		}
-
-		logger.Debug("Created directory entry", slog.String("name", name), slog.Int64("ino", newIno))
-
-		if err := s.fsRepo.IncrementNextIno(ctx, token); err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" {
-				logger.Debug("Directory already exists (unique violation)", slog.String("name", name))
-				return nil, &ServiceError{Code: kerrors.EEXIST, Message: "directory already exists"}
-			}
-		}
-		logger.Error("Failed to create directory", slogext.Err(err), slog.String("name", name))
-		return nil, fmt.Errorf("%s: %w", op, err)
-	}
+	logger.Debug("Created inode", slog.Int64("ino", inode.Ino))
 
 	modeVal := inode.Mode
 	switch inode.Type {
@@ -544,6 +550,8 @@ func (s *fileSystemService) CreateDir(ctx context.Context, token string, parentI
 		Size:      inode.Size,
 	}
 
+	s.publisher.Publish(models.Event{Type: models.EventMkdir, Token: token, Ino: meta.Ino, ParentIno: parentIno, Name: name})
+
 	logger.Debug("Directory created successfully",
 		slog.String("name", name),
 		slog.Int64("ino", meta.Ino),
@@ -563,65 +571,25 @@ func (s *fileSystemService) Rmdir(ctx context.Context, token string, parentIno i
 		slog.String("name", name),
 	)
 
-	ino, err := s.dirRepo.Lookup(ctx, token, parentIno, name)
+	ino, status, err := s.dirRepo.RemoveDir(ctx, token, parentIno, name)
 	if err != nil {
-		logger.Error("Failed to lookup entry", slogext.Err(err), slog.String("name", name))
+		logger.Error("Failed to remove directory", slogext.Err(err), slog.String("name", name))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if ino == 0 {
+	switch status {
+	case repository.EntryNotFound:
 		logger.Debug("Directory not found", slog.String("name", name), slog.Int64("parent_ino", parentIno))
 		return &ServiceError{Code: kerrors.ENOENT, Message: "directory not found"}
-	}
-
-	logger.Debug("Found entry", slog.Int64("ino", ino))
-
-	isDir, err := s.inodeRepo.IsDir(ctx, token, ino)
-	if err != nil {
-		logger.Error("Failed to check if ino is directory", slogext.Err(err), slog.Int64("ino", ino))
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if !isDir {
+	case repository.EntryWrongType:
 		logger.Debug("Not a directory", slog.Int64("ino", ino))
 		return &ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"}
-	}
-
-	if ino == VTFS_ROOT_INO {
-		logger.Debug("Attempt to remove root directory", slog.Int64("ino", ino))
-		return &ServiceError{Code: kerrors.EPERM, Message: "cannot remove root directory"}
-	}
-
-	isEmpty, err := s.dirRepo.IsEmpty(ctx, token, ino)
-	if err != nil {
-		logger.Error("Failed to check if directory is empty", slogext.Err(err), slog.Int64("ino", ino))
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if !isEmpty {
+	case repository.EntryNotEmpty:
 		logger.Debug("Directory not empty", slog.Int64("ino", ino))
 		return &ServiceError{Code: kerrors.ENOTEMPTY, Message: "directory not empty"}
 	}
 
-	logger.Debug("Removing directory in transaction", slog.Int64("ino", ino))
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		if err := s.dirRepo.DeleteEntry(ctx, token, parentIno, name); err != nil {
-			return err
-		}
-
-		logger.Debug("Deleted directory entry", slog.String("name", name))
-
-		if err := s.inodeRepo.Delete(ctx, token, ino); err != nil {
-			return err
-		}
-
-		logger.Debug("Deleted inode", slog.Int64("ino", ino))
-
-		return nil
-	})
-
-	if err != nil {
-		logger.Error("Failed to remove directory", slogext.Err(err), slog.String("name", name))
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	s.publisher.Publish(models.Event{Type: models.EventRmdir, Token: token, Ino: ino, ParentIno: parentIno, Name: name})
 
 	logger.Debug("Directory removed successfully", slog.String("name", name), slog.Int64("ino", ino))
 	return nil
@@ -717,77 +685,155 @@ func (s *fileSystemService) Write(ctx context.Context, token string, ino int64,
 		return 0, &ServiceError{Code: kerrors.EINVAL, Message: "invalid offset"}
 	}
 
+	// Written as offset > max - length, offset + length may overflow
+	if length > uint64(s.maxFileSize) || offset > s.maxFileSize-int64(length) {
+		logger.Debug("Write past maximum file size", slog.Int64("offset", offset), slog.Uint64("length", length))
+		return 0, &ServiceError{Code: kerrors.EFBIG, Message: "file too large"}
+	}
+
 	writeData := data[:length]
 	logger.Debug("Using data slice",
 		slog.Uint64("length", length),
 		slog.Int("slice_len", len(writeData)))
 
-	inode, err := s.inodeRepo.Get(ctx, token, ino)
+	// The inode row lock orders writers of the same file, the size read
+	// under it is the one the chunks are rewritten for
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		inode, err := s.lockFile(ctx, token, ino)
+		if err != nil {
+			return err
+		}
+
+		newSize := max(inode.Size, offset+int64(length))
+		logger.Debug("Writing to file in transaction",
+			slog.Int64("current_size", inode.Size),
+			slog.Int64("new_size", newSize),
+			slog.Uint64("bytes_to_write", length),
+		)
+
+		if err := s.contentRepo.Write(ctx, token, ino, inode.Size, writeData, offset); err != nil {
+			return err
+		}
+
+		return s.inodeRepo.UpdateSize(ctx, token, ino, newSize)
+	})
+
 	if err != nil {
-		logger.Error("Failed to get inode", slogext.Err(err), slog.Int64("ino", ino))
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			logger.Debug("Not a file", slog.Int64("ino", ino))
+			return 0, serviceErr
+		}
+		logger.Error("Failed to write file", slogext.Err(err), slog.Int64("ino", ino))
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if inode == nil {
-		logger.Debug("File not found", slog.Int64("ino", ino))
-		return 0, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	s.publisher.Publish(models.Event{Type: models.EventWrite, Token: token, Ino: ino})
+
+	logger.Debug("Write successful",
+		slog.Int64("ino", ino),
+		slog.Uint64("bytes_written", length),
+		slog.Int64("offset", offset),
+	)
+
+	return int64(length), nil
+}
+
+func (s *fileSystemService) Truncate(ctx context.Context, token string, ino int64, size int64) error {
+	const op = "service.fileSystemService.Truncate"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Truncate",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Int64("size", size),
+	)
+
+	if size < 0 {
+		logger.Debug("Invalid size", slog.Int64("size", size))
+		return &ServiceError{Code: kerrors.EINVAL, Message: "invalid size"}
 	}
 
-	if inode.Type != models.NodeTypeFile {
-		logger.Debug("Is a directory, not a file", slog.Int64("ino", ino))
-		return 0, &ServiceError{Code: kerrors.EISDIR, Message: "is a directory"}
+	if size > s.maxFileSize {
+		logger.Debug("Size over maximum file size", slog.Int64("size", size))
+		return &ServiceError{Code: kerrors.EFBIG, Message: "file too large"}
 	}
 
-	logger.Debug("Writing to file in transaction",
-		slog.Int64("current_size", inode.Size),
-		slog.Int64("new_size", offset+int64(length)),
-		slog.Uint64("bytes_to_write", length),
-	)
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		currentData, err := s.contentRepo.Get(ctx, token, ino)
+	var oldSize int64
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		inode, err := s.lockFile(ctx, token, ino)
 		if err != nil {
 			return err
 		}
+		oldSize = inode.Size
 
-		oldSize := int64(len(currentData))
-
-		newSize := offset + int64(length)
-		if newSize > int64(len(currentData)) {
-			extended := make([]byte, newSize)
-			copy(extended, currentData)
-			currentData = extended
-			logger.Debug("Extended file size", slog.Int64("old_size", oldSize), slog.Int64("new_size", newSize))
+		if err := s.contentRepo.Truncate(ctx, token, ino, inode.Size, size); err != nil {
+			return err
 		}
 
-		copy(currentData[offset:], writeData)
+		return s.inodeRepo.UpdateSize(ctx, token, ino, size)
+	})
 
-		if err := s.contentRepo.Set(ctx, token, ino, currentData); err != nil {
-			return err
+	if err != nil {
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			logger.Debug("Not a file", slog.Int64("ino", ino))
+			return serviceErr
 		}
+		logger.Error("Failed to truncate file", slogext.Err(err), slog.Int64("ino", ino))
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-		logger.Debug("Saved file content", slog.Int64("new_size", int64(len(currentData))))
+	s.publisher.Publish(models.Event{Type: models.EventWrite, Token: token, Ino: ino})
 
-		if err := s.inodeRepo.UpdateSize(ctx, token, ino, int64(len(currentData))); err != nil {
-			return err
-		}
+	logger.Debug("Truncate successful",
+		slog.Int64("ino", ino),
+		slog.Int64("old_size", oldSize),
+		slog.Int64("new_size", size),
+	)
 
-		logger.Debug("Updated file size in inode", slog.Int64("new_size", int64(len(currentData))))
+	return nil
+}
 
-		return nil
+func (s *fileSystemService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error {
+	const op = "service.fileSystemService.ReplaceContent"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("ReplaceContent",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Int("size", len(data)),
+	)
+
+	if int64(len(data)) > s.maxFileSize {
+		logger.Debug("Size over maximum file size", slog.Int("size", len(data)))
+		return &ServiceError{Code: kerrors.EFBIG, Message: "file too large"}
+	}
+
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		if _, err := s.lockFile(ctx, token, ino); err != nil {
+			return err
+		}
+		if err := s.contentRepo.Set(ctx, token, ino, data); err != nil {
+			return err
+		}
+		return s.inodeRepo.UpdateSize(ctx, token, ino, int64(len(data)))
 	})
 
 	if err != nil {
-		logger.Error("Failed to write file", slogext.Err(err), slog.Int64("ino", ino))
-		return 0, fmt.Errorf("%s: %w", op, err)
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			logger.Debug("Not a file", slog.Int64("ino", ino))
+			return serviceErr
+		}
+		logger.Error("Failed to replace content", slogext.Err(err), slog.Int64("ino", ino))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	logger.Debug("Write successful",
-		slog.Int64("ino", ino),
-		slog.Uint64("bytes_written", length),
-		slog.Int64("offset", offset),
-	)
+	s.publisher.Publish(models.Event{Type: models.EventWrite, Token: token, Ino: ino})
 
-	return int64(length), nil
+	logger.Debug("ReplaceContent successful", slog.Int64("ino", ino), slog.Int("size", len(data)))
+	return nil
 }
 
 func (s *fileSystemService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error {
@@ -801,68 +847,167 @@ func (s *fileSystemService) Link(ctx context.Context, token string, targetIno in
 		slog.String("name", name),
 	)
 
-	targetInode, err := s.inodeRepo.Get(ctx, token, targetIno)
+	status, err := s.dirRepo.LinkFile(ctx, token, targetIno, parentIno, name)
 	if err != nil {
-		logger.Error("Failed to get target inode", slogext.Err(err), slog.Int64("target_ino", targetIno))
+		logger.Error("Failed to create hard link", slogext.Err(err), slog.String("name", name))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	if targetInode == nil {
+	switch status {
+	case repository.EntryNotFound:
 		logger.Debug("Target not found", slog.Int64("target_ino", targetIno))
 		return &ServiceError{Code: kerrors.ENOENT, Message: "target not found"}
-	}
-
-	if targetInode.Type != models.NodeTypeFile {
+	case repository.EntryWrongType:
 		logger.Debug("Cannot link directory", slog.Int64("target_ino", targetIno))
 		return &ServiceError{Code: kerrors.EISDIR, Message: "cannot link directory"}
+	case repository.EntryParentNotDir:
+		logger.Debug("Parent is not a directory", slog.Int64("parent_ino", parentIno))
+		return &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+	case repository.EntryExists:
+		logger.Debug("Name already exists", slog.String("name", name), slog.Int64("parent_ino", parentIno))
+		return &ServiceError{Code: kerrors.EEXIST, Message: "name already exists"}
 	}
 
-	logger.Debug("Target found", slog.Int64("target_ino", targetIno), slog.Int("current_ref_count", targetInode.RefCount))
+	s.publisher.Publish(models.Event{Type: models.EventLink, Token: token, Ino: targetIno, ParentIno: parentIno, Name: name})
 
-	exists, err := s.dirRepo.Exists(ctx, token, parentIno, name)
-	if err != nil {
-		logger.Error("Failed to check if name exists", slogext.Err(err))
-		return fmt.Errorf("%s: %w", op, err)
-	}
-	if exists {
-		logger.Debug("Name already exists", slog.String("name", name), slog.Int64("parent_ino", parentIno))
-		return &ServiceError{Code: kerrors.EEXIST, Message: "name already exists"}
+	logger.Debug("Hard link created successfully",
+		slog.String("name", name),
+		slog.Int64("target_ino", targetIno),
+		slog.Int64("parent_ino", parentIno),
+	)
+
+	return nil
+}
+
+// Rename moves entry oldName of oldParentIno to newName of newParentIno,
+// replacing an existing target the way rename(2) does: a file may replace a
+// file, a directory may replace an empty directory
+func (s *fileSystemService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error {
+	const op = "service.fileSystemService.Rename"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Rename",
+		slog.String("token", token),
+		slog.Int64("old_parent_ino", oldParentIno),
+		slog.String("old_name", oldName),
+		slog.Int64("new_parent_ino", newParentIno),
+		slog.String("new_name", newName),
+	)
+
+	if oldParentIno == newParentIno && oldName == newName {
+		return nil
 	}
 
-	logger.Debug("Creating hard link in transaction", slog.Int64("target_ino", targetIno))
-	err = postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
-		if err := s.dirRepo.CreateEntry(ctx, token, parentIno, name, targetIno); err != nil {
+	// Checks run on locked rows inside the transaction, so a concurrent
+	// create, unlink or rename can't change what they saw
+	var ino int64
+	renamed := false
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		isDir, err := s.inodeRepo.IsDir(ctx, token, newParentIno)
+		if err != nil {
 			return err
 		}
+		if !isDir {
+			logger.Debug("New parent is not a directory", slog.Int64("new_parent_ino", newParentIno))
+			return &ServiceError{Code: kerrors.ENOTDIR, Message: "parent is not a directory"}
+		}
 
-		logger.Debug("Created directory entry for link", slog.String("name", name), slog.Int64("target_ino", targetIno))
-
-		if err := s.inodeRepo.UpdateRefCount(ctx, token, targetIno, 1); err != nil {
+		inode, target, err := s.dirRepo.LockRenameEntries(ctx, token, oldParentIno, oldName, newParentIno, newName)
+		if err != nil {
 			return err
 		}
+		if inode == nil {
+			logger.Debug("Source not found", slog.Int64("old_parent_ino", oldParentIno), slog.String("old_name", oldName))
+			return &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+		}
+		ino = inode.Ino
 
-		logger.Debug("Incremented ref_count", slog.Int64("target_ino", targetIno), slog.Int("new_ref_count", targetInode.RefCount+1))
+		if target != nil && target.Ino == ino {
+			// Both names are hard links to the same file
+			logger.Debug("Source and target are the same inode", slog.Int64("ino", ino))
+			return nil
+		}
 
-		return nil
+		if inode.Type == models.NodeTypeDir && oldParentIno != newParentIno {
+			if err := s.dirRepo.LockTree(ctx, token); err != nil {
+				return err
+			}
+
+			// Directory cannot be moved into itself or its own subtree
+			isAncestor, err := s.dirRepo.IsAncestor(ctx, token, ino, newParentIno)
+			if err != nil {
+				return err
+			}
+			if isAncestor {
+				logger.Debug("Cannot move directory into its subtree", slog.Int64("ino", ino), slog.Int64("new_parent_ino", newParentIno))
+				return &ServiceError{Code: kerrors.EINVAL, Message: "cannot move directory into itself"}
+			}
+		}
+
+		if target != nil {
+			switch {
+			case inode.Type == models.NodeTypeDir && target.Type != models.NodeTypeDir:
+				return &ServiceError{Code: kerrors.ENOTDIR, Message: "target is not a directory"}
+			case inode.Type != models.NodeTypeDir && target.Type == models.NodeTypeDir:
+				return &ServiceError{Code: kerrors.EISDIR, Message: "target is a directory"}
+			case target.Type == models.NodeTypeDir:
+				isEmpty, err := s.dirRepo.IsEmpty(ctx, token, target.Ino)
+				if err != nil {
+					return err
+				}
+				if !isEmpty {
+					logger.Debug("Target directory not empty", slog.Int64("ino", target.Ino))
+					return &ServiceError{Code: kerrors.ENOTEMPTY, Message: "directory not empty"}
+				}
+			}
+
+			if err := s.dirRepo.DeleteEntry(ctx, token, newParentIno, newName); err != nil {
+				return err
+			}
+
+			if target.Type == models.NodeTypeDir {
+				if err := s.inodeRepo.Delete(ctx, token, target.Ino); err != nil {
+					return err
+				}
+			} else if err := s.dropLink(ctx, token, target.Ino, newParentIno, newName); err != nil {
+				return err
+			}
+
+			logger.Debug("Replaced existing target", slog.Int64("ino", target.Ino))
+		}
+
+		if err := s.dirRepo.DeleteEntry(ctx, token, oldParentIno, oldName); err != nil {
+			return err
+		}
+
+		renamed = true
+		return s.dirRepo.CreateEntry(ctx, token, newParentIno, newName, ino)
 	})
 
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" { // unique_violation
-				logger.Debug("Name already exists (unique violation)", slog.String("name", name))
-				return &ServiceError{Code: kerrors.EEXIST, Message: "name already exists"}
-			}
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			return serviceErr
 		}
-		logger.Error("Failed to create hard link", slogext.Err(err), slog.String("name", name))
+		logger.Error("Failed to rename", slogext.Err(err), slog.String("old_name", oldName), slog.String("new_name", newName))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	logger.Debug("Hard link created successfully",
-		slog.String("name", name),
-		slog.Int64("target_ino", targetIno),
-		slog.Int64("parent_ino", parentIno),
-	)
+	if !renamed {
+		return nil
+	}
 
+	s.publisher.Publish(models.Event{
+		Type:         models.EventRename,
+		Token:        token,
+		Ino:          ino,
+		ParentIno:    newParentIno,
+		Name:         newName,
+		OldParentIno: oldParentIno,
+		OldName:      oldName,
+	})
+
+	logger.Debug("Renamed successfully", slog.Int64("ino", ino), slog.String("new_name", newName))
 	return nil
 }
 
@@ -895,6 +1040,131 @@ func (s *fileSystemService) CountLinks(ctx context.Context, token string, ino in
 	return count, nil
 }
 
+func (s *fileSystemService) Open(ctx context.Context, token string, ino int64) (int64, error) {
+	const op = "service.fileSystemService.Open"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Open",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+	)
+
+	inode, err := s.inodeRepo.Get(ctx, token, ino)
+	if err != nil {
+		logger.Error("Failed to get inode", slogext.Err(err), slog.Int64("ino", ino))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if inode == nil {
+		logger.Debug("Inode not found", slog.Int64("ino", ino))
+		return 0, &ServiceError{Code: kerrors.ENOENT, Message: "inode not found"}
+	}
+
+	fh, err := s.handleRepo.Create(ctx, token, ino, s.handleLease)
+	if err != nil {
+		logger.Error("Failed to create handle", slogext.Err(err), slog.Int64("ino", ino))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Debug("Open successful",
+		slog.Int64("ino", ino),
+		slog.Int64("fh", fh),
+		slog.Duration("lease", s.handleLease),
+	)
+
+	return fh, nil
+}
+
+func (s *fileSystemService) Renew(ctx context.Context, token string, fh int64) error {
+	const op = "service.fileSystemService.Renew"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Renew",
+		slog.String("token", token),
+		slog.Int64("fh", fh),
+	)
+
+	renewed, err := s.handleRepo.Renew(ctx, token, fh, s.handleLease)
+	if err != nil {
+		logger.Error("Failed to renew handle", slogext.Err(err), slog.Int64("fh", fh))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !renewed {
+		logger.Debug("Handle not found", slog.Int64("fh", fh))
+		return &ServiceError{Code: kerrors.EBADF, Message: "handle not found"}
+	}
+
+	logger.Debug("Renew successful", slog.Int64("fh", fh))
+	return nil
+}
+
+func (s *fileSystemService) Release(ctx context.Context, token string, fh int64) error {
+	const op = "service.fileSystemService.Release"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("Release",
+		slog.String("token", token),
+		slog.Int64("fh", fh),
+	)
+
+	var ino int64
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		var err error
+		ino, err = s.handleRepo.Delete(ctx, token, fh)
+		if err != nil {
+			return err
+		}
+
+		if ino == 0 {
+			return &ServiceError{Code: kerrors.EBADF, Message: "handle not found"}
+		}
+
+		logger.Debug("Deleted handle", slog.Int64("fh", fh), slog.Int64("ino", ino))
+
+		inode, err := s.inodeRepo.Get(ctx, token, ino)
+		if err != nil {
+			return err
+		}
+
+		if inode == nil || inode.RefCount > 0 {
+			return nil
+		}
+
+		openCount, err := s.handleRepo.CountOpen(ctx, token, ino)
+		if err != nil {
+			return err
+		}
+		if openCount > 0 {
+			logger.Debug("Unlinked inode is still open", slog.Int64("ino", ino), slog.Int("open_count", openCount))
+			return nil
+		}
+
+		logger.Debug("Last handle of unlinked inode released, deleting inode and contents", slog.Int64("ino", ino))
+		if err := s.contentRepo.Delete(ctx, token, ino); err != nil {
+			return err
+		}
+		if err := s.inodeRepo.Delete(ctx, token, ino); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			logger.Debug("Handle not found", slog.Int64("fh", fh))
+			return serviceErr
+		}
+		logger.Error("Failed to release handle", slogext.Err(err), slog.Int64("fh", fh))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Debug("Release successful", slog.Int64("fh", fh), slog.Int64("ino", ino))
+	return nil
+}
+
 type ServiceError struct {
 	Code    int64
 	Message string
@@ -907,3 +1177,25 @@ func (e *ServiceError) Error() string {
 func (e *ServiceError) GetCode() int64 {
 	return e.Code
 }
+
+// ErrorCode returns kernel error code carried by err. Transaction conflicts
+// that outlived retries are reported as EAGAIN, other unexpected errors as ENOMEM
+func ErrorCode(err error) int64 {
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Code
+	}
+	if postgresql.IsConflict(err) {
+		return kerrors.EAGAIN
+	}
+	return kerrors.ENOMEM_NEG
+}
+
+// SplitPath cleans slash-separated path and splits it into components, root yields none
+func SplitPath(p string) []string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if cleaned == "" {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// HandleReaper reclaims handles whose lease has expired (e.g. client crashed
+// without calling release) and deletes unlinked inodes nobody holds open anymore
+type HandleReaper struct {
+	db         postgresql.Client
+	handleRepo repository.HandleRepository
+	inodeRepo  repository.InodeRepository
+	interval   time.Duration
+}
+
+func NewHandleReaper(
+	db postgresql.Client,
+	handleRepo repository.HandleRepository,
+	inodeRepo repository.InodeRepository,
+	interval time.Duration,
+) *HandleReaper {
+	return &HandleReaper{
+		db:         db,
+		handleRepo: handleRepo,
+		inodeRepo:  inodeRepo,
+		interval:   interval,
+	}
+}
+
+// Run blocks until ctx is cancelled
+func (r *HandleReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
+
+func (r *HandleReaper) reap(ctx context.Context) {
+	const op = "service.HandleReaper.reap"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	var expired, orphans int64
+	err := postgresql.WithTransaction(ctx, r.db, func(ctx context.Context) error {
+		var err error
+		expired, err = r.handleRepo.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		orphans, err = r.inodeRepo.DeleteOrphans(ctx)
+		return err
+	})
+
+	if err != nil {
+		logger.Error("Failed to reap expired handles", slogext.Err(err))
+		return
+	}
+
+	if expired > 0 || orphans > 0 {
+		logger.Info("Reaped expired handles",
+			slog.Int64("expired_handles", expired),
+			slog.Int64("deleted_inodes", orphans),
+		)
+	}
+}
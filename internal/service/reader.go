@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Reader streams file content through FileSystemService one chunk at a
+// time, so a large file never has to be held in memory at once. It
+// implements io.ReadSeeker and io.ReaderAt, which is what http.ServeContent
+// needs to answer Range requests
+type Reader struct {
+	ctx     context.Context
+	service FileSystemService
+	token   string
+	ino     int64
+	size    int64
+	offset  int64
+
+	// Last chunk read and its offset in the file
+	chunk       []byte
+	chunkStart  int64
+	chunkLength int
+}
+
+// NewReader reads file ino of size bytes in chunks of chunkSize
+func NewReader(ctx context.Context, service FileSystemService, token string, ino int64, size int64, chunkSize int) *Reader {
+	return &Reader{
+		ctx:     ctx,
+		service: service,
+		token:   token,
+		ino:     ino,
+		size:    size,
+		chunk:   make([]byte, max(chunkSize, 1)),
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("service.Reader.ReadAt: negative offset")
+	}
+
+	read := 0
+	for read < len(p) {
+		pos := offset + int64(read)
+		if pos < r.chunkStart || pos >= r.chunkStart+int64(r.chunkLength) {
+			if err := r.fill(pos); err != nil {
+				return read, err
+			}
+		}
+		read += copy(p[read:], r.chunk[pos-r.chunkStart:r.chunkLength])
+	}
+	return read, nil
+}
+
+// fill loads chunk starting at offset, io.EOF if there is nothing left
+func (r *Reader) fill(offset int64) error {
+	if offset >= r.size {
+		return io.EOF
+	}
+
+	n, err := r.service.Read(r.ctx, r.token, r.ino, r.chunk, offset)
+	if err != nil {
+		r.chunkLength = 0
+		return err
+	}
+	// File was truncated after size was taken
+	if n == 0 {
+		r.chunkLength = 0
+		return io.EOF
+	}
+
+	r.chunkStart = offset
+	r.chunkLength = int(n)
+	return nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("service.Reader.Seek: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("service.Reader.Seek: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,495 @@
+// Package servicetest provides an in-memory FileSystemService for tests of
+// the frontends (9P, SFTP, WebDAV), so they run without PostgreSQL.
+package servicetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+// RootIno is the inode number of the root of every filesystem, as in the database
+const RootIno = 1000
+
+type node struct {
+	typ   models.NodeType
+	mode  uint32
+	data  []byte
+	links int
+	// Directories only: name to ino
+	entries map[string]int64
+	// Files only: number of open handles
+	open int
+}
+
+type tree struct {
+	nodes map[int64]*node
+	next  int64
+}
+
+// Memory keeps filesystems in memory with the semantics of the real
+// service for the namespace, contents and handles. Trash and versions are
+// not supported. Safe for concurrent use
+type Memory struct {
+	mu      sync.Mutex
+	trees   map[string]*tree
+	handles map[int64]int64 // fh to ino
+	nextFh  int64
+}
+
+var _ service.FileSystemService = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		trees:   make(map[string]*tree),
+		handles: make(map[int64]int64),
+		nextFh:  1,
+	}
+}
+
+func fail(code int64, message string) error {
+	return &service.ServiceError{Code: code, Message: message}
+}
+
+// tree returns filesystem of token, created on first use. m.mu must be held
+func (m *Memory) tree(token string) *tree {
+	t, ok := m.trees[token]
+	if !ok {
+		t = &tree{nodes: make(map[int64]*node), next: RootIno + 1}
+		t.nodes[RootIno] = &node{typ: models.NodeTypeDir, mode: 0o755, links: 1, entries: make(map[string]int64)}
+		m.trees[token] = t
+	}
+	return t
+}
+
+func (t *tree) meta(ino int64, parentIno int64) *models.NodeMeta {
+	n := t.nodes[ino]
+	return &models.NodeMeta{Ino: ino, ParentIno: parentIno, Type: n.typ, Mode: n.mode, Size: int64(len(n.data))}
+}
+
+func (t *tree) dir(ino int64) (*node, error) {
+	n, ok := t.nodes[ino]
+	switch {
+	case !ok:
+		return nil, fail(kerrors.ENOENT, "directory not found")
+	case n.typ != models.NodeTypeDir:
+		return nil, fail(kerrors.ENOTDIR, "not a directory")
+	}
+	return n, nil
+}
+
+func (t *tree) file(ino int64) (*node, error) {
+	n, ok := t.nodes[ino]
+	switch {
+	case !ok:
+		return nil, fail(kerrors.ENOENT, "file not found")
+	case n.typ != models.NodeTypeFile:
+		return nil, fail(kerrors.EISDIR, "is a directory")
+	}
+	return n, nil
+}
+
+// dropLink releases one link of file ino and deletes it once nothing refers to it
+func (t *tree) dropLink(ino int64) {
+	n := t.nodes[ino]
+	n.links--
+	if n.links == 0 && n.open == 0 {
+		delete(t.nodes, ino)
+	}
+}
+
+func (m *Memory) Init(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tree(token)
+	return nil
+}
+
+func (m *Memory) GetRoot(ctx context.Context, token string) (*models.NodeMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.tree(token).meta(RootIno, RootIno), nil
+}
+
+func (m *Memory) Lookup(ctx context.Context, token string, parentIno int64, name string) (*models.NodeMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	dir, err := t.dir(parentIno)
+	if err != nil {
+		return nil, err
+	}
+	ino, ok := dir.entries[name]
+	if !ok {
+		return nil, fail(kerrors.ENOENT, "entry not found")
+	}
+	return t.meta(ino, parentIno), nil
+}
+
+func (m *Memory) ResolvePath(ctx context.Context, token string, path string) (*models.NodeMeta, error) {
+	meta, err := m.GetRoot(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range service.SplitPath(path) {
+		if meta, err = m.Lookup(ctx, token, meta.Ino, name); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+func (m *Memory) IterateDir(ctx context.Context, token string, dirIno int64, offset *uint64) (*models.Dirent, error) {
+	if offset == nil {
+		return nil, fail(kerrors.EINVAL, "offset is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	dir, err := t.dir(dirIno)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are ordered by name, as in the database
+	names := make([]string, 0, len(dir.entries))
+	for name := range dir.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if *offset >= uint64(len(names)) {
+		return nil, fail(kerrors.ENOENT, "no more entries")
+	}
+
+	name := names[*offset]
+	*offset++
+	ino := dir.entries[name]
+	return &models.Dirent{Name: name, Ino: ino, Type: t.nodes[ino].typ}, nil
+}
+
+func (m *Memory) create(token string, parentIno int64, name string, n *node) (*models.NodeMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	dir, err := t.dir(parentIno)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := dir.entries[name]; ok {
+		return nil, fail(kerrors.EEXIST, "entry already exists")
+	}
+
+	ino := t.next
+	t.next++
+	n.links = 1
+	t.nodes[ino] = n
+	dir.entries[name] = ino
+	return t.meta(ino, parentIno), nil
+}
+
+func (m *Memory) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	return m.create(token, parentIno, name, &node{typ: models.NodeTypeFile, mode: mode, data: []byte{}})
+}
+
+func (m *Memory) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	return m.create(token, parentIno, name, &node{typ: models.NodeTypeDir, mode: mode, entries: make(map[string]int64)})
+}
+
+func (m *Memory) Unlink(ctx context.Context, token string, parentIno int64, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	dir, err := t.dir(parentIno)
+	if err != nil {
+		return err
+	}
+	ino, ok := dir.entries[name]
+	switch {
+	case !ok:
+		return fail(kerrors.ENOENT, "file not found")
+	case t.nodes[ino].typ == models.NodeTypeDir:
+		return fail(kerrors.EPERM, "cannot unlink directory")
+	}
+
+	delete(dir.entries, name)
+	t.dropLink(ino)
+	return nil
+}
+
+func (m *Memory) Rmdir(ctx context.Context, token string, parentIno int64, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	dir, err := t.dir(parentIno)
+	if err != nil {
+		return err
+	}
+	ino, ok := dir.entries[name]
+	switch {
+	case !ok:
+		return fail(kerrors.ENOENT, "directory not found")
+	case t.nodes[ino].typ != models.NodeTypeDir:
+		return fail(kerrors.ENOTDIR, "not a directory")
+	case len(t.nodes[ino].entries) > 0:
+		return fail(kerrors.ENOTEMPTY, "directory not empty")
+	}
+
+	delete(dir.entries, name)
+	delete(t.nodes, ino)
+	return nil
+}
+
+func (m *Memory) Read(ctx context.Context, token string, ino int64, buffer []byte, offset int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.tree(token).file(ino)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, fail(kerrors.EINVAL, "invalid offset")
+	}
+	if offset >= int64(len(n.data)) {
+		return 0, nil
+	}
+	return int64(copy(buffer, n.data[offset:])), nil
+}
+
+func (m *Memory) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (int64, error) {
+	if length > uint64(len(data)) || offset < 0 {
+		return 0, fail(kerrors.EINVAL, "invalid write range")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.tree(token).file(ino)
+	if err != nil {
+		return 0, err
+	}
+	end := offset + int64(length)
+	if end > int64(len(n.data)) {
+		n.data = append(n.data, make([]byte, end-int64(len(n.data)))...)
+	}
+	copy(n.data[offset:], data[:length])
+	return int64(length), nil
+}
+
+func (m *Memory) Truncate(ctx context.Context, token string, ino int64, size int64) error {
+	if size < 0 {
+		return fail(kerrors.EINVAL, "invalid size")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.tree(token).file(ino)
+	if err != nil {
+		return err
+	}
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	return nil
+}
+
+func (m *Memory) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.tree(token).file(ino)
+	if err != nil {
+		return err
+	}
+	n.data = append([]byte{}, data...)
+	return nil
+}
+
+func (m *Memory) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	target, err := t.file(targetIno)
+	if err != nil {
+		return err
+	}
+	if target.links == 0 {
+		return fail(kerrors.ENOENT, "target not found")
+	}
+	dir, err := t.dir(parentIno)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.entries[name]; ok {
+		return fail(kerrors.EEXIST, "name already exists")
+	}
+
+	dir.entries[name] = targetIno
+	target.links++
+	return nil
+}
+
+func (m *Memory) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tree(token)
+	oldDir, err := t.dir(oldParentIno)
+	if err != nil {
+		return err
+	}
+	newDir, err := t.dir(newParentIno)
+	if err != nil {
+		return err
+	}
+	ino, ok := oldDir.entries[oldName]
+	if !ok {
+		return fail(kerrors.ENOENT, "file not found")
+	}
+	if oldParentIno == newParentIno && oldName == newName {
+		return nil
+	}
+
+	if t.nodes[ino].typ == models.NodeTypeDir && t.isAncestor(ino, newParentIno) {
+		return fail(kerrors.EINVAL, "cannot move directory into itself")
+	}
+
+	if targetIno, ok := newDir.entries[newName]; ok {
+		if targetIno == ino {
+			return nil
+		}
+		source, target := t.nodes[ino], t.nodes[targetIno]
+		switch {
+		case source.typ == models.NodeTypeDir && target.typ != models.NodeTypeDir:
+			return fail(kerrors.ENOTDIR, "target is not a directory")
+		case source.typ != models.NodeTypeDir && target.typ == models.NodeTypeDir:
+			return fail(kerrors.EISDIR, "target is a directory")
+		case target.typ == models.NodeTypeDir && len(target.entries) > 0:
+			return fail(kerrors.ENOTEMPTY, "directory not empty")
+		}
+
+		delete(newDir.entries, newName)
+		if target.typ == models.NodeTypeDir {
+			delete(t.nodes, targetIno)
+		} else {
+			t.dropLink(targetIno)
+		}
+	}
+
+	delete(oldDir.entries, oldName)
+	newDir.entries[newName] = ino
+	return nil
+}
+
+// isAncestor reports whether directory ino is dirIno or one of its parents
+func (t *tree) isAncestor(ino int64, dirIno int64) bool {
+	if ino == dirIno {
+		return true
+	}
+	for _, n := range t.nodes[ino].entries {
+		if t.nodes[n].typ == models.NodeTypeDir && t.isAncestor(n, dirIno) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CountLinks(ctx context.Context, token string, ino int64) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.tree(token).nodes[ino]
+	if !ok {
+		return 0, fail(kerrors.ENOENT, "inode not found")
+	}
+	return uint32(n.links), nil
+}
+
+func (m *Memory) Open(ctx context.Context, token string, ino int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.tree(token).file(ino)
+	if err != nil {
+		return 0, err
+	}
+	n.open++
+
+	fh := m.nextFh
+	m.nextFh++
+	m.handles[fh] = ino
+	return fh, nil
+}
+
+func (m *Memory) Renew(ctx context.Context, token string, fh int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.handles[fh]; !ok {
+		return fail(kerrors.EBADF, "handle not found")
+	}
+	return nil
+}
+
+func (m *Memory) Release(ctx context.Context, token string, fh int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ino, ok := m.handles[fh]
+	if !ok {
+		return fail(kerrors.EBADF, "handle not found")
+	}
+	delete(m.handles, fh)
+
+	t := m.tree(token)
+	n := t.nodes[ino]
+	n.open--
+	if n.links == 0 && n.open == 0 {
+		delete(t.nodes, ino)
+	}
+	return nil
+}
+
+func (m *Memory) SetTrash(ctx context.Context, token string, enabled bool) error {
+	return fail(kerrors.EOPNOTSUPP, "trash is not supported")
+}
+
+func (m *Memory) ListTrash(ctx context.Context, token string) ([]models.TrashEntry, error) {
+	return nil, fail(kerrors.EOPNOTSUPP, "trash is not supported")
+}
+
+func (m *Memory) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error) {
+	return nil, fail(kerrors.EOPNOTSUPP, "trash is not supported")
+}
+
+func (m *Memory) SetVersioning(ctx context.Context, token string, ino int64, keep int) error {
+	return fail(kerrors.EOPNOTSUPP, "versions are not supported")
+}
+
+func (m *Memory) ListVersions(ctx context.Context, token string, ino int64) ([]models.FileVersion, error) {
+	return nil, fail(kerrors.EOPNOTSUPP, "versions are not supported")
+}
+
+func (m *Memory) ReadVersion(ctx context.Context, token string, ino int64, version int64) ([]byte, error) {
+	return nil, fail(kerrors.EOPNOTSUPP, "versions are not supported")
+}
+
+func (m *Memory) RestoreVersion(ctx context.Context, token string, ino int64, version int64) error {
+	return fail(kerrors.EOPNOTSUPP, "versions are not supported")
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+func (s *fileSystemService) SetTrash(ctx context.Context, token string, enabled bool) error {
+	const op = "service.fileSystemService.SetTrash"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("SetTrash",
+		slog.String("token", token),
+		slog.Bool("enabled", enabled),
+	)
+
+	found, err := s.fsRepo.SetTrashEnabled(ctx, token, enabled)
+	if err != nil {
+		logger.Error("Failed to update trash setting", slogext.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !found {
+		logger.Debug("Filesystem not found", slog.String("token", token))
+		return &ServiceError{Code: kerrors.ENOENT, Message: "filesystem not found"}
+	}
+
+	return nil
+}
+
+func (s *fileSystemService) ListTrash(ctx context.Context, token string) ([]models.TrashEntry, error) {
+	const op = "service.fileSystemService.ListTrash"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("ListTrash", slog.String("token", token))
+
+	entries, err := s.trashRepo.List(ctx, token)
+	if err != nil {
+		logger.Error("Failed to list trash", slogext.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+func (s *fileSystemService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error) {
+	const op = "service.fileSystemService.RestoreTrash"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("RestoreTrash",
+		slog.String("token", token),
+		slog.Int64("id", id),
+		slog.Int64("parent_ino", parentIno),
+		slog.String("name", name),
+	)
+
+	entry, status, err := s.dirRepo.RestoreEntry(ctx, token, id, parentIno, name)
+	if err != nil {
+		logger.Error("Failed to restore from trash", slogext.Err(err), slog.Int64("id", id))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch status {
+	case repository.EntryNotFound:
+		logger.Debug("Trash entry not found", slog.Int64("id", id))
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "trash entry not found"}
+	case repository.EntryParentNotDir:
+		logger.Debug("Target directory is missing", slog.Int64("parent_ino", entry.ParentIno))
+		return nil, &ServiceError{Code: kerrors.ENOTDIR, Message: "target directory does not exist"}
+	case repository.EntryExists:
+		logger.Debug("Name already exists", slog.String("name", entry.Name), slog.Int64("parent_ino", entry.ParentIno))
+		return nil, &ServiceError{Code: kerrors.EEXIST, Message: "name already exists"}
+	}
+
+	s.publisher.Publish(models.Event{Type: models.EventCreate, Token: token, Ino: entry.Ino, ParentIno: entry.ParentIno, Name: entry.Name})
+
+	logger.Debug("Restored from trash",
+		slog.Int64("ino", entry.Ino),
+		slog.Int64("parent_ino", entry.ParentIno),
+		slog.String("name", entry.Name),
+	)
+
+	return &models.NodeMeta{
+		Ino:       entry.Ino,
+		ParentIno: entry.ParentIno,
+		Type:      models.NodeTypeFile,
+		Mode:      S_IFREG | (entry.Mode & S_IRWXUGO),
+		Size:      entry.Size,
+	}, nil
+}
+
+// TrashPurger deletes files that stayed in trash longer than ttl
+type TrashPurger struct {
+	db        postgresql.Client
+	trashRepo repository.TrashRepository
+	inodeRepo repository.InodeRepository
+	ttl       time.Duration
+	interval  time.Duration
+}
+
+func NewTrashPurger(
+	db postgresql.Client,
+	trashRepo repository.TrashRepository,
+	inodeRepo repository.InodeRepository,
+	ttl time.Duration,
+	interval time.Duration,
+) *TrashPurger {
+	return &TrashPurger{
+		db:        db,
+		trashRepo: trashRepo,
+		inodeRepo: inodeRepo,
+		ttl:       ttl,
+		interval:  interval,
+	}
+}
+
+// Run blocks until ctx is cancelled
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.purge(ctx)
+		}
+	}
+}
+
+func (p *TrashPurger) purge(ctx context.Context) {
+	const op = "service.TrashPurger.purge"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+
+	var purged, deleted int64
+	err := postgresql.WithTransaction(ctx, p.db, func(ctx context.Context) error {
+		var err error
+		purged, err = p.trashRepo.Purge(ctx, p.ttl)
+		if err != nil {
+			return err
+		}
+
+		// Files still held open stay until the last handle is released
+		deleted, err = p.inodeRepo.DeleteOrphans(ctx)
+		return err
+	})
+
+	if err != nil {
+		logger.Error("Failed to purge trash", slogext.Err(err))
+		return
+	}
+
+	if purged > 0 {
+		logger.Info("Purged trash",
+			slog.Int64("purged_entries", purged),
+			slog.Int64("deleted_inodes", deleted),
+		)
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+)
+
+// MaxKeepVersions bounds versions kept per file. Versions share unchanged
+// chunks, each one costs the chunks its change rewrote
+const MaxKeepVersions = 100
+
+// getFile returns inode ino, ENOENT or EISDIR if it is not a file
+func (s *fileSystemService) getFile(ctx context.Context, token string, ino int64) (*models.Inode, error) {
+	inode, err := s.inodeRepo.Get(ctx, token, ino)
+	if err != nil {
+		return nil, err
+	}
+	if inode == nil {
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	}
+	if inode.Type != models.NodeTypeFile {
+		return nil, &ServiceError{Code: kerrors.EISDIR, Message: "is a directory"}
+	}
+	return inode, nil
+}
+
+// lockFile is getFile that locks the inode until the transaction ends
+func (s *fileSystemService) lockFile(ctx context.Context, token string, ino int64) (*models.Inode, error) {
+	inode, err := s.inodeRepo.GetForUpdate(ctx, token, ino)
+	if err != nil {
+		return nil, err
+	}
+	if inode == nil {
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	}
+	if inode.Type != models.NodeTypeFile {
+		return nil, &ServiceError{Code: kerrors.EISDIR, Message: "is a directory"}
+	}
+	return inode, nil
+}
+
+func (s *fileSystemService) SetVersioning(ctx context.Context, token string, ino int64, keep int) error {
+	const op = "service.fileSystemService.SetVersioning"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("SetVersioning",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Int("keep", keep),
+	)
+
+	if keep < 0 || keep > MaxKeepVersions {
+		logger.Debug("Invalid number of versions", slog.Int("keep", keep))
+		return &ServiceError{Code: kerrors.EINVAL, Message: fmt.Sprintf("keep must be between 0 and %d", MaxKeepVersions)}
+	}
+
+	if _, err := s.getFile(ctx, token, ino); err != nil {
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			return serviceErr
+		}
+		logger.Error("Failed to get inode", slogext.Err(err), slog.Int64("ino", ino))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	found, err := s.contentRepo.SetKeepVersions(ctx, token, ino, keep)
+	if err != nil {
+		logger.Error("Failed to update versioning", slogext.Err(err), slog.Int64("ino", ino))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !found {
+		logger.Debug("File not found", slog.Int64("ino", ino))
+		return &ServiceError{Code: kerrors.ENOENT, Message: "file not found"}
+	}
+
+	return nil
+}
+
+func (s *fileSystemService) ListVersions(ctx context.Context, token string, ino int64) ([]models.FileVersion, error) {
+	const op = "service.fileSystemService.ListVersions"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("ListVersions",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+	)
+
+	if _, err := s.getFile(ctx, token, ino); err != nil {
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			return nil, serviceErr
+		}
+		logger.Error("Failed to get inode", slogext.Err(err), slog.Int64("ino", ino))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	versions, err := s.contentRepo.ListVersions(ctx, token, ino)
+	if err != nil {
+		logger.Error("Failed to list versions", slogext.Err(err), slog.Int64("ino", ino))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return versions, nil
+}
+
+func (s *fileSystemService) ReadVersion(ctx context.Context, token string, ino int64, version int64) ([]byte, error) {
+	const op = "service.fileSystemService.ReadVersion"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("ReadVersion",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Int64("version", version),
+	)
+
+	data, found, err := s.contentRepo.GetVersion(ctx, token, ino, version)
+	if err != nil {
+		logger.Error("Failed to read version", slogext.Err(err), slog.Int64("ino", ino))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !found {
+		logger.Debug("Version not found", slog.Int64("ino", ino), slog.Int64("version", version))
+		return nil, &ServiceError{Code: kerrors.ENOENT, Message: "version not found"}
+	}
+
+	return data, nil
+}
+
+// RestoreVersion makes version the current content. For a file that is
+// still versioned this is a new version itself, so the restore can be undone
+func (s *fileSystemService) RestoreVersion(ctx context.Context, token string, ino int64, version int64) error {
+	const op = "service.fileSystemService.RestoreVersion"
+
+	logger := logging.GetLoggerFromContextWithOp(ctx, op)
+	logger.Debug("RestoreVersion",
+		slog.String("token", token),
+		slog.Int64("ino", ino),
+		slog.Int64("version", version),
+	)
+
+	err := postgresql.WithTransaction(ctx, s.db, func(ctx context.Context) error {
+		if _, err := s.lockFile(ctx, token, ino); err != nil {
+			return err
+		}
+
+		data, found, err := s.contentRepo.GetVersion(ctx, token, ino, version)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return &ServiceError{Code: kerrors.ENOENT, Message: "version not found"}
+		}
+
+		if err := s.contentRepo.Set(ctx, token, ino, data); err != nil {
+			return err
+		}
+
+		return s.inodeRepo.UpdateSize(ctx, token, ino, int64(len(data)))
+	})
+
+	if err != nil {
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) {
+			logger.Debug("Version not restored", slog.Int64("ino", ino), slog.Int64("version", version), slog.String("reason", serviceErr.Message))
+			return serviceErr
+		}
+		logger.Error("Failed to restore version", slogext.Err(err), slog.Int64("ino", ino), slog.Int64("version", version))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.publisher.Publish(models.Event{Type: models.EventWrite, Token: token, Ino: ino})
+
+	logger.Debug("Version restored", slog.Int64("ino", ino), slog.Int64("version", version))
+	return nil
+}
@@ -0,0 +1,311 @@
+package sftpd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/pkg/sftp"
+)
+
+const (
+	defaultFileMode uint32 = 0o644
+	defaultDirMode  uint32 = 0o755
+)
+
+// handlers translate SFTP requests of one session into FileSystemService
+// calls on the session's token
+type handlers struct {
+	// Connection context, request contexts of pkg/sftp carry no logger
+	ctx     context.Context
+	service service.FileSystemService
+	token   string
+}
+
+func newHandlers(ctx context.Context, service service.FileSystemService, token string) sftp.Handlers {
+	h := &handlers{ctx: ctx, service: service, token: token}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	meta, err := h.service.ResolvePath(h.ctx, h.token, r.Filepath)
+	if err != nil {
+		return nil, service.PathError("open", r.Filepath, err)
+	}
+
+	f, err := h.open(r.Filepath, meta)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return h.OpenFile(r)
+}
+
+// OpenFile serves opens with any combination of flags, including read-write
+func (h *handlers) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	flags := r.Pflags()
+
+	meta, err := h.service.ResolvePath(h.ctx, h.token, r.Filepath)
+	switch {
+	case service.ErrorCode(err) == kerrors.ENOENT && flags.Creat:
+		parent, name, err := h.resolveParent(r.Filepath)
+		if err != nil {
+			return nil, service.PathError("open", r.Filepath, err)
+		}
+
+		mode := defaultFileMode
+		if r.AttrFlags().Permissions {
+			mode = uint32(r.Attributes().FileMode().Perm())
+		}
+
+		meta, err = h.service.CreateFile(h.ctx, h.token, parent.Ino, name, mode)
+		if err != nil {
+			return nil, service.PathError("open", r.Filepath, err)
+		}
+	case err != nil:
+		return nil, service.PathError("open", r.Filepath, err)
+	case flags.Creat && flags.Excl:
+		return nil, service.PathError("open", r.Filepath, &service.ServiceError{Code: kerrors.EEXIST, Message: "file exists"})
+	}
+
+	if meta.Type == models.NodeTypeFile && flags.Trunc {
+		if err := h.service.Truncate(h.ctx, h.token, meta.Ino, 0); err != nil {
+			return nil, service.PathError("open", r.Filepath, err)
+		}
+	}
+
+	f, err := h.open(r.Filepath, meta)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (h *handlers) open(name string, meta *models.NodeMeta) (*file, error) {
+	if meta.Type == models.NodeTypeDir {
+		return nil, service.PathError("open", name, &service.ServiceError{Code: kerrors.EISDIR, Message: "is a directory"})
+	}
+
+	// Keep the inode alive if it is unlinked while the transfer is running
+	fh, err := h.service.Open(h.ctx, h.token, meta.Ino)
+	if err != nil {
+		return nil, service.PathError("open", name, err)
+	}
+
+	return &file{h: h, name: name, ino: meta.Ino, fh: fh}, nil
+}
+
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return h.setstat(r)
+
+	case "Rename", "PosixRename":
+		oldParent, oldName, err := h.resolveParent(r.Filepath)
+		if err != nil {
+			return service.PathError("rename", r.Filepath, err)
+		}
+		newParent, newName, err := h.resolveParent(r.Target)
+		if err != nil {
+			return service.PathError("rename", r.Target, err)
+		}
+
+		// Plain SFTP rename must not replace the target, posix-rename@openssh.com may
+		if r.Method == "Rename" {
+			_, err := h.service.Lookup(h.ctx, h.token, newParent.Ino, newName)
+			if err == nil {
+				return service.PathError("rename", r.Target, &service.ServiceError{Code: kerrors.EEXIST, Message: "file exists"})
+			}
+			if service.ErrorCode(err) != kerrors.ENOENT {
+				return service.PathError("rename", r.Target, err)
+			}
+		}
+
+		err = h.service.Rename(h.ctx, h.token, oldParent.Ino, oldName, newParent.Ino, newName)
+		return service.PathError("rename", r.Filepath, err)
+
+	case "Mkdir":
+		parent, name, err := h.resolveParent(r.Filepath)
+		if err != nil {
+			return service.PathError("mkdir", r.Filepath, err)
+		}
+
+		mode := defaultDirMode
+		if r.AttrFlags().Permissions {
+			mode = uint32(r.Attributes().FileMode().Perm())
+		}
+
+		_, err = h.service.CreateDir(h.ctx, h.token, parent.Ino, name, mode)
+		return service.PathError("mkdir", r.Filepath, err)
+
+	case "Rmdir":
+		parent, name, err := h.resolveParent(r.Filepath)
+		if err != nil {
+			return service.PathError("rmdir", r.Filepath, err)
+		}
+		return service.PathError("rmdir", r.Filepath, h.service.Rmdir(h.ctx, h.token, parent.Ino, name))
+
+	case "Remove":
+		parent, name, err := h.resolveParent(r.Filepath)
+		if err != nil {
+			return service.PathError("remove", r.Filepath, err)
+		}
+		return service.PathError("remove", r.Filepath, h.service.Unlink(h.ctx, h.token, parent.Ino, name))
+
+	case "Link":
+		// hardlink@openssh.com: Filepath is the existing file, Target the new name
+		target, err := h.service.ResolvePath(h.ctx, h.token, r.Filepath)
+		if err != nil {
+			return service.PathError("link", r.Filepath, err)
+		}
+		parent, name, err := h.resolveParent(r.Target)
+		if err != nil {
+			return service.PathError("link", r.Target, err)
+		}
+		return service.PathError("link", r.Target, h.service.Link(h.ctx, h.token, target.Ino, parent.Ino, name))
+
+	default:
+		// Symlinks and statvfs are not supported
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// setstat changes size only. Timestamps are accepted and ignored so that
+// "put -p" works, permissions and ownership cannot be changed
+func (h *handlers) setstat(r *sftp.Request) error {
+	attrFlags := r.AttrFlags()
+	if attrFlags.Permissions || attrFlags.UidGid {
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if !attrFlags.Size {
+		return nil
+	}
+
+	meta, err := h.service.ResolvePath(h.ctx, h.token, r.Filepath)
+	if err != nil {
+		return service.PathError("truncate", r.Filepath, err)
+	}
+
+	err = h.service.Truncate(h.ctx, h.token, meta.Ino, int64(r.Attributes().Size))
+	return service.PathError("truncate", r.Filepath, err)
+}
+
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	meta, err := h.service.ResolvePath(h.ctx, h.token, r.Filepath)
+	if err != nil {
+		return nil, service.PathError("stat", r.Filepath, err)
+	}
+
+	switch r.Method {
+	case "List":
+		if meta.Type != models.NodeTypeDir {
+			return nil, service.PathError("readdir", r.Filepath, &service.ServiceError{Code: kerrors.ENOTDIR, Message: "not a directory"})
+		}
+		infos, err := h.list(meta.Ino)
+		if err != nil {
+			return nil, service.PathError("readdir", r.Filepath, err)
+		}
+		return listerAt(infos), nil
+
+	case "Stat", "Lstat":
+		return listerAt{service.NewFileInfo(path.Base(r.Filepath), meta)}, nil
+
+	default:
+		// Readlink: there are no symlinks
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+func (h *handlers) list(dirIno int64) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+
+	var offset uint64
+	for {
+		dirent, err := h.service.IterateDir(h.ctx, h.token, dirIno, &offset)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			return infos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		meta, err := h.service.Lookup(h.ctx, h.token, dirIno, dirent.Name)
+		if service.ErrorCode(err) == kerrors.ENOENT {
+			// Removed between IterateDir and Lookup
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, service.NewFileInfo(dirent.Name, meta))
+	}
+}
+
+// resolveParent resolves directory containing name and returns it with the last path component
+func (h *handlers) resolveParent(name string) (*models.NodeMeta, string, error) {
+	names := service.SplitPath(name)
+	if len(names) == 0 {
+		return nil, "", &service.ServiceError{Code: kerrors.EPERM, Message: "operation not permitted on root"}
+	}
+
+	parent, err := h.service.ResolvePath(h.ctx, h.token, strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return parent, names[len(names)-1], nil
+}
+
+// file is an open file handle, pkg/sftp calls Close when the client closes it
+type file struct {
+	h    *handlers
+	name string
+	ino  int64
+	fh   int64
+}
+
+func (f *file) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := f.h.service.Read(f.h.ctx, f.h.token, f.ino, p, offset)
+	if err != nil {
+		return 0, service.PathError("read", f.name, err)
+	}
+	if int(n) < len(p) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+func (f *file) WriteAt(p []byte, offset int64) (int, error) {
+	n, err := f.h.service.Write(f.h.ctx, f.h.token, f.ino, p, uint64(len(p)), offset)
+	if err != nil {
+		return 0, service.PathError("write", f.name, err)
+	}
+	return int(n), nil
+}
+
+func (f *file) Close() error {
+	return service.PathError("close", f.name, f.h.service.Release(f.h.ctx, f.h.token, f.fh))
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(dst, l[offset:])
+	if n+int(offset) == len(l) {
+		return n, io.EOF
+	}
+	return n, nil
+}
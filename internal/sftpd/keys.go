@@ -0,0 +1,79 @@
+package sftpd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LoadHostKey reads private host key from path. A missing file is created
+// with a new ed25519 key, empty path gives a key that lives until restart
+func LoadHostKey(path string) (ssh.Signer, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return ssh.ParsePrivateKey(data)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		block, err := ssh.MarshalPrivateKey(key, "vtfs host key")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return nil, fmt.Errorf("save host key: %w", err)
+		}
+	}
+
+	return ssh.NewSignerFromKey(key)
+}
+
+// LoadAuthorizedKeys parses authorized_keys file into map from marshaled
+// public key to token. The token comes from environment="VTFS_TOKEN=..."
+// option, keys without it use the SSH user name (empty token)
+func LoadAuthorizedKeys(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string)
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		key, _, options, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s:%d: %w", path, i+1, err)
+		}
+
+		var token string
+		for _, option := range options {
+			value, ok := strings.CutPrefix(option, `environment="VTFS_TOKEN=`)
+			if ok {
+				token = strings.TrimSuffix(value, `"`)
+			}
+		}
+		keys[string(key.Marshal())] = token
+	}
+
+	return keys, nil
+}
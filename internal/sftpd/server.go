@@ -0,0 +1,139 @@
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/netserver"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging/slogext"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Key of ssh.Permissions.Extensions carrying the token of authenticated connection
+const tokenExtension = "vtfs-token"
+
+// Server is an SSH server that only offers the "sftp" subsystem. Each
+// connection works on the tree of one token:
+//
+//	sftp -P 2022 demo@localhost
+//
+// Without authorized keys any client is accepted and the SSH user name is
+// the token. With authorized keys only listed keys are accepted, and the
+// token is taken from the key's environment="VTFS_TOKEN=..." option,
+// falling back to the user name
+type Server struct {
+	service service.FileSystemService
+	config  *ssh.ServerConfig
+
+	// Serve and Shutdown
+	*netserver.Server
+}
+
+// NewServer creates server. authorizedKeys maps marshaled public keys to
+// tokens (empty token means the user name), nil disables authentication
+func NewServer(service service.FileSystemService, hostKey ssh.Signer, authorizedKeys map[string]string) *Server {
+	config := &ssh.ServerConfig{}
+	if authorizedKeys == nil {
+		config.NoClientAuth = true
+		config.NoClientAuthCallback = func(conn ssh.ConnMetadata) (*ssh.Permissions, error) {
+			return tokenPermissions(conn.User()), nil
+		}
+	} else {
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			token, ok := authorizedKeys[string(key.Marshal())]
+			if !ok {
+				return nil, fmt.Errorf("unknown public key for %q", conn.User())
+			}
+			if token == "" {
+				token = conn.User()
+			}
+			return tokenPermissions(token), nil
+		}
+	}
+	config.AddHostKey(hostKey)
+
+	s := &Server{
+		service: service,
+		config:  config,
+	}
+	s.Server = netserver.New(s.serveConn)
+	return s
+}
+
+func tokenPermissions(token string) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{tokenExtension: token}}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	const op = "sftpd.Server.serveConn"
+
+	ctx = logging.MakeContextWithRemoteAddr(ctx, conn.RemoteAddr().String())
+	logger := logging.GetLoggerFromContextWithOp(ctx, op).With(slog.String("remote_addr", conn.RemoteAddr().String()))
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		logger.Debug("Handshake failed", slogext.Err(err))
+		return
+	}
+	defer sshConn.Close()
+
+	token := sshConn.Permissions.Extensions[tokenExtension]
+	logger = logger.With(slog.String("user", sshConn.User()), slog.String("token", token))
+	logger.Debug("Connection opened")
+	defer logger.Debug("Connection closed")
+
+	connCtx := logging.MakeContextWithNewRequestID(ctx)
+
+	go ssh.DiscardRequests(reqs)
+
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			logger.Warn("Failed to accept channel", slogext.Err(err))
+			continue
+		}
+
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			defer channel.Close()
+			s.serveSession(connCtx, logger, channel, requests, token)
+		}()
+	}
+}
+
+// serveSession waits for the sftp subsystem request, shells and commands are refused
+func (s *Server) serveSession(ctx context.Context, logger *slog.Logger, channel ssh.Channel, requests <-chan *ssh.Request, token string) {
+	for req := range requests {
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		_ = req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+
+		go ssh.DiscardRequests(requests)
+
+		server := sftp.NewRequestServer(channel, newHandlers(ctx, s.service, token))
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			logger.Warn("SFTP session failed", slogext.Err(err))
+		}
+		_ = server.Close()
+		return
+	}
+}
@@ -0,0 +1,181 @@
+package sftpd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/service/servicetest"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startServer serves a fresh in-memory filesystem to the holder of clientKey
+// and returns the listen address and the host key
+func startServer(t *testing.T, clientKey ssh.Signer) (string, ssh.PublicKey) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	line := `environment="VTFS_TOKEN=token" ` + string(ssh.MarshalAuthorizedKey(clientKey.PublicKey()))
+	if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authorizedKeys, err := LoadAuthorizedKeys(path)
+	if err != nil {
+		t.Fatalf("LoadAuthorizedKeys: %v", err)
+	}
+
+	hostKey, err := LoadHostKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(servicetest.NewMemory(), hostKey, authorizedKeys)
+	go func() { _ = s.Serve(context.Background(), ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+
+	return ln.Addr().String(), hostKey.PublicKey()
+}
+
+func dial(addr string, hostKey ssh.PublicKey, key ssh.Signer) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         5 * time.Second,
+	})
+}
+
+func TestRejectsUnknownKey(t *testing.T) {
+	addr, hostKey := startServer(t, newKey(t))
+
+	conn, err := dial(addr, hostKey, newKey(t))
+	if err == nil {
+		conn.Close()
+		t.Fatal("unknown key was accepted")
+	}
+}
+
+func TestSFTPSession(t *testing.T) {
+	clientKey := newKey(t)
+	addr, hostKey := startServer(t, clientKey)
+
+	conn, err := dial(addr, hostKey, clientKey)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		t.Fatalf("sftp.NewClient: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Mkdir("/dir"); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	f, err := client.Create("/dir/a.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := f.Write([]byte("hello, sftp")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("SFTP"), 7); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	info, err := client.Stat("/dir/a.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.IsDir() || info.Size() != int64(len("hello, SFTP")) {
+		t.Fatalf("Stat = dir %v size %d", info.IsDir(), info.Size())
+	}
+
+	f, err = client.Open("/dir/a.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(data) != "hello, SFTP" {
+		t.Fatalf("content = %q", data)
+	}
+
+	if err := client.Rename("/dir/a.txt", "/dir/b.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := client.Stat("/dir/a.txt"); err == nil {
+		t.Fatal("old name still exists after Rename")
+	}
+
+	f, err = client.Create("/dir/c.txt")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	f.Close()
+
+	entries, err := client.ReadDir("/dir")
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "b.txt" || names[1] != "c.txt" {
+		t.Fatalf("ReadDir = %v", names)
+	}
+
+	if err := client.Remove("/dir"); err == nil {
+		t.Fatal("Remove of non-empty directory succeeded")
+	}
+	for _, name := range []string{"/dir/b.txt", "/dir/c.txt", "/dir"} {
+		if err := client.Remove(name); err != nil {
+			t.Fatalf("Remove %s: %v", name, err)
+		}
+	}
+	if _, err := client.Stat("/dir"); err == nil {
+		t.Fatal("directory still exists after Remove")
+	}
+}
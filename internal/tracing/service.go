@@ -0,0 +1,224 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tokenKey     = attribute.Key("vtfs.token")
+	inoKey       = attribute.Key("vtfs.ino")
+	parentInoKey = attribute.Key("vtfs.parent_ino")
+	nameKey      = attribute.Key("vtfs.name")
+	pathKey      = attribute.Key("vtfs.path")
+	newParentKey = attribute.Key("vtfs.new_parent_ino")
+	newNameKey   = attribute.Key("vtfs.new_name")
+	offsetKey    = attribute.Key("vtfs.offset")
+	lengthKey    = attribute.Key("vtfs.length")
+	fhKey        = attribute.Key("vtfs.fh")
+	trashIDKey   = attribute.Key("vtfs.trash_id")
+	enabledKey   = attribute.Key("vtfs.enabled")
+	keepKey      = attribute.Key("vtfs.keep_versions")
+	versionKey   = attribute.Key("vtfs.version")
+	errorCodeKey = attribute.Key("vtfs.error_code")
+)
+
+// tracedService wraps every FileSystemService call into a span
+type tracedService struct {
+	next   service.FileSystemService
+	tracer trace.Tracer
+}
+
+func NewTracedService(next service.FileSystemService) service.FileSystemService {
+	return &tracedService{next: next, tracer: Tracer()}
+}
+
+func (s *tracedService) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, RequestIDKey.String(logging.GetRequestIDFromCtx(ctx)))
+	return s.tracer.Start(ctx, "FileSystemService."+method, trace.WithAttributes(attrs...))
+}
+
+func finish(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(errorCodeKey.Int64(service.ErrorCode(err)))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *tracedService) Init(ctx context.Context, token string) (err error) {
+	ctx, span := s.start(ctx, "Init", tokenKey.String(token))
+	defer func() { finish(span, err) }()
+	return s.next.Init(ctx, token)
+}
+
+func (s *tracedService) GetRoot(ctx context.Context, token string) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "GetRoot", tokenKey.String(token))
+	defer func() { finish(span, err) }()
+	return s.next.GetRoot(ctx, token)
+}
+
+func (s *tracedService) Lookup(ctx context.Context, token string, parentIno int64, name string) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "Lookup", tokenKey.String(token), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.Lookup(ctx, token, parentIno, name)
+}
+
+func (s *tracedService) ResolvePath(ctx context.Context, token string, path string) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "ResolvePath", tokenKey.String(token), pathKey.String(path))
+	defer func() { finish(span, err) }()
+	return s.next.ResolvePath(ctx, token, path)
+}
+
+func (s *tracedService) IterateDir(ctx context.Context, token string, dirIno int64, offset *uint64) (dirent *models.Dirent, err error) {
+	attrs := []attribute.KeyValue{tokenKey.String(token), inoKey.Int64(dirIno)}
+	if offset != nil {
+		attrs = append(attrs, offsetKey.Int64(int64(*offset)))
+	}
+	ctx, span := s.start(ctx, "IterateDir", attrs...)
+	defer func() { finish(span, err) }()
+	return s.next.IterateDir(ctx, token, dirIno, offset)
+}
+
+func (s *tracedService) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "CreateFile", tokenKey.String(token), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.CreateFile(ctx, token, parentIno, name, mode)
+}
+
+func (s *tracedService) Unlink(ctx context.Context, token string, parentIno int64, name string) (err error) {
+	ctx, span := s.start(ctx, "Unlink", tokenKey.String(token), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.Unlink(ctx, token, parentIno, name)
+}
+
+func (s *tracedService) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "CreateDir", tokenKey.String(token), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.CreateDir(ctx, token, parentIno, name, mode)
+}
+
+func (s *tracedService) Rmdir(ctx context.Context, token string, parentIno int64, name string) (err error) {
+	ctx, span := s.start(ctx, "Rmdir", tokenKey.String(token), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.Rmdir(ctx, token, parentIno, name)
+}
+
+func (s *tracedService) Read(ctx context.Context, token string, ino int64, buffer []byte, offset int64) (read int64, err error) {
+	ctx, span := s.start(ctx, "Read", tokenKey.String(token), inoKey.Int64(ino), offsetKey.Int64(offset), lengthKey.Int(len(buffer)))
+	defer func() { finish(span, err) }()
+	return s.next.Read(ctx, token, ino, buffer, offset)
+}
+
+func (s *tracedService) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (written int64, err error) {
+	ctx, span := s.start(ctx, "Write", tokenKey.String(token), inoKey.Int64(ino), offsetKey.Int64(offset), lengthKey.Int64(int64(length)))
+	defer func() { finish(span, err) }()
+	return s.next.Write(ctx, token, ino, data, length, offset)
+}
+
+func (s *tracedService) Truncate(ctx context.Context, token string, ino int64, size int64) (err error) {
+	ctx, span := s.start(ctx, "Truncate", tokenKey.String(token), inoKey.Int64(ino), lengthKey.Int64(size))
+	defer func() { finish(span, err) }()
+	return s.next.Truncate(ctx, token, ino, size)
+}
+
+func (s *tracedService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) (err error) {
+	ctx, span := s.start(ctx, "ReplaceContent", tokenKey.String(token), inoKey.Int64(ino), lengthKey.Int(len(data)))
+	defer func() { finish(span, err) }()
+	return s.next.ReplaceContent(ctx, token, ino, data)
+}
+
+func (s *tracedService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) (err error) {
+	ctx, span := s.start(ctx, "Link", tokenKey.String(token), inoKey.Int64(targetIno), parentInoKey.Int64(parentIno), nameKey.String(name))
+	defer func() { finish(span, err) }()
+	return s.next.Link(ctx, token, targetIno, parentIno, name)
+}
+
+func (s *tracedService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) (err error) {
+	ctx, span := s.start(ctx, "Rename",
+		tokenKey.String(token),
+		parentInoKey.Int64(oldParentIno),
+		nameKey.String(oldName),
+		newParentKey.Int64(newParentIno),
+		newNameKey.String(newName),
+	)
+	defer func() { finish(span, err) }()
+	return s.next.Rename(ctx, token, oldParentIno, oldName, newParentIno, newName)
+}
+
+func (s *tracedService) CountLinks(ctx context.Context, token string, ino int64) (count uint32, err error) {
+	ctx, span := s.start(ctx, "CountLinks", tokenKey.String(token), inoKey.Int64(ino))
+	defer func() { finish(span, err) }()
+	return s.next.CountLinks(ctx, token, ino)
+}
+
+func (s *tracedService) Open(ctx context.Context, token string, ino int64) (fh int64, err error) {
+	ctx, span := s.start(ctx, "Open", tokenKey.String(token), inoKey.Int64(ino))
+	defer func() { finish(span, err) }()
+	return s.next.Open(ctx, token, ino)
+}
+
+func (s *tracedService) Renew(ctx context.Context, token string, fh int64) (err error) {
+	ctx, span := s.start(ctx, "Renew", tokenKey.String(token), fhKey.Int64(fh))
+	defer func() { finish(span, err) }()
+	return s.next.Renew(ctx, token, fh)
+}
+
+func (s *tracedService) Release(ctx context.Context, token string, fh int64) (err error) {
+	ctx, span := s.start(ctx, "Release", tokenKey.String(token), fhKey.Int64(fh))
+	defer func() { finish(span, err) }()
+	return s.next.Release(ctx, token, fh)
+}
+
+func (s *tracedService) SetTrash(ctx context.Context, token string, enabled bool) (err error) {
+	ctx, span := s.start(ctx, "SetTrash", tokenKey.String(token), enabledKey.Bool(enabled))
+	defer func() { finish(span, err) }()
+	return s.next.SetTrash(ctx, token, enabled)
+}
+
+func (s *tracedService) ListTrash(ctx context.Context, token string) (entries []models.TrashEntry, err error) {
+	ctx, span := s.start(ctx, "ListTrash", tokenKey.String(token))
+	defer func() { finish(span, err) }()
+	return s.next.ListTrash(ctx, token)
+}
+
+func (s *tracedService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (meta *models.NodeMeta, err error) {
+	ctx, span := s.start(ctx, "RestoreTrash",
+		tokenKey.String(token),
+		trashIDKey.Int64(id),
+		parentInoKey.Int64(parentIno),
+		nameKey.String(name),
+	)
+	defer func() { finish(span, err) }()
+	return s.next.RestoreTrash(ctx, token, id, parentIno, name)
+}
+
+func (s *tracedService) SetVersioning(ctx context.Context, token string, ino int64, keep int) (err error) {
+	ctx, span := s.start(ctx, "SetVersioning", tokenKey.String(token), inoKey.Int64(ino), keepKey.Int(keep))
+	defer func() { finish(span, err) }()
+	return s.next.SetVersioning(ctx, token, ino, keep)
+}
+
+func (s *tracedService) ListVersions(ctx context.Context, token string, ino int64) (versions []models.FileVersion, err error) {
+	ctx, span := s.start(ctx, "ListVersions", tokenKey.String(token), inoKey.Int64(ino))
+	defer func() { finish(span, err) }()
+	return s.next.ListVersions(ctx, token, ino)
+}
+
+func (s *tracedService) ReadVersion(ctx context.Context, token string, ino int64, version int64) (data []byte, err error) {
+	ctx, span := s.start(ctx, "ReadVersion", tokenKey.String(token), inoKey.Int64(ino), versionKey.Int64(version))
+	defer func() { finish(span, err) }()
+	return s.next.ReadVersion(ctx, token, ino, version)
+}
+
+func (s *tracedService) RestoreVersion(ctx context.Context, token string, ino int64, version int64) (err error) {
+	ctx, span := s.start(ctx, "RestoreVersion", tokenKey.String(token), inoKey.Int64(ino), versionKey.Int64(version))
+	defer func() { finish(span, err) }()
+	return s.next.RestoreVersion(ctx, token, ino, version)
+}
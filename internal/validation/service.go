@@ -0,0 +1,110 @@
+package validation
+
+import (
+	"context"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+// validatedService rejects invalid names, paths and write ranges and masks
+// modes before calling next. Methods without such arguments are passed
+// through
+type validatedService struct {
+	service.FileSystemService
+	maxFileSize int64
+}
+
+func NewValidatedService(next service.FileSystemService, maxFileSize int64) service.FileSystemService {
+	return &validatedService{FileSystemService: next, maxFileSize: maxFileSize}
+}
+
+func (s *validatedService) Lookup(ctx context.Context, token string, parentIno int64, name string) (*models.NodeMeta, error) {
+	if err := Name(name); err != nil {
+		return nil, err
+	}
+	return s.FileSystemService.Lookup(ctx, token, parentIno, name)
+}
+
+func (s *validatedService) ResolvePath(ctx context.Context, token string, path string) (*models.NodeMeta, error) {
+	if err := Path(path); err != nil {
+		return nil, err
+	}
+	return s.FileSystemService.ResolvePath(ctx, token, path)
+}
+
+func (s *validatedService) CreateFile(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	if err := Name(name); err != nil {
+		return nil, err
+	}
+	return s.FileSystemService.CreateFile(ctx, token, parentIno, name, Mode(mode))
+}
+
+func (s *validatedService) Unlink(ctx context.Context, token string, parentIno int64, name string) error {
+	if err := Name(name); err != nil {
+		return err
+	}
+	return s.FileSystemService.Unlink(ctx, token, parentIno, name)
+}
+
+func (s *validatedService) CreateDir(ctx context.Context, token string, parentIno int64, name string, mode uint32) (*models.NodeMeta, error) {
+	if err := Name(name); err != nil {
+		return nil, err
+	}
+	return s.FileSystemService.CreateDir(ctx, token, parentIno, name, Mode(mode))
+}
+
+func (s *validatedService) Rmdir(ctx context.Context, token string, parentIno int64, name string) error {
+	if err := Name(name); err != nil {
+		return err
+	}
+	return s.FileSystemService.Rmdir(ctx, token, parentIno, name)
+}
+
+func (s *validatedService) Write(ctx context.Context, token string, ino int64, data []byte, length uint64, offset int64) (int64, error) {
+	if err := WriteRange(length, len(data), offset, s.maxFileSize); err != nil {
+		return 0, err
+	}
+	return s.FileSystemService.Write(ctx, token, ino, data, length, offset)
+}
+
+func (s *validatedService) Truncate(ctx context.Context, token string, ino int64, size int64) error {
+	if err := Size(size, s.maxFileSize); err != nil {
+		return err
+	}
+	return s.FileSystemService.Truncate(ctx, token, ino, size)
+}
+
+func (s *validatedService) ReplaceContent(ctx context.Context, token string, ino int64, data []byte) error {
+	if err := Size(int64(len(data)), s.maxFileSize); err != nil {
+		return err
+	}
+	return s.FileSystemService.ReplaceContent(ctx, token, ino, data)
+}
+
+func (s *validatedService) Link(ctx context.Context, token string, targetIno int64, parentIno int64, name string) error {
+	if err := Name(name); err != nil {
+		return err
+	}
+	return s.FileSystemService.Link(ctx, token, targetIno, parentIno, name)
+}
+
+func (s *validatedService) Rename(ctx context.Context, token string, oldParentIno int64, oldName string, newParentIno int64, newName string) error {
+	if err := Name(oldName); err != nil {
+		return err
+	}
+	if err := Name(newName); err != nil {
+		return err
+	}
+	return s.FileSystemService.Rename(ctx, token, oldParentIno, oldName, newParentIno, newName)
+}
+
+func (s *validatedService) RestoreTrash(ctx context.Context, token string, id int64, parentIno int64, name string) (*models.NodeMeta, error) {
+	// Empty name keeps the original one
+	if name != "" {
+		if err := Name(name); err != nil {
+			return nil, err
+		}
+	}
+	return s.FileSystemService.RestoreTrash(ctx, token, id, parentIno, name)
+}
@@ -0,0 +1,80 @@
+// Package validation checks arguments that come from clients before they
+// reach FileSystemService, the same way for every frontend
+package validation
+
+import (
+	"strings"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/pkg/kerrors"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+)
+
+const (
+	// NAME_MAX of Linux, also the most v1 Dirent's char[256] can hold with
+	// the terminating NUL
+	NameMax = 255
+	// PATH_MAX of Linux, terminating NUL included
+	PathMax = 4096
+)
+
+// Name checks single directory entry name
+func Name(name string) error {
+	switch {
+	case len(name) > NameMax:
+		return &service.ServiceError{Code: kerrors.ENAMETOOLONG, Message: "name too long"}
+	case name == "" || name == "." || name == "..":
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid name"}
+	case strings.ContainsAny(name, "/\x00"):
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "name contains '/' or NUL"}
+	}
+	return nil
+}
+
+// Path checks slash-separated path. "." and ".." are allowed, ResolvePath
+// handles them lexically
+func Path(p string) error {
+	if len(p) >= PathMax {
+		return &service.ServiceError{Code: kerrors.ENAMETOOLONG, Message: "path too long"}
+	}
+	if strings.IndexByte(p, 0) >= 0 {
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "path contains NUL"}
+	}
+	for _, component := range strings.Split(p, "/") {
+		if len(component) > NameMax {
+			return &service.ServiceError{Code: kerrors.ENAMETOOLONG, Message: "path component too long"}
+		}
+	}
+	return nil
+}
+
+// WriteRange checks that length bytes of a buffer of bufferLen fit at offset
+// of a file at most maxFileSize long
+func WriteRange(length uint64, bufferLen int, offset int64, maxFileSize int64) error {
+	switch {
+	case length > uint64(bufferLen):
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "length exceeds buffer size"}
+	case offset < 0:
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid offset"}
+	// Written as offset > max - length, offset + length may overflow
+	case length > uint64(maxFileSize) || offset > maxFileSize-int64(length):
+		return &service.ServiceError{Code: kerrors.EFBIG, Message: "file too large"}
+	}
+	return nil
+}
+
+// Size checks new file size for truncate
+func Size(size int64, maxFileSize int64) error {
+	switch {
+	case size < 0:
+		return &service.ServiceError{Code: kerrors.EINVAL, Message: "invalid size"}
+	case size > maxFileSize:
+		return &service.ServiceError{Code: kerrors.EFBIG, Message: "file too large"}
+	}
+	return nil
+}
+
+// Mode keeps permission bits only: node type is given by the operation,
+// not by the client
+func Mode(mode uint32) uint32 {
+	return mode & service.S_IRWXUGO
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS open_handles (
+    fh BIGSERIAL PRIMARY KEY,
+    token VARCHAR(255) NOT NULL,
+    ino BIGINT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (token, ino) REFERENCES inodes(token, ino) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_open_handles_token_ino ON open_handles(token, ino);
+CREATE INDEX IF NOT EXISTS idx_open_handles_expires_at ON open_handles(expires_at);
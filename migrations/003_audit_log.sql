@@ -0,0 +1,18 @@
+-- Not tied to filesystems: records must outlive the filesystem they describe
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    request_id VARCHAR(255) NOT NULL DEFAULT '',
+    remote_addr VARCHAR(255) NOT NULL DEFAULT '',
+    token VARCHAR(255) NOT NULL,
+    op VARCHAR(32) NOT NULL,
+    ino BIGINT NOT NULL DEFAULT 0,
+    parent_ino BIGINT NOT NULL DEFAULT 0,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    new_parent_ino BIGINT NOT NULL DEFAULT 0,
+    new_name VARCHAR(255) NOT NULL DEFAULT '',
+    code BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_token_id ON audit_log(token, id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at);
@@ -0,0 +1,17 @@
+ALTER TABLE filesystems ADD COLUMN IF NOT EXISTS trash_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A trashed inode keeps ref_count 1: the trash entry holds the reference
+-- its last directory entry had, so orphan cleanup leaves it alone
+CREATE TABLE IF NOT EXISTS trash (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(255) NOT NULL,
+    ino BIGINT NOT NULL,
+    -- Original location, the parent may be gone by now
+    parent_ino BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (token, ino),
+    FOREIGN KEY (token, ino) REFERENCES inodes(token, ino) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON trash(deleted_at);
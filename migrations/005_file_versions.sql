@@ -0,0 +1,15 @@
+-- Versions kept per file, 0 disables versioning
+ALTER TABLE inodes ADD COLUMN IF NOT EXISTS keep_versions INTEGER NOT NULL DEFAULT 0;
+
+-- Every committed content of a versioned file, the newest one included.
+-- Global ids keep concurrent writers from clashing on version numbers
+CREATE TABLE IF NOT EXISTS file_versions (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(255) NOT NULL,
+    ino BIGINT NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (token, ino) REFERENCES inodes(token, ino) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_versions_token_ino ON file_versions(token, ino, id);
@@ -0,0 +1,70 @@
+-- Content-addressed file data: files are split into 64 KiB chunks keyed by
+-- their SHA-256, and a chunk is stored once however many files, in however
+-- many filesystems, contain it
+CREATE TABLE IF NOT EXISTS chunks (
+    hash BYTEA PRIMARY KEY,
+    data BYTEA NOT NULL,
+    size INTEGER NOT NULL,
+    -- Number of file_chunks rows pointing here, kept by the trigger below.
+    -- Chunks at 0 are deleted by the chunk collector
+    ref_count BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_chunks_unreferenced ON chunks(hash) WHERE ref_count = 0;
+
+-- Chunk idx of a file covers bytes [idx * 64 KiB, (idx + 1) * 64 KiB).
+-- Empty files have no chunks
+CREATE TABLE IF NOT EXISTS file_chunks (
+    token VARCHAR(255) NOT NULL,
+    ino BIGINT NOT NULL,
+    idx INTEGER NOT NULL,
+    hash BYTEA NOT NULL REFERENCES chunks(hash),
+    PRIMARY KEY (token, ino, idx),
+    FOREIGN KEY (token, ino) REFERENCES inodes(token, ino) ON DELETE CASCADE
+);
+
+-- Inodes are deleted in several places and file_chunks rows mostly go
+-- away by cascade, so reference counts are kept by a trigger rather than
+-- by every statement that may drop a file
+CREATE OR REPLACE FUNCTION file_chunks_ref_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE chunks SET ref_count = ref_count - 1 WHERE hash = OLD.hash;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE chunks SET ref_count = ref_count + 1 WHERE hash = NEW.hash;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS file_chunks_ref_count ON file_chunks;
+CREATE TRIGGER file_chunks_ref_count
+AFTER INSERT OR UPDATE OF hash OR DELETE ON file_chunks
+FOR EACH ROW EXECUTE FUNCTION file_chunks_ref_count();
+
+-- Move existing contents into chunks
+DO $$
+BEGIN
+    IF to_regclass('file_contents') IS NOT NULL THEN
+        CREATE TEMPORARY TABLE split_contents ON COMMIT DROP AS
+        SELECT fc.token, fc.ino, g.idx, sha256(p.data) AS hash, p.data
+        FROM file_contents fc,
+             generate_series(0, (LENGTH(fc.data) - 1) / 65536) AS g(idx),
+             LATERAL (SELECT SUBSTRING(fc.data FROM g.idx * 65536 + 1 FOR 65536) AS data) p
+        WHERE LENGTH(fc.data) > 0;
+
+        INSERT INTO chunks (hash, data, size)
+        SELECT DISTINCT ON (hash) hash, data, LENGTH(data)
+        FROM split_contents
+        ON CONFLICT (hash) DO NOTHING;
+
+        INSERT INTO file_chunks (token, ino, idx, hash)
+        SELECT token, ino, idx, hash
+        FROM split_contents
+        ON CONFLICT (token, ino, idx) DO NOTHING;
+
+        DROP TABLE file_contents;
+    END IF;
+END;
+$$;
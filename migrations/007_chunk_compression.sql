@@ -0,0 +1,3 @@
+-- How chunks.data is stored: 0 plain, 1 gzip. chunks.size stays the plain
+-- size, LENGTH(data) is what the chunk takes
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS encoding SMALLINT NOT NULL DEFAULT 0;
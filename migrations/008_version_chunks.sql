@@ -0,0 +1,48 @@
+-- Versions become chunk lists like file contents: a version shares every
+-- chunk it didn't change with the file and with other versions, and its
+-- chunks count in chunks.ref_count
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS version_chunks (
+    version_id BIGINT NOT NULL REFERENCES file_versions(id) ON DELETE CASCADE,
+    idx INTEGER NOT NULL,
+    hash BYTEA NOT NULL REFERENCES chunks(hash),
+    PRIMARY KEY (version_id, idx)
+);
+
+-- The counting function only looks at hash, so it serves both tables
+DROP TRIGGER IF EXISTS version_chunks_ref_count ON version_chunks;
+CREATE TRIGGER version_chunks_ref_count
+AFTER INSERT OR UPDATE OF hash OR DELETE ON version_chunks
+FOR EACH ROW EXECUTE FUNCTION file_chunks_ref_count();
+
+-- Move existing versions into chunks
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'file_versions' AND column_name = 'data'
+    ) THEN
+        CREATE TEMPORARY TABLE split_versions ON COMMIT DROP AS
+        SELECT v.id, g.idx, sha256(p.data) AS hash, p.data
+        FROM file_versions v,
+             generate_series(0, (LENGTH(v.data) - 1) / 65536) AS g(idx),
+             LATERAL (SELECT SUBSTRING(v.data FROM g.idx * 65536 + 1 FOR 65536) AS data) p
+        WHERE LENGTH(v.data) > 0;
+
+        INSERT INTO chunks (hash, data, size)
+        SELECT DISTINCT ON (hash) hash, data, LENGTH(data)
+        FROM split_versions
+        ON CONFLICT (hash) DO NOTHING;
+
+        INSERT INTO version_chunks (version_id, idx, hash)
+        SELECT id, idx, hash
+        FROM split_versions
+        ON CONFLICT (version_id, idx) DO NOTHING;
+
+        UPDATE file_versions SET size = LENGTH(data);
+        ALTER TABLE file_versions DROP COLUMN data;
+    END IF;
+END;
+$$;
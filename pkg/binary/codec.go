@@ -0,0 +1,167 @@
+package binary
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrShortBuffer = errors.New("binary: short buffer")
+
+// Decoder reads little-endian fields from a byte slice. First error sticks,
+// so callers may read all fields and check Err once
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{buf: buf}
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Remaining returns number of unread bytes
+func (d *Decoder) Remaining() int {
+	return len(d.buf)
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = ErrShortBuffer
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *Decoder) Uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *Decoder) Uint16() uint16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *Decoder) Int16() int16 {
+	return int16(d.Uint16())
+}
+
+func (d *Decoder) Uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *Decoder) Uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+// String reads string prefixed with its uint16 length
+func (d *Decoder) String() string {
+	n := d.Uint16()
+	return string(d.next(int(n)))
+}
+
+// Bytes reads byte slice prefixed with its uint32 length. Result aliases decoder buffer
+func (d *Decoder) Bytes() []byte {
+	n := d.Uint32()
+	return d.next(int(n))
+}
+
+// Fixed reads exactly n bytes. Result aliases decoder buffer
+func (d *Decoder) Fixed(n int) []byte {
+	return d.next(n)
+}
+
+// Encoder is the counterpart of Decoder
+type Encoder struct {
+	buf []byte
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) PutUint8(v uint8) *Encoder {
+	e.buf = append(e.buf, v)
+	return e
+}
+
+func (e *Encoder) PutUint16(v uint16) *Encoder {
+	e.buf = binary.LittleEndian.AppendUint16(e.buf, v)
+	return e
+}
+
+func (e *Encoder) PutUint32(v uint32) *Encoder {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+	return e
+}
+
+func (e *Encoder) PutUint64(v uint64) *Encoder {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+	return e
+}
+
+func (e *Encoder) PutInt64(v int64) *Encoder {
+	return e.PutUint64(uint64(v))
+}
+
+// PutString writes string prefixed with its uint16 length
+func (e *Encoder) PutString(s string) *Encoder {
+	if len(s) > 0xFFFF {
+		s = s[:0xFFFF]
+	}
+	e.PutUint16(uint16(len(s)))
+	e.buf = append(e.buf, s...)
+	return e
+}
+
+// PutBytes writes byte slice prefixed with its uint32 length
+func (e *Encoder) PutBytes(b []byte) *Encoder {
+	e.PutUint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+// PutFixed writes b as is, without length prefix
+func (e *Encoder) PutFixed(b []byte) *Encoder {
+	e.buf = append(e.buf, b...)
+	return e
+}
+
+// DecodeCode reads int64 return code that starts every response
+func DecodeCode(body []byte) (int64, []byte, error) {
+	if len(body) < 8 {
+		return 0, nil, fmt.Errorf("failed to decode response code: %w", ErrShortBuffer)
+	}
+	return int64(binary.LittleEndian.Uint64(body)), body[8:], nil
+}
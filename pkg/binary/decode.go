@@ -0,0 +1,95 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+// Hello is the decoded reply of /api/hello, see EncodeHello
+type Hello struct {
+	Version    uint32
+	MaxVersion uint32
+	Features   uint64
+}
+
+func DecodeHello(data []byte) (*Hello, error) {
+	d := NewDecoder(data)
+	hello := &Hello{
+		Version:    d.Uint32(),
+		MaxVersion: d.Uint32(),
+		Features:   d.Uint64(),
+	}
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode hello: %w", err)
+	}
+	return hello, nil
+}
+
+// DecodeNodeMetaVersion is the counterpart of EncodeNodeMetaVersion. Fields
+// appended to v2 records by newer servers are skipped
+func DecodeNodeMetaVersion(version uint32, data []byte) (*models.NodeMeta, error) {
+	d, err := recordDecoder(version, data)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &models.NodeMeta{
+		Ino:       d.Int64(),
+		ParentIno: d.Int64(),
+		Type:      models.NodeType(d.Int16()),
+		Mode:      d.Uint32(),
+		Size:      d.Int64(),
+	}
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode node meta: %w", err)
+	}
+	return meta, nil
+}
+
+// DecodeDirentVersion is the counterpart of EncodeDirentVersion
+func DecodeDirentVersion(version uint32, data []byte) (*models.Dirent, error) {
+	d, err := recordDecoder(version, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirent models.Dirent
+	switch version {
+	case ProtocolV1:
+		name := d.Fixed(256)
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		dirent.Name = string(name)
+		dirent.Ino = d.Int64()
+		dirent.Type = models.NodeType(d.Int16())
+	default:
+		dirent.Ino = d.Int64()
+		dirent.Type = models.NodeType(d.Int16())
+		dirent.Name = d.String()
+	}
+
+	if err := d.Err(); err != nil {
+		return nil, fmt.Errorf("failed to decode dirent: %w", err)
+	}
+	return &dirent, nil
+}
+
+// recordDecoder returns decoder over record body, stripping v2 size prefix
+func recordDecoder(version uint32, data []byte) (*Decoder, error) {
+	switch version {
+	case ProtocolV1:
+		return NewDecoder(data), nil
+	case ProtocolV2:
+		d := NewDecoder(data)
+		body := d.Fixed(int(d.Uint16()))
+		if err := d.Err(); err != nil {
+			return nil, fmt.Errorf("failed to decode record size: %w", err)
+		}
+		return NewDecoder(body), nil
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	}
+}
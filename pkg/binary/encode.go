@@ -9,6 +9,9 @@ import (
 	"github.com/S1riyS/os-course-lab-4/server/internal/models"
 )
 
+// EncodeNodeMeta encodes NodeMeta in protocol v1 layout (30 bytes):
+//
+//	i64 ino | i64 parent_ino | i16 type | u32 mode | i64 size
 func EncodeNodeMeta(meta *models.NodeMeta) ([]byte, error) {
 	buf := new(bytes.Buffer)
 
@@ -40,6 +43,9 @@ func EncodeNodeMeta(meta *models.NodeMeta) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// EncodeDirent encodes Dirent in protocol v1 layout (266 bytes):
+//
+//	char name[256] (NUL-padded) | i64 ino | i16 type
 func EncodeDirent(dirent *models.Dirent) ([]byte, error) {
 	buf := new(bytes.Buffer)
 
@@ -63,6 +69,32 @@ func EncodeDirent(dirent *models.Dirent) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+func EncodeFileLock(lock *models.FileLock) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	// type (int16, 2 bytes)
+	if err := binary.Write(buf, binary.LittleEndian, int16(lock.Type)); err != nil {
+		return nil, fmt.Errorf("failed to encode type: %w", err)
+	}
+
+	// start (int64, 8 bytes)
+	if err := binary.Write(buf, binary.LittleEndian, lock.Start); err != nil {
+		return nil, fmt.Errorf("failed to encode start: %w", err)
+	}
+
+	// len (int64, 8 bytes)
+	if err := binary.Write(buf, binary.LittleEndian, lock.Len); err != nil {
+		return nil, fmt.Errorf("failed to encode len: %w", err)
+	}
+
+	// owner (uint64, 8 bytes)
+	if err := binary.Write(buf, binary.LittleEndian, lock.Owner); err != nil {
+		return nil, fmt.Errorf("failed to encode owner: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
 func WriteResponse(w http.ResponseWriter, code int64, data []byte) error {
 	response := new(bytes.Buffer)
 
@@ -81,8 +113,8 @@ func WriteResponse(w http.ResponseWriter, code int64, data []byte) error {
 	body := response.Bytes()
 
 	// Set headers
+	// Connection policy (keep-alive or close) is decided by middleware
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
-	w.Header().Set("Connection", "close")
 	w.WriteHeader(http.StatusOK)
 
 	_, err := w.Write(body)
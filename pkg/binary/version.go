@@ -0,0 +1,97 @@
+package binary
+
+import (
+	"fmt"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+// Protocol versions. Client announces the highest version it speaks in
+// /api/hello (or RPC OpHello) and then passes the negotiated one with each
+// HTTP request; requests without a version use v1, so deployed kernel
+// modules keep working.
+const (
+	// Fixed-size records, see EncodeNodeMeta and EncodeDirent
+	ProtocolV1 uint32 = 1
+	// Every record starts with u16 size of the rest of the record, so new
+	// fields can be appended without breaking older readers:
+	//
+	//	NodeMeta: u16 size | i64 ino | i64 parent_ino | i16 type | u32 mode | i64 size
+	//	Dirent:   u16 size | i64 ino | i16 type | u16 name_len | name[name_len]
+	ProtocolV2 uint32 = 2
+
+	ProtocolLatest = ProtocolV2
+)
+
+// Feature bits announced in hello
+const (
+	FeatureHandles   uint64 = 1 << 0 // /api/open, /api/renew, /api/release
+	FeatureLocks     uint64 = 1 << 1 // /api/lock, /api/unlock, /api/getlk
+	FeatureEvents    uint64 = 1 << 2 // /api/events
+	FeatureKeepAlive uint64 = 1 << 3 // connection reuse can be negotiated
+	FeatureRPC       uint64 = 1 << 4 // persistent binary protocol
+	FeatureResolve   uint64 = 1 << 5 // /api/resolve, path lookup in one call
+	FeatureLockRenew uint64 = 1 << 6 // /api/lock/renew, heartbeat of lock owners
+
+	SupportedFeatures = FeatureHandles | FeatureLocks | FeatureEvents | FeatureKeepAlive | FeatureRPC | FeatureResolve | FeatureLockRenew
+)
+
+// NegotiateVersion returns version both sides speak, or false if client version is invalid
+func NegotiateVersion(clientVersion uint32) (uint32, bool) {
+	if clientVersion < ProtocolV1 {
+		return 0, false
+	}
+	return min(clientVersion, ProtocolLatest), true
+}
+
+// EncodeHello encodes hello reply:
+//
+//	u32 version (negotiated) | u32 max_version | u64 features (supported by server)
+func EncodeHello(version uint32) []byte {
+	return NewEncoder().
+		PutUint32(version).
+		PutUint32(ProtocolLatest).
+		PutUint64(SupportedFeatures).
+		Bytes()
+}
+
+func EncodeNodeMetaVersion(version uint32, meta *models.NodeMeta) ([]byte, error) {
+	switch version {
+	case ProtocolV1:
+		return EncodeNodeMeta(meta)
+	case ProtocolV2:
+		body := NewEncoder().
+			PutInt64(meta.Ino).
+			PutInt64(meta.ParentIno).
+			PutUint16(uint16(meta.Type)).
+			PutUint32(meta.Mode).
+			PutInt64(meta.Size).
+			Bytes()
+		return withSize(body)
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	}
+}
+
+func EncodeDirentVersion(version uint32, dirent *models.Dirent) ([]byte, error) {
+	switch version {
+	case ProtocolV1:
+		return EncodeDirent(dirent)
+	case ProtocolV2:
+		body := NewEncoder().
+			PutInt64(dirent.Ino).
+			PutUint16(uint16(dirent.Type)).
+			PutString(dirent.Name).
+			Bytes()
+		return withSize(body)
+	default:
+		return nil, fmt.Errorf("unsupported protocol version %d", version)
+	}
+}
+
+func withSize(body []byte) ([]byte, error) {
+	if len(body) > 0xFFFF {
+		return nil, fmt.Errorf("record too large: %d bytes", len(body))
+	}
+	return append(NewEncoder().PutUint16(uint16(len(body))).Bytes(), body...), nil
+}
@@ -0,0 +1,310 @@
+// Package client talks to a vtfs server over the binary /api/* protocol and
+// exposes one filesystem as io/fs.FS, plus write helpers:
+//
+//	c, err := client.New(ctx, "http://localhost:8082", "demo", nil)
+//	data, err := fs.ReadFile(c, "dir/file.txt")
+//	err = c.Mkdir("logs", 0o755)
+//
+// Errors returned by the server are syscall.Errno values wrapped into
+// *fs.PathError, so errors.Is(err, fs.ErrNotExist) works as with package os
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+	"github.com/S1riyS/os-course-lab-4/server/pkg/binary"
+)
+
+const (
+	// Read requests are split into chunks of this size
+	maxReadChunk = 256 * 1024
+	// Write payload travels base64-encoded in the query string, which must
+	// fit into the server's header limit
+	maxWriteChunk = 48 * 1024
+)
+
+// Client works on the filesystem of one token. It is safe for concurrent use
+type Client struct {
+	baseURL  string
+	token    string
+	http     *http.Client
+	ctx      context.Context
+	version  uint32
+	features uint64
+}
+
+// New negotiates protocol version with server at baseURL. Nil httpClient
+// means http.DefaultClient. Servers without /api/hello are spoken to in v1
+func New(ctx context.Context, baseURL string, token string, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    httpClient,
+		ctx:     context.Background(),
+		version: binary.ProtocolV1,
+	}
+
+	params := url.Values{
+		"version": {strconv.FormatUint(uint64(binary.ProtocolLatest), 10)},
+	}
+	data, err := c.call(ctx, "/api/hello", params)
+	if err != nil {
+		if statusCode(err) == http.StatusNotFound {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	hello, err := binary.DecodeHello(data)
+	if err != nil {
+		return nil, err
+	}
+	c.version = hello.Version
+	c.features = hello.Features
+
+	return c, nil
+}
+
+// WithContext returns shallow copy of c whose requests use ctx. fs.FS
+// methods have no context argument, so this is how they are cancelled
+func (c *Client) WithContext(ctx context.Context) *Client {
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+// Token returns token of the filesystem the client works on
+func (c *Client) Token() string {
+	return c.token
+}
+
+// Version returns negotiated protocol version
+func (c *Client) Version() uint32 {
+	return c.version
+}
+
+// Init creates the filesystem. It fails with EEXIST if it already exists
+func (c *Client) Init() error {
+	_, err := c.call(c.ctx, "/api/init", url.Values{"token": {c.token}})
+	return pathError("init", "", err)
+}
+
+// CountLinks returns number of hard links to file name
+func (c *Client) CountLinks(name string) (uint32, error) {
+	meta, err := c.resolve(name)
+	if err != nil {
+		return 0, pathError("stat", name, err)
+	}
+
+	data, err := c.call(c.ctx, "/api/count_links", url.Values{"token": {c.token}, "ino": {strconv.FormatInt(meta.Ino, 10)}})
+	if err != nil {
+		return 0, pathError("stat", name, err)
+	}
+
+	d := binary.NewDecoder(data)
+	count := d.Uint32()
+	return count, d.Err()
+}
+
+// httpStatusError is returned for non-200 replies, which don't carry a return code
+type httpStatusError struct {
+	path   string
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected HTTP status %d", e.path, e.status)
+}
+
+func statusCode(err error) int {
+	if statusErr, ok := err.(*httpStatusError); ok {
+		return statusErr.status
+	}
+	return 0
+}
+
+// call performs GET request and returns reply payload. Non-zero return code
+// becomes syscall.Errno (the server sends some of them negated)
+func (c *Client) call(ctx context.Context, path string, params url.Values) ([]byte, error) {
+	if c.version != binary.ProtocolV1 {
+		params.Set("proto", strconv.FormatUint(uint64(c.version), 10))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{path: path, status: resp.StatusCode}
+	}
+
+	code, data, err := binary.DecodeCode(body)
+	if err != nil {
+		return nil, err
+	}
+	if code < 0 {
+		code = -code
+	}
+	if code != 0 {
+		return nil, syscall.Errno(code)
+	}
+	return data, nil
+}
+
+func (c *Client) callMeta(path string, params url.Values) (*models.NodeMeta, error) {
+	data, err := c.call(c.ctx, path, params)
+	if err != nil {
+		return nil, err
+	}
+	return binary.DecodeNodeMetaVersion(c.version, data)
+}
+
+func (c *Client) getRoot() (*models.NodeMeta, error) {
+	return c.callMeta("/api/get_root", url.Values{"token": {c.token}})
+}
+
+// resolve looks up slash-separated path relative to the root
+func (c *Client) resolve(name string) (*models.NodeMeta, error) {
+	if c.features&binary.FeatureResolve == 0 {
+		return c.walk(name)
+	}
+	return c.callMeta("/api/resolve", url.Values{"token": {c.token}, "path": {"/" + name}})
+}
+
+// walk resolves path with one lookup per component, for servers without /api/resolve
+func (c *Client) walk(name string) (*models.NodeMeta, error) {
+	meta, err := c.getRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, component := range splitPath(name) {
+		if meta.Type != models.NodeTypeDir {
+			return nil, syscall.ENOTDIR
+		}
+		meta, err = c.lookup(meta.Ino, component)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+func (c *Client) lookup(parentIno int64, name string) (*models.NodeMeta, error) {
+	return c.callMeta("/api/lookup", url.Values{
+		"token":  {c.token},
+		"parent": {strconv.FormatInt(parentIno, 10)},
+		"name":   {name},
+	})
+}
+
+// iterateDir returns entry at offset of directory, io.EOF after the last one
+func (c *Client) iterateDir(dirIno int64, offset uint64) (*models.Dirent, error) {
+	data, err := c.call(c.ctx, "/api/iterate_dir", url.Values{
+		"token":   {c.token},
+		"dir_ino": {strconv.FormatInt(dirIno, 10)},
+		"offset":  {strconv.FormatUint(offset, 10)},
+	})
+	if err == syscall.ENOENT {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return binary.DecodeDirentVersion(c.version, data)
+}
+
+func (c *Client) read(ino int64, p []byte, offset int64) (int, error) {
+	data, err := c.call(c.ctx, "/api/read", url.Values{
+		"token":  {c.token},
+		"ino":    {strconv.FormatInt(ino, 10)},
+		"len":    {strconv.Itoa(min(len(p), maxReadChunk))},
+		"offset": {strconv.FormatInt(offset, 10)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, data), nil
+}
+
+func (c *Client) write(ino int64, p []byte, offset int64) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:min(len(p), written+maxWriteChunk)]
+		data, err := c.call(c.ctx, "/api/write", url.Values{
+			"token":  {c.token},
+			"ino":    {strconv.FormatInt(ino, 10)},
+			"len":    {strconv.Itoa(len(chunk))},
+			"offset": {strconv.FormatInt(offset+int64(written), 10)},
+			"data":   {base64.StdEncoding.EncodeToString(chunk)},
+		})
+		if err != nil {
+			return written, err
+		}
+
+		d := binary.NewDecoder(data)
+		n := d.Int64()
+		if err := d.Err(); err != nil {
+			return written, err
+		}
+		written += int(n)
+		if int(n) < len(chunk) {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// open takes a handle that keeps inode alive until release, zero if server has no handles
+func (c *Client) open(ino int64) (int64, error) {
+	if c.features&binary.FeatureHandles == 0 {
+		return 0, nil
+	}
+
+	data, err := c.call(c.ctx, "/api/open", url.Values{"token": {c.token}, "ino": {strconv.FormatInt(ino, 10)}})
+	if err != nil {
+		return 0, err
+	}
+	d := binary.NewDecoder(data)
+	fh := d.Int64()
+	return fh, d.Err()
+}
+
+func (c *Client) release(fh int64) error {
+	if fh == 0 {
+		return nil
+	}
+	_, err := c.call(c.ctx, "/api/release", url.Values{"token": {c.token}, "fh": {strconv.FormatInt(fh, 10)}})
+	return err
+}
+
+func splitPath(name string) []string {
+	if name == "." || name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
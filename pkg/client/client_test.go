@@ -0,0 +1,229 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/events"
+	"github.com/S1riyS/os-course-lab-4/server/internal/handler"
+	"github.com/S1riyS/os-course-lab-4/server/internal/lock"
+	"github.com/S1riyS/os-course-lab-4/server/internal/repository"
+	"github.com/S1riyS/os-course-lab-4/server/internal/service"
+	"github.com/S1riyS/os-course-lab-4/server/internal/validation"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tests below run the client against the full server stack and need
+// PostgreSQL, as the repository tests do
+const testDatabaseEnv = "VTFS_TEST_DATABASE_URL"
+
+const (
+	testMaxFileSize = 64 << 20
+	testMaxReadSize = 1 << 20
+)
+
+// newTestDB migrates a schema of its own and drops it afterwards
+func newTestDB(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("vtfs_client_test_%d", time.Now().UnixNano())
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		pool.Close()
+	})
+
+	if _, err = pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		tb.Fatal(err)
+	}
+
+	migrations, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		sql, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err = pool.Exec(ctx, string(sql)); err != nil {
+			tb.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return pool
+}
+
+// newTestClient serves /api/* over the test database and returns a client
+// of a freshly initialized filesystem
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	db := newTestDB(t)
+	compression, err := repository.NewCompression("none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker(16)
+	fsService := service.NewFileSystemService(
+		db,
+		repository.NewFilesystemRepository(db),
+		repository.NewInodeRepository(db),
+		repository.NewDirectoryRepository(db),
+		repository.NewContentRepository(db, compression),
+		repository.NewHandleRepository(db),
+		repository.NewTrashRepository(db),
+		time.Minute,
+		testMaxFileSize,
+		broker,
+	)
+	fsService = validation.NewValidatedService(fsService, testMaxFileSize)
+
+	mux := http.NewServeMux()
+	handler.NewHandler(fsService, lock.NewManager(time.Minute, time.Second), broker, time.Second, testMaxReadSize).RegisterRoutes(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c, err := New(context.Background(), srv.URL, "client-test", srv.Client())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := c.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return c
+}
+
+func TestFS(t *testing.T) {
+	c := newTestClient(t)
+
+	files := map[string]string{
+		"top.txt":       "top",
+		"a/x.txt":       "x",
+		"a/b/c.txt":     "nested file",
+		"a/b/empty.txt": "",
+	}
+	if err := c.MkdirAll("a/b", 0o755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := c.Mkdir("e", 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	for name, content := range files {
+		if err := c.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile %s: %v", name, err)
+		}
+	}
+
+	if err := fstest.TestFS(c, "top.txt", "a/x.txt", "a/b/c.txt", "a/b/empty.txt", "e"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		data, err := fs.ReadFile(c, name)
+		if err != nil {
+			t.Fatalf("ReadFile %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("ReadFile %s = %q, want %q", name, data, content)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	c := newTestClient(t)
+
+	if err := c.Create("f.txt", 0o644); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := c.Create("f.txt", 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("Create of existing file = %v, want ErrExist", err)
+	}
+
+	// Larger than one write chunk, so WriteAt splits it
+	data := bytes.Repeat([]byte("0123456789abcdef"), maxWriteChunk/8)
+	if n, err := c.WriteAt("f.txt", data, 0); err != nil || n != len(data) {
+		t.Fatalf("WriteAt = %d, %v", n, err)
+	}
+	if _, err := c.WriteAt("f.txt", []byte("tail"), int64(len(data))+4); err != nil {
+		t.Fatalf("WriteAt past end: %v", err)
+	}
+	want := append(append(append([]byte{}, data...), 0, 0, 0, 0), "tail"...)
+
+	got, err := fs.ReadFile(c, "f.txt")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ReadFile returned %d bytes, want %d", len(got), len(want))
+	}
+
+	if err := c.Mkdir("d", 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	if err := c.Mkdir("d", 0o755); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("Mkdir of existing directory = %v, want ErrExist", err)
+	}
+	if _, err := c.WriteAt("d", []byte("x"), 0); err == nil {
+		t.Fatal("WriteAt to directory succeeded")
+	}
+
+	if err := c.Link("f.txt", "d/g.txt"); err != nil {
+		t.Fatalf("Link: %v", err)
+	}
+	if links, err := c.CountLinks("d/g.txt"); err != nil || links != 2 {
+		t.Fatalf("CountLinks = %d, %v", links, err)
+	}
+
+	if err := c.Remove("f.txt"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := c.Stat("f.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat of removed file = %v, want ErrNotExist", err)
+	}
+	got, err = fs.ReadFile(c, "d/g.txt")
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("ReadFile of link after Remove: %d bytes, %v", len(got), err)
+	}
+
+	if err := c.Remove("d"); err == nil {
+		t.Fatal("Remove of non-empty directory succeeded")
+	}
+	if err := c.Remove("d/g.txt"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := c.Remove("d"); err != nil {
+		t.Fatalf("Remove of empty directory: %v", err)
+	}
+	if entries, err := fs.ReadDir(c, "."); err != nil || len(entries) != 0 {
+		t.Fatalf("ReadDir after Remove = %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+var (
+	_ fs.FS        = (*Client)(nil)
+	_ fs.ReadDirFS = (*Client)(nil)
+	_ fs.StatFS    = (*Client)(nil)
+)
+
+// Open opens file or directory. Directories implement fs.ReadDirFile,
+// files also implement io.ReaderAt and io.Seeker
+func (c *Client) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	meta, err := c.resolve(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	if meta.Type == models.NodeTypeDir {
+		return &dir{c: c, name: name, meta: meta}, nil
+	}
+
+	// Keep the inode alive if it is unlinked while the file is open
+	fh, err := c.open(meta.Ino)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	return &file{c: c, name: name, meta: meta, fh: fh}, nil
+}
+
+// ReadDir returns directory entries sorted by name
+func (c *Client) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := c.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, ok := f.(*dir)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+
+	entries, err := d.ReadDir(-1)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, err
+}
+
+func (c *Client) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	meta, err := c.resolve(name)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(path.Base(name), meta), nil
+}
+
+// file is an open regular file. Reads go straight to the server, nothing is buffered
+type file struct {
+	c    *Client
+	name string
+	meta *models.NodeMeta
+	// Handle from /api/open, zero if server has no handles
+	fh     int64
+	offset int64
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return newFileInfo(path.Base(f.name), f.meta), nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	n, err := f.c.read(f.meta.Ino, p, f.offset)
+	if err != nil {
+		return 0, pathError("read", f.name, err)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *file) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	read := 0
+	for read < len(p) {
+		n, err := f.c.read(f.meta.Ino, p[read:], offset+int64(read))
+		if err != nil {
+			return read, pathError("read", f.name, err)
+		}
+		if n == 0 {
+			return read, io.EOF
+		}
+		read += n
+	}
+	return read, nil
+}
+
+// Seek relative to the end uses size as of Open
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.meta.Size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	return pathError("close", f.name, f.c.release(f.fh))
+}
+
+// dir is an open directory
+type dir struct {
+	c    *Client
+	name string
+	meta *models.NodeMeta
+	// iterate_dir cursor
+	offset uint64
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return newFileInfo(path.Base(d.name), d.meta), nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+// ReadDir returns entries in server order (by name)
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for n <= 0 || len(entries) < n {
+		dirent, err := d.c.iterateDir(d.meta.Ino, d.offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, pathError("readdir", d.name, err)
+		}
+
+		d.offset++
+		entries = append(entries, &dirEntry{c: d.c, dirIno: d.meta.Ino, dirent: dirent})
+	}
+
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+	return entries, nil
+}
+
+// dirEntry fetches attributes lazily, listing itself costs one request per entry
+type dirEntry struct {
+	c      *Client
+	dirIno int64
+	dirent *models.Dirent
+}
+
+func (e *dirEntry) Name() string { return e.dirent.Name }
+func (e *dirEntry) IsDir() bool  { return e.dirent.Type == models.NodeTypeDir }
+
+func (e *dirEntry) Type() fs.FileMode {
+	if e.IsDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	meta, err := e.c.lookup(e.dirIno, e.dirent.Name)
+	if err != nil {
+		return nil, pathError("stat", e.dirent.Name, err)
+	}
+	return newFileInfo(e.dirent.Name, meta), nil
+}
+
+// fileInfo adapts NodeMeta to fs.FileInfo. Sys returns *models.NodeMeta
+type fileInfo struct {
+	name string
+	meta models.NodeMeta
+}
+
+func newFileInfo(name string, meta *models.NodeMeta) *fileInfo {
+	return &fileInfo{name: name, meta: *meta}
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return fi.meta.Size }
+func (fi *fileInfo) IsDir() bool  { return fi.meta.Type == models.NodeTypeDir }
+func (fi *fileInfo) Sys() any     { return &fi.meta }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	mode := fs.FileMode(fi.meta.Mode & 0o777)
+	if fi.IsDir() {
+		mode |= fs.ModeDir
+	}
+	return mode
+}
+
+// ModTime is unknown: inodes don't expose modification time
+func (fi *fileInfo) ModTime() time.Time { return time.Time{} }
+
+func pathError(op string, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"syscall"
+
+	"github.com/S1riyS/os-course-lab-4/server/internal/models"
+)
+
+// Create creates empty regular file. Unlike os.Create it fails with EEXIST
+// if name exists, the /api protocol has no truncate
+func (c *Client) Create(name string, perm fs.FileMode) error {
+	parent, base, err := c.resolveParent("create", name)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.callMeta("/api/create_file", url.Values{
+		"token":  {c.token},
+		"parent": {strconv.FormatInt(parent.Ino, 10)},
+		"name":   {base},
+		"mode":   {strconv.FormatUint(uint64(perm.Perm()), 10)},
+	})
+	return pathError("create", name, err)
+}
+
+func (c *Client) Mkdir(name string, perm fs.FileMode) error {
+	parent, base, err := c.resolveParent("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.callMeta("/api/mkdir", url.Values{
+		"token":  {c.token},
+		"parent": {strconv.FormatInt(parent.Ino, 10)},
+		"name":   {base},
+		"mode":   {strconv.FormatUint(uint64(perm.Perm()), 10)},
+	})
+	return pathError("mkdir", name, err)
+}
+
+// MkdirAll creates directory together with missing parents, like os.MkdirAll
+func (c *Client) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	meta, err := c.getRoot()
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	for _, component := range splitPath(name) {
+		child, err := c.lookup(meta.Ino, component)
+		if err == syscall.ENOENT {
+			child, err = c.callMeta("/api/mkdir", url.Values{
+				"token":  {c.token},
+				"parent": {strconv.FormatInt(meta.Ino, 10)},
+				"name":   {component},
+				"mode":   {strconv.FormatUint(uint64(perm.Perm()), 10)},
+			})
+		}
+		if err != nil {
+			return pathError("mkdir", name, err)
+		}
+		if child.Type != models.NodeTypeDir {
+			return pathError("mkdir", name, syscall.ENOTDIR)
+		}
+		meta = child
+	}
+	return nil
+}
+
+// Remove removes file or empty directory
+func (c *Client) Remove(name string) error {
+	parent, base, err := c.resolveParent("remove", name)
+	if err != nil {
+		return err
+	}
+
+	meta, err := c.lookup(parent.Ino, base)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+
+	endpoint := "/api/unlink"
+	if meta.Type == models.NodeTypeDir {
+		endpoint = "/api/rmdir"
+	}
+
+	_, err = c.call(c.ctx, endpoint, url.Values{
+		"token":  {c.token},
+		"parent": {strconv.FormatInt(parent.Ino, 10)},
+		"name":   {base},
+	})
+	return pathError("remove", name, err)
+}
+
+// Link creates newname as a hard link to file oldname
+func (c *Client) Link(oldname string, newname string) error {
+	if !fs.ValidPath(oldname) {
+		return &fs.PathError{Op: "link", Path: oldname, Err: fs.ErrInvalid}
+	}
+
+	target, err := c.resolve(oldname)
+	if err != nil {
+		return pathError("link", oldname, err)
+	}
+
+	parent, base, err := c.resolveParent("link", newname)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(c.ctx, "/api/link", url.Values{
+		"token":      {c.token},
+		"target_ino": {strconv.FormatInt(target.Ino, 10)},
+		"parent":     {strconv.FormatInt(parent.Ino, 10)},
+		"name":       {base},
+	})
+	return pathError("link", newname, err)
+}
+
+// WriteAt writes p to file name at offset, growing it if needed
+func (c *Client) WriteAt(name string, p []byte, offset int64) (int, error) {
+	if !fs.ValidPath(name) {
+		return 0, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+	}
+
+	meta, err := c.resolve(name)
+	if err != nil {
+		return 0, pathError("write", name, err)
+	}
+	if meta.Type == models.NodeTypeDir {
+		return 0, pathError("write", name, syscall.EISDIR)
+	}
+
+	n, err := c.write(meta.Ino, p, offset)
+	return n, pathError("write", name, err)
+}
+
+// WriteFile writes data to a new file, like os.WriteFile with O_EXCL
+func (c *Client) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := c.Create(name, perm); err != nil {
+		return err
+	}
+	_, err := c.WriteAt(name, data, 0)
+	return err
+}
+
+// resolveParent resolves directory containing name and returns it with the last path component
+func (c *Client) resolveParent(op string, name string) (*models.NodeMeta, string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	parent, err := c.resolve(path.Dir(name))
+	if err != nil {
+		return nil, "", pathError(op, name, err)
+	}
+	if parent.Type != models.NodeTypeDir {
+		return nil, "", pathError(op, name, syscall.ENOTDIR)
+	}
+
+	return parent, path.Base(name), nil
+}
@@ -30,8 +30,14 @@ func MustNewClient(ctx context.Context, cfg config.DatabaseConfig) *pgxpool.Pool
 
 		logger := logging.GetLoggerFromContextWithOp(ctx, op)
 
-		dsn := cfg.DSN()
-		pool, err := pgxpool.New(ctx, dsn)
+		poolCfg, err := pgxpool.ParseConfig(cfg.DSN())
+		if err != nil {
+			logger.Error("Failed to parse database config", slogext.Err(err))
+			panic(err)
+		}
+		poolCfg.ConnConfig.Tracer = queryTracer{}
+
+		pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 		if err != nil {
 			logger.Error("Failed to create connection pool", slogext.Err(err))
 			panic(err)
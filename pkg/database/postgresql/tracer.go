@@ -0,0 +1,78 @@
+package postgresql
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/S1riyS/os-course-lab-4/server/pkg/database/postgresql"
+
+// queryTracer creates a span for every SQL statement executed through the pool
+// and counts statements
+type queryTracer struct{}
+
+var _ pgx.QueryTracer = queryTracer{}
+
+// QueryTracer returns the tracer MustNewClient installs, for pools
+// configured elsewhere (tests, tools)
+func QueryTracer() pgx.QueryTracer {
+	return queryTracer{}
+}
+
+var queries atomic.Uint64
+
+// Queries returns total number of SQL statements executed since start
+func Queries() uint64 {
+	return queries.Load()
+}
+
+type queryCounterKey struct{}
+
+// CountQueries returns ctx under which every executed statement also
+// increments the returned counter
+func CountQueries(ctx context.Context) (context.Context, *atomic.Uint64) {
+	counter := new(atomic.Uint64)
+	return context.WithValue(ctx, queryCounterKey{}, counter), counter
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	queries.Add(1)
+	if counter, ok := ctx.Value(queryCounterKey{}).(*atomic.Uint64); ok {
+		counter.Add(1)
+	}
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, "db."+statementVerb(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", strings.TrimSpace(data.SQL)),
+		),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// statementVerb returns first keyword of query (SELECT, INSERT, ...) for span name
+func statementVerb(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
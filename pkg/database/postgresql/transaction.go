@@ -2,20 +2,67 @@ package postgresql
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type txKey struct{}
 
-// WithTransaction executes function inside a transaction
+// txState is stored in context of a running transaction
+type txState struct {
+	tx          pgx.Tx
+	afterCommit []func()
+}
+
+// How many times a transaction is re-run after serialization failure or deadlock
+const maxTxRetries = 3
+
+var (
+	txRetries   atomic.Uint64
+	txConflicts atomic.Uint64
+)
+
+// WithTransaction executes function inside a transaction. A transaction
+// failed by serialization failure or deadlock is re-run up to maxTxRetries
+// times, so fn must not leak partial results outside on error (use
+// AfterCommit). A transaction nested in another one is not re-run on its
+// own, the outermost one is
 func WithTransaction(ctx context.Context, db Client, fn func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := runTransaction(ctx, db, fn)
+		if !IsConflict(err) {
+			return err
+		}
+		if attempt >= maxTxRetries || InTransaction(ctx) || ctx.Err() != nil {
+			txConflicts.Add(1)
+			return err
+		}
+		txRetries.Add(1)
+	}
+}
+
+// TxRetries returns total number of transactions re-run since start
+func TxRetries() uint64 {
+	return txRetries.Load()
+}
+
+// TxConflicts returns total number of transactions failed by serialization
+// failure or deadlock since start after all retries
+func TxConflicts() uint64 {
+	return txConflicts.Load()
+}
+
+func runTransaction(ctx context.Context, db Client, fn func(context.Context) error) (err error) {
 	tx, err := db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 
-	txCtx := context.WithValue(ctx, txKey{}, tx)
+	state := &txState{tx: tx}
+	txCtx := context.WithValue(ctx, txKey{}, state)
 
 	defer func() {
 		if p := recover(); p != nil {
@@ -25,6 +72,11 @@ func WithTransaction(ctx context.Context, db Client, fn func(context.Context) er
 			_ = tx.Rollback(ctx)
 		} else {
 			err = tx.Commit(ctx)
+			if err == nil {
+				for _, fn := range state.afterCommit {
+					fn()
+				}
+			}
 		}
 	}()
 
@@ -32,10 +84,37 @@ func WithTransaction(ctx context.Context, db Client, fn func(context.Context) er
 	return err
 }
 
+// IsConflict reports whether err is a serialization failure or a deadlock,
+// which may succeed if tried again
+func IsConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	// serialization_failure, deadlock_detected
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
 // postgresql.GetDBClient returns transaction from context if present, otherwise returns the default client
 func GetDBClient(ctx context.Context, defaultClient Client) Client {
-	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
-		return tx
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return state.tx
 	}
 	return defaultClient
 }
+
+// InTransaction reports whether ctx carries a transaction started by WithTransaction
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// AfterCommit runs fn once the transaction in ctx commits, or right away
+// outside a transaction. Hooks of a rolled back transaction are dropped
+func AfterCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		state.afterCommit = append(state.afterCommit, fn)
+		return
+	}
+	fn()
+}
@@ -0,0 +1,18 @@
+package logging
+
+import "context"
+
+var remoteAddrKey = ctxLoggerKey{Key: "remote_addr"}
+
+func GetRemoteAddrFromCtx(ctx context.Context) string {
+	if v := ctx.Value(remoteAddrKey); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func MakeContextWithRemoteAddr(ctx context.Context, remoteAddr string) context.Context {
+	return context.WithValue(ctx, remoteAddrKey, remoteAddr)
+}
@@ -0,0 +1,138 @@
+// Package lru implements a bounded least-recently-used cache safe for
+// concurrent use
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache holds at most size entries, the least recently used one is evicted
+// first.
+//
+// Readers that fill the cache after a miss race with writers that
+// invalidate: a value read before an invalidation must not be stored after
+// it. Generation and AddIfGeneration close that window:
+//
+//	gen := cache.Generation()
+//	value := load()
+//	cache.AddIfGeneration(gen, key, value)
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	size       int
+	ll         *list.List
+	items      map[K]*list.Element
+	generation uint64
+	stats      Stats
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Stats are cumulative counters since creation
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  max(size, 1),
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		c.stats.Hits++
+		return el.Value.(*entry[K, V]).value, true
+	}
+
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Add stores value, replacing the previous one
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.add(key, value)
+}
+
+// AddIfGeneration stores value only if nothing was invalidated since gen was taken
+func (c *Cache[K, V]) AddIfGeneration(gen uint64, key K, value V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.generation {
+		return false
+	}
+	c.add(key, value)
+	return true
+}
+
+func (c *Cache[K, V]) add(key K, value V) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*entry[K, V]).value = value
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value})
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+		c.stats.Evictions++
+	}
+}
+
+// Generation returns counter that changes with every Remove and Purge
+func (c *Cache[K, V]) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// Purge drops all entries
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	clear(c.items)
+}
+
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
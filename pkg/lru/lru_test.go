@@ -0,0 +1,105 @@
+package lru
+
+import "testing"
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// Touching a makes b the oldest
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a missing before eviction")
+	}
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %d, %v, want %d, true", key, got, ok, want)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if s := c.Stats(); s.Evictions != 1 {
+		t.Errorf("Evictions = %d, want 1", s.Evictions)
+	}
+}
+
+func TestAddReplacesWithoutEviction(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("a", 10)
+
+	if got, _ := c.Get("a"); got != 10 {
+		t.Errorf("Get(a) = %d, want 10", got)
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("replacing a evicted b")
+	}
+	if s := c.Stats(); s.Evictions != 0 {
+		t.Errorf("Evictions = %d, want 0", s.Evictions)
+	}
+}
+
+func TestAddIfGenerationDropsStaleValue(t *testing.T) {
+	for name, invalidate := range map[string]func(c *Cache[string, int]){
+		"remove": func(c *Cache[string, int]) { c.Remove("a") },
+		// Removing another key still invalidates, the reader can't know
+		// which keys its value depends on
+		"remove other": func(c *Cache[string, int]) { c.Remove("b") },
+		"purge":        func(c *Cache[string, int]) { c.Purge() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := New[string, int](4)
+
+			gen := c.Generation()
+			invalidate(c)
+			if c.AddIfGeneration(gen, "a", 1) {
+				t.Fatal("value loaded before invalidation was stored")
+			}
+			if _, ok := c.Get("a"); ok {
+				t.Fatal("stale value is cached")
+			}
+
+			gen = c.Generation()
+			if !c.AddIfGeneration(gen, "a", 2) {
+				t.Fatal("value loaded after invalidation was dropped")
+			}
+			if got, ok := c.Get("a"); !ok || got != 2 {
+				t.Fatalf("Get(a) = %d, %v, want 2, true", got, ok)
+			}
+		})
+	}
+}
+
+func TestPurgeDropsEverything(t *testing.T) {
+	c := New[int, int](8)
+	for i := range 5 {
+		c.Add(i, i)
+	}
+	c.Purge()
+
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d after Purge, want 0", c.Len())
+	}
+	if _, ok := c.Get(1); ok {
+		t.Error("entry survived Purge")
+	}
+}
+
+func TestStatsCountHitsAndMisses(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 2 hits and 1 miss", s)
+	}
+}